@@ -0,0 +1,148 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 每列直方图的桶数
+const HISTOGRAM_BUCKETS = 16
+
+// HistogramBucket 包含不大于Upper、大于前一个桶上界的值
+type HistogramBucket struct {
+	Upper    string
+	Rows     uint32
+	Distinct uint32
+}
+
+// Histogram 是一列的等深直方图，每个桶的行数大致相同，同一个值不会跨桶。
+// 和全文索引一样只保存在内存中，之后的写入不会更新它，需要重新analyze
+type Histogram struct {
+	Rows    uint32
+	Buckets []HistogramBucket
+}
+
+// analyze [TABLE]
+func (stat *Statement) prepareAnalyze(parts []Token) error {
+	stat.Typ = StatementTypeAnalyze
+	switch len(parts) {
+	case 1:
+		return nil
+	case 2:
+		stat.TableName = parts[1].Text
+		return nil
+	}
+	return stat.syntaxError(parts, 2, "")
+}
+
+// 列值的比较规则，id按数值比较，文本列按列默认的排序规则比较
+func columnCompare(column string) func(a, b string) int {
+	if column == "id" {
+		return func(a, b string) int {
+			x, _ := strconv.ParseUint(a, 10, 32)
+			y, _ := strconv.ParseUint(b, 10, 32)
+			return cmp.Compare(x, y)
+		}
+	}
+	if compare, ok := lookupCollation(COLUMN_COLLATIONS[column]); ok {
+		return compare
+	}
+	return strings.Compare
+}
+
+func columnValue(row *Row, column string) string {
+	if column == "id" {
+		return strconv.FormatUint(uint64(row.ID), 10)
+	}
+	return columnText(row, column)
+}
+
+// 扫描全表，为每一列建立直方图
+func (t *Table) analyze() error {
+	values := make(map[string][]string, len(COLUMN_NAMES))
+	err := t.executeSelect(func(row *Row) error {
+		for _, column := range COLUMN_NAMES {
+			values[column] = append(values[column], columnValue(row, column))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	histograms := make(map[string]*Histogram, len(COLUMN_NAMES))
+	for _, column := range COLUMN_NAMES {
+		histograms[column] = buildHistogram(values[column], columnCompare(column))
+	}
+	t.histograms = histograms
+	return nil
+}
+
+func buildHistogram(values []string, compare func(a, b string) int) *Histogram {
+	slices.SortFunc(values, compare)
+	h := &Histogram{Rows: uint32(len(values))}
+	depth := uint32(math.Ceil(float64(len(values)) / HISTOGRAM_BUCKETS))
+	var bucket HistogramBucket
+	for i, v := range values {
+		if i == 0 || compare(v, values[i-1]) != 0 {
+			bucket.Distinct++
+		}
+		bucket.Rows++
+		bucket.Upper = v
+		// 桶满后在值变化处结束，最后一个桶不满也要保留
+		last := i+1 == len(values)
+		if last || bucket.Rows >= depth && compare(values[i+1], v) != 0 {
+			h.Buckets = append(h.Buckets, bucket)
+			bucket = HistogramBucket{}
+		}
+	}
+	return h
+}
+
+// 估计等于value的行所占的比例，假设桶内各个值的行数相同
+func (h *Histogram) equalSelectivity(value string, compare func(a, b string) int) float64 {
+	if h.Rows == 0 {
+		return 0
+	}
+	i, _ := slices.BinarySearchFunc(h.Buckets, value, func(b HistogramBucket, v string) int {
+		return compare(b.Upper, v)
+	})
+	if i == len(h.Buckets) {
+		return 0
+	}
+	b := h.Buckets[i]
+	return float64(b.Rows) / float64(b.Distinct) / float64(h.Rows)
+}
+
+// 估计满足等值条件的行数，没有可用的直方图时使用固定的选择率
+func (t *Table) estimateRows(cond *Condition) uint32 {
+	selectivity := DEFAULT_EQUALITY_SELECTIVITY
+	if h, ok := t.histograms[cond.Column]; ok && (cond.Column == "id" || cond.Collation == COLUMN_COLLATIONS[cond.Column]) {
+		selectivity = h.equalSelectivity(cond.Value, columnCompare(cond.Column))
+	}
+	return uint32(math.Ceil(float64(t.numRows) * selectivity))
+}
+
+// analyze不带表名时收集所有数据库中的表和物化视图
+func (c *Catalog) executeAnalyze(stat *Statement) error {
+	if stat.TableName != "" {
+		t, err := c.resolve(stat.TableName)
+		if err != nil {
+			return err
+		}
+		return t.analyze()
+	}
+	for _, db := range c.sortedDatabases() {
+		if err := db.table.analyze(); err != nil {
+			return err
+		}
+		for _, view := range db.views {
+			if err := view.table.analyze(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	var values []string
+	for i := 100; i >= 1; i-- {
+		values = append(values, strconv.Itoa(i))
+	}
+	// 同一个值不跨桶
+	for range 30 {
+		values = append(values, "50")
+	}
+	h := buildHistogram(values, columnCompare("id"))
+
+	if h.Rows != 130 {
+		t.Errorf("histogram has %d rows, want 130", h.Rows)
+	}
+	var rows, distinct uint32
+	for i, b := range h.Buckets {
+		rows += b.Rows
+		distinct += b.Distinct
+		if i > 0 && columnCompare("id")(b.Upper, h.Buckets[i-1].Upper) <= 0 {
+			t.Errorf("bucket %d upper %s is not above %s", i, b.Upper, h.Buckets[i-1].Upper)
+		}
+	}
+	if rows != 130 || distinct != 100 {
+		t.Errorf("buckets hold %d rows and %d distinct values, want 130 and 100", rows, distinct)
+	}
+	// id按数值比较，最大的是100而不是99
+	if last := h.Buckets[len(h.Buckets)-1].Upper; last != "100" {
+		t.Errorf("last bucket upper %s, want 100", last)
+	}
+
+	compare := columnCompare("id")
+	single := h.equalSelectivity("7", compare)
+	if single <= 0 || single > 0.05 {
+		t.Errorf("selectivity of a single value is %v", single)
+	}
+	if got := h.equalSelectivity("50", compare); got <= single {
+		t.Errorf("selectivity of the frequent value is %v, not above %v", got, single)
+	}
+	if got := h.equalSelectivity("100", compare); got <= 0 {
+		t.Errorf("selectivity of the largest value is %v", got)
+	}
+	if got := h.equalSelectivity("1000", compare); got != 0 {
+		t.Errorf("selectivity above the largest value is %v, want 0", got)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Apache Arrow IPC文件格式：
+//
+//	"ARROW1" 填充 | Schema消息 | RecordBatch消息... | 结束标记 | Footer | Footer长度 "ARROW1"
+//
+// 每条消息是 0xFFFFFFFF、元数据长度、flatbuffer编码的Message和消息体。
+// 列固定为 id uint32、username utf8、email utf8，都不包含NULL
+const (
+	ARROW_MAGIC = "ARROW1"
+	// 每个RecordBatch最多包含的行数
+	ARROW_BATCH_ROWS = 1024
+
+	arrowMetadataV5       = 4
+	arrowHeaderSchema     = 1
+	arrowHeaderRecordData = 3
+	arrowTypeInt          = 2
+	arrowTypeUtf8         = 5
+)
+
+// fbField 是flatbuffer表中的一个字段，按类型只设置其中一项，全部为空表示字段缺省
+type fbField struct {
+	scalar  []byte
+	table   *fbTable
+	str     *string
+	tables  []*fbTable
+	structs [][]byte
+}
+
+type fbTable struct {
+	fields []fbField
+}
+
+func fbUint8(v uint8) fbField {
+	return fbField{scalar: []byte{v}}
+}
+
+func fbInt16(v int16) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func fbInt32(v int32) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func fbInt64(v int64) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint64(nil, uint64(v))}
+}
+
+func fbString(s string) fbField {
+	return fbField{str: &s}
+}
+
+func fbBool(v bool) fbField {
+	if v {
+		return fbUint8(1)
+	}
+	return fbUint8(0)
+}
+
+// fbBuilder 从前往后写flatbuffer：先写表，再写它引用的子对象并回填偏移，
+// 这样所有uoffset都指向更高的地址
+type fbBuilder struct {
+	buf []byte
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) putUint32(pos int, v uint32) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], v)
+}
+
+// 编码以root为根表的flatbuffer
+func encodeFlatbuffer(root *fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4)}
+	b.putUint32(0, uint32(b.writeTable(root)))
+	b.align(8)
+	return b.buf
+}
+
+// 写入vtable和表，返回表的位置
+func (b *fbBuilder) writeTable(t *fbTable) int {
+	// 先确定每个字段在表中的位置
+	offsets := make([]int, len(t.fields))
+	size := 4
+	for i, f := range t.fields {
+		width := len(f.scalar)
+		if f.scalar == nil {
+			width = 4
+			if f.table == nil && f.str == nil && f.tables == nil && f.structs == nil {
+				continue
+			}
+		}
+		for size%width != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += width
+	}
+
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*len(t.fields)))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(size))
+	for _, off := range offsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(off))
+	}
+
+	b.align(8)
+	table := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	b.putUint32(table, uint32(table-vtable))
+	for i, f := range t.fields {
+		pos := table + offsets[i]
+		switch {
+		case f.scalar != nil:
+			copy(b.buf[pos:], f.scalar)
+		case f.table != nil:
+			b.putUint32(pos, uint32(b.writeTable(f.table)-pos))
+		case f.str != nil:
+			b.align(4)
+			b.putUint32(pos, uint32(len(b.buf)-pos))
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(*f.str)))
+			b.buf = append(append(b.buf, *f.str...), 0)
+		case f.tables != nil:
+			b.align(4)
+			b.putUint32(pos, uint32(len(b.buf)-pos))
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(f.tables)))
+			elems := len(b.buf)
+			b.buf = append(b.buf, make([]byte, 4*len(f.tables))...)
+			for j, child := range f.tables {
+				elem := elems + 4*j
+				b.putUint32(elem, uint32(b.writeTable(child)-elem))
+			}
+		case f.structs != nil:
+			// 结构体按8字节对齐，长度紧挨在第一个元素之前
+			for (len(b.buf)+4)%8 != 0 {
+				b.buf = append(b.buf, 0)
+			}
+			b.putUint32(pos, uint32(len(b.buf)-pos))
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(f.structs)))
+			for _, s := range f.structs {
+				b.buf = append(b.buf, s...)
+			}
+		}
+	}
+	return table
+}
+
+func arrowField(name string, typ uint8, typeTable *fbTable) *fbTable {
+	return &fbTable{fields: []fbField{
+		fbString(name),
+		fbBool(false),
+		fbUint8(typ),
+		{table: typeTable},
+		{},
+		// 一些实现要求children存在，即使为空
+		{tables: []*fbTable{}},
+	}}
+}
+
+func arrowSchema() *fbTable {
+	uint32Type := &fbTable{fields: []fbField{fbInt32(32), fbBool(false)}}
+	return &fbTable{fields: []fbField{
+		fbInt16(0),
+		{tables: []*fbTable{
+			arrowField("id", arrowTypeInt, uint32Type),
+			arrowField("username", arrowTypeUtf8, &fbTable{}),
+			arrowField("email", arrowTypeUtf8, &fbTable{}),
+		}},
+	}}
+}
+
+func arrowMessage(headerType uint8, header *fbTable, bodyLength int) *fbTable {
+	return &fbTable{fields: []fbField{
+		fbInt16(arrowMetadataV5),
+		fbUint8(headerType),
+		{table: header},
+		fbInt64(int64(bodyLength)),
+	}}
+}
+
+// arrowBlock 记录消息在文件中的位置，写入Footer
+type arrowBlock struct {
+	offset         int64
+	metadataLength int32
+	bodyLength     int64
+}
+
+// ArrowWriter 把行按批写成Arrow IPC文件
+type ArrowWriter struct {
+	w       io.Writer
+	written int64
+	batches []arrowBlock
+	rows    []Row
+	err     error
+}
+
+func newArrowWriter(w io.Writer) (*ArrowWriter, error) {
+	aw := &ArrowWriter{w: w}
+	aw.write([]byte(ARROW_MAGIC + "\x00\x00"))
+	aw.writeMessage(arrowMessage(arrowHeaderSchema, arrowSchema(), 0), nil)
+	return aw, aw.err
+}
+
+func (aw *ArrowWriter) write(p []byte) {
+	if aw.err != nil {
+		return
+	}
+	n, err := aw.w.Write(p)
+	aw.written += int64(n)
+	aw.err = err
+}
+
+// 写入一条消息，返回它在文件中的位置
+func (aw *ArrowWriter) writeMessage(message *fbTable, body []byte) arrowBlock {
+	metadata := encodeFlatbuffer(message)
+	block := arrowBlock{offset: aw.written, metadataLength: int32(8 + len(metadata)), bodyLength: int64(len(body))}
+	prefix := binary.LittleEndian.AppendUint32(nil, 0xFFFFFFFF)
+	prefix = binary.LittleEndian.AppendUint32(prefix, uint32(len(metadata)))
+	aw.write(prefix)
+	aw.write(metadata)
+	aw.write(body)
+	return block
+}
+
+func (aw *ArrowWriter) add(row *Row) error {
+	aw.rows = append(aw.rows, *row)
+	if len(aw.rows) == ARROW_BATCH_ROWS {
+		aw.flushBatch()
+	}
+	return aw.err
+}
+
+// 把缓存的行写成一个RecordBatch
+func (aw *ArrowWriter) flushBatch() {
+	if len(aw.rows) == 0 {
+		return
+	}
+	var body []byte
+	var buffers [][]byte
+	// 追加一个8字节对齐的缓冲区
+	addBuffer := func(data []byte) {
+		buffers = append(buffers, arrowBuffer(int64(len(body)), int64(len(data))))
+		body = append(body, data...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+	ids := make([]byte, 0, 4*len(aw.rows))
+	for _, row := range aw.rows {
+		ids = binary.LittleEndian.AppendUint32(ids, row.ID)
+	}
+	addBuffer(nil)
+	addBuffer(ids)
+	for _, column := range []func(*Row) string{(*Row).username, (*Row).email} {
+		offsets := binary.LittleEndian.AppendUint32(nil, 0)
+		var data []byte
+		for i := range aw.rows {
+			data = append(data, column(&aw.rows[i])...)
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+		}
+		addBuffer(nil)
+		addBuffer(offsets)
+		addBuffer(data)
+	}
+
+	node := binary.LittleEndian.AppendUint64(nil, uint64(len(aw.rows)))
+	node = binary.LittleEndian.AppendUint64(node, 0)
+	batch := &fbTable{fields: []fbField{
+		fbInt64(int64(len(aw.rows))),
+		{structs: [][]byte{node, node, node}},
+		{structs: buffers},
+	}}
+	aw.batches = append(aw.batches, aw.writeMessage(arrowMessage(arrowHeaderRecordData, batch, len(body)), body))
+	aw.rows = aw.rows[:0]
+}
+
+func arrowBuffer(offset, length int64) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, uint64(offset))
+	return binary.LittleEndian.AppendUint64(b, uint64(length))
+}
+
+// 写入剩余的行、结束标记和Footer
+func (aw *ArrowWriter) finish() error {
+	aw.flushBatch()
+	aw.write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0})
+
+	blocks := make([][]byte, len(aw.batches))
+	for i, block := range aw.batches {
+		b := binary.LittleEndian.AppendUint64(nil, uint64(block.offset))
+		b = binary.LittleEndian.AppendUint32(b, uint32(block.metadataLength))
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		blocks[i] = binary.LittleEndian.AppendUint64(b, uint64(block.bodyLength))
+	}
+	footer := encodeFlatbuffer(&fbTable{fields: []fbField{
+		fbInt16(arrowMetadataV5),
+		{table: arrowSchema()},
+		{structs: [][]byte{}},
+		{structs: blocks},
+	}})
+	aw.write(footer)
+	aw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	aw.write([]byte(ARROW_MAGIC))
+	return aw.err
+}
+
+// 执行查询并把结果写成Arrow IPC文件，返回写入的行数
+func (c *Catalog) exportArrow(w io.Writer, query string) (int, error) {
+	stat := &Statement{}
+	if err := stat.prepareStatement(query); err != nil {
+		return 0, err
+	}
+	if stat.Typ != StatementTypeSelect {
+		return 0, fmt.Errorf("only select statements can be exported")
+	}
+	if stat.Columns != nil {
+		return 0, fmt.Errorf("exported queries must select all columns")
+	}
+	aw, err := newArrowWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	rows := 0
+	if _, err := NewSession(c, "", "local").execute(stat, func(row *Row) error {
+		rows++
+		return aw.add(row)
+	}); err != nil {
+		return 0, err
+	}
+	return rows, aw.finish()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditLog 以JSON行的形式追加记录所有写语句
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+type auditEntry struct {
+	Time      string `json:"time"`
+	User      string `json:"user,omitempty"`
+	Client    string `json:"client"`
+	Statement string `json:"statement"`
+	Rows      int    `json:"rows"`
+	Error     string `json:"error,omitempty"`
+}
+
+func openAuditLog(filename string) (*AuditLog, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file}, nil
+}
+
+func (a *AuditLog) record(user, client string, stat *Statement, rows int, execErr error) error {
+	entry := auditEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		User:      user,
+		Client:    client,
+		Statement: redactStatement(stat),
+		Rows:      rows,
+	}
+	if execErr != nil {
+		entry.Error = execErr.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+func (a *AuditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.file.Close()
+}
+
+// 审计日志中不能出现明文密码
+func redactStatement(stat *Statement) string {
+	parts, err := tokenize(stat.Text)
+	if err != nil {
+		return strings.Join(strings.Fields(stat.Text), " ")
+	}
+	words := make([]string, len(parts))
+	for i, p := range parts {
+		words[i] = stat.Text[p.Pos:p.End]
+		if i > 0 && parts[i-1].is("password") {
+			words[i] = "***"
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLogRedactsPasswords(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	a, err := openAuditLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		text    string
+		rows    int
+		execErr error
+	}{
+		{"insert 1 alice alice@example.com", 1, nil},
+		{"create user bob password 'top secret'", 0, nil},
+		{"insert 1 alice alice@example.com", 0, errors.New("duplicate key")},
+	} {
+		stat := &Statement{}
+		if err := stat.prepareStatement(tc.text); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.record("root", "127.0.0.1:5000", stat, tc.rows, tc.execErr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "top secret") {
+			t.Errorf("audit log contains a password: %s", scanner.Text())
+		}
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("audit log has %d entries, want 3", len(entries))
+	}
+	if entries[0].User != "root" || entries[0].Rows != 1 || entries[0].Error != "" {
+		t.Errorf("insert entry %+v", entries[0])
+	}
+	if want := "create user bob password ***"; entries[1].Statement != want {
+		t.Errorf("create user entry %q, want %q", entries[1].Statement, want)
+	}
+	if entries[2].Error != "duplicate key" {
+		t.Errorf("failed insert entry %+v", entries[2])
+	}
+}
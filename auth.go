@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	AUTH_FILE_SUFFIX = "-auth"
+
+	PASSWORD_SALT_SIZE  = 16
+	PASSWORD_ITERATIONS = 100000
+	PASSWORD_SCHEME     = "pbkdf2-sha256"
+)
+
+var (
+	ErrUserExists          = fmt.Errorf("user already exists")
+	ErrUnknownUser         = fmt.Errorf("no such user")
+	ErrAuthFailed          = fmt.Errorf("authentication failed")
+	ErrAuthRequired        = fmt.Errorf("authentication required")
+	ErrInvalidPasswordHash = fmt.Errorf("invalid password hash")
+)
+
+func (c *Catalog) executeCreateUser(stat *Statement) error {
+	accounts, err := c.databases[MAIN_DATABASE].accountsTable()
+	if err != nil {
+		return err
+	}
+	if _, ok, err := accounts.Get([]byte(stat.UserName)); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%w: %s", ErrUserExists, stat.UserName)
+	}
+
+	// 第一个用户自动成为超级用户，否则没有人能管理权限
+	first := accounts.Len() == 0
+	if err := setPassword(accounts, stat.UserName, stat.Password); err != nil {
+		return err
+	}
+	if first || stat.Superuser {
+		return c.setSuperuser(stat.UserName)
+	}
+	return nil
+}
+
+func (c *Catalog) executeAlterUser(stat *Statement) error {
+	accounts, err := c.databases[MAIN_DATABASE].accountsTable()
+	if err != nil {
+		return err
+	}
+	if _, ok, err := accounts.Get([]byte(stat.UserName)); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownUser, stat.UserName)
+	}
+	return setPassword(accounts, stat.UserName, stat.Password)
+}
+
+func setPassword(accounts *KVTable, name, password string) error {
+	salt := make([]byte, PASSWORD_SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	hash := pbkdf2SHA256([]byte(password), salt, PASSWORD_ITERATIONS)
+	encoded := fmt.Sprintf("%s$%d$%s$%s", PASSWORD_SCHEME, PASSWORD_ITERATIONS,
+		hex.EncodeToString(salt), hex.EncodeToString(hash))
+	return accounts.Put([]byte(name), []byte(encoded))
+}
+
+// 没有任何用户时不要求认证，第一个用户可以通过网络连接创建
+func (c *Catalog) authRequired() (bool, error) {
+	accounts, err := c.accounts()
+	if err != nil {
+		return false, err
+	}
+	return accounts.Len() > 0, nil
+}
+
+func (c *Catalog) authenticate(name, password string) error {
+	accounts, err := c.accounts()
+	if err != nil {
+		return err
+	}
+	encoded, ok, err := accounts.Get([]byte(name))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 用户不存在时同样计算一次哈希，避免通过耗时判断用户是否存在
+		pbkdf2SHA256([]byte(password), make([]byte, PASSWORD_SALT_SIZE), PASSWORD_ITERATIONS)
+		return ErrAuthFailed
+	}
+
+	fields := strings.Split(string(encoded), "$")
+	if len(fields) != 4 || fields[0] != PASSWORD_SCHEME {
+		return ErrInvalidPasswordHash
+	}
+	iterations, err := strconv.Atoi(fields[1])
+	if err != nil || iterations < 1 {
+		return ErrInvalidPasswordHash
+	}
+	salt, err := hex.DecodeString(fields[2])
+	if err != nil {
+		return ErrInvalidPasswordHash
+	}
+	expected, err := hex.DecodeString(fields[3])
+	if err != nil {
+		return ErrInvalidPasswordHash
+	}
+
+	hash := pbkdf2SHA256([]byte(password), salt, iterations)
+	if subtle.ConstantTimeCompare(hash, expected) != 1 {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// PBKDF2-HMAC-SHA256，输出长度等于一个SHA-256摘要，只需计算第一个块
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	var blockIndex [4]byte
+	binary.BigEndian.PutUint32(blockIndex[:], 1)
+	mac.Write(blockIndex[:])
+	u := mac.Sum(nil)
+
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestAuthenticateUsers(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	if required, err := c.authRequired(); err != nil || required {
+		t.Fatalf("authRequired without users = %v, %v", required, err)
+	}
+	execTest(t, s, "create user root password 'first secret'")
+	if required, err := c.authRequired(); err != nil || !required {
+		t.Fatalf("authRequired with a user = %v, %v", required, err)
+	}
+	if err := execTestErr(t, s, "create user root password other"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("duplicate user: got %v, want ErrUserExists", err)
+	}
+
+	if err := c.authenticate("root", "first secret"); err != nil {
+		t.Errorf("correct password: %v", err)
+	}
+	for _, tc := range []struct{ user, password string }{
+		{"root", "wrong"},
+		{"nobody", "first secret"},
+	} {
+		if err := c.authenticate(tc.user, tc.password); !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("authenticate(%q, %q): got %v, want ErrAuthFailed", tc.user, tc.password, err)
+		}
+	}
+
+	execTest(t, s, "alter user root password changed")
+	if err := c.authenticate("root", "first secret"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("old password after alter user: got %v, want ErrAuthFailed", err)
+	}
+	if err := c.authenticate("root", "changed"); err != nil {
+		t.Errorf("new password after alter user: %v", err)
+	}
+	if err := execTestErr(t, s, "alter user nobody password x"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("alter unknown user: got %v, want ErrUnknownUser", err)
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914 第11节的测试向量，取前32字节
+	got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1))
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"
+	if got != want {
+		t.Errorf("pbkdf2SHA256 = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// .bench 默认的操作次数
+const (
+	BENCH_DEFAULT_INSERTS = 10000
+	BENCH_DEFAULT_SCANS   = 100
+	// 扫描基准测试的表中的行数
+	BENCH_SCAN_ROWS = 1200
+)
+
+// 在临时的内存表上运行插入或全表扫描，输出吞吐量和延迟分位数
+func runBench(kind string, n int) error {
+	t, err := dbOpen("")
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	var row Row
+	// 生成第i行数据
+	fill := func(i int) {
+		row = Row{ID: uint32(i)}
+		copy(row.Username[:], fmt.Sprintf("user%d", i))
+		copy(row.Email[:], fmt.Sprintf("user%d@example.com", i))
+	}
+
+	latencies := make([]time.Duration, 0, n)
+	var rows int
+	switch kind {
+	case "insert":
+		for i := 0; i < n; i++ {
+			fill(i)
+			start := time.Now()
+			if err := t.insertRow(&row); err != nil {
+				return err
+			}
+			latencies = append(latencies, time.Since(start))
+		}
+		rows = n
+	case "select":
+		for i := 0; i < BENCH_SCAN_ROWS; i++ {
+			fill(i)
+			if err := t.insertRow(&row); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < n; i++ {
+			start := time.Now()
+			if err := t.executeSelect(func(*Row) error { return nil }); err != nil {
+				return err
+			}
+			latencies = append(latencies, time.Since(start))
+		}
+		rows = n * BENCH_SCAN_ROWS
+	default:
+		return fmt.Errorf("unknown benchmark: %s", kind)
+	}
+
+	var total time.Duration
+	for _, d := range latencies {
+		total += d
+	}
+	slices.Sort(latencies)
+	percentile := func(p int) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[(len(latencies)-1)*p/100]
+	}
+	fmt.Printf("%s: %d operations, %d rows in %v, %.0f rows/s\n",
+		kind, n, rows, total, float64(rows)/max(total.Seconds(), 1e-9))
+	fmt.Printf("latency: p50 %v, p90 %v, p99 %v, max %v\n",
+		percentile(50), percentile(90), percentile(99), percentile(100))
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// 每个id占用的位数和哈希函数个数，误判率约为0.05%。
+// 过滤器按表的行数分配，加入的id超过容量时按当前行数重建
+const (
+	BLOOM_FILTER_BITS_PER_ID = 16
+	BLOOM_FILTER_HASHES      = 7
+	BLOOM_FILTER_MIN_IDS     = 1024
+)
+
+// BloomFilter 记录表中出现过的id，where id = N 的查询在过滤器中找不到N时不扫描表。
+// 行被回滚后过滤器不删除它的id，只会增加误判，不会漏掉存在的行
+type BloomFilter struct {
+	bits     []uint64
+	capacity uint32
+	added    uint32
+	// 查询并发执行，计数器用原子操作更新
+	lookups        atomic.Int64
+	skipped        atomic.Int64
+	falsePositives atomic.Int64
+}
+
+// 容量为行数的两倍，重建之前还能插入同样多的行
+func newBloomFilter(rows uint32) *BloomFilter {
+	capacity := uint32(min(2*uint64(rows), math.MaxUint32))
+	capacity = max(capacity, BLOOM_FILTER_MIN_IDS)
+	words := (uint64(capacity)*BLOOM_FILTER_BITS_PER_ID + 63) / 64
+	return &BloomFilter{bits: make([]uint64, words), capacity: capacity}
+}
+
+// 用两个哈希值组合出BLOOM_FILTER_HASHES个位置
+func bloomHashes(id uint32) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(binary.LittleEndian.AppendUint32(nil, id))
+	sum := h.Sum64()
+	return uint64(uint32(sum)), uint64(uint32(sum>>32) | 1)
+}
+
+func (f *BloomFilter) add(id uint32) {
+	h1, h2 := bloomHashes(id)
+	size := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < BLOOM_FILTER_HASHES; i++ {
+		bit := (h1 + i*h2) % size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.added++
+}
+
+func (f *BloomFilter) mayContain(id uint32) bool {
+	h1, h2 := bloomHashes(id)
+	size := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < BLOOM_FILTER_HASHES; i++ {
+		bit := (h1 + i*h2) % size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 加入的id超过容量后误判率迅速升高，需要重建
+func (f *BloomFilter) full() bool {
+	return f.added >= f.capacity
+}
+
+func (f *BloomFilter) reset() {
+	clear(f.bits)
+	f.added = 0
+}
+
+// 扫描全表建立过滤器，之后插入的行由insertRow加入，重建时保留原来的计数
+func (t *Table) buildBloomFilter() error {
+	f := newBloomFilter(t.numRows)
+	err := t.executeSelect(func(row *Row) error {
+		f.add(row.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if old := t.bloom; old != nil {
+		f.lookups.Store(old.lookups.Load())
+		f.skipped.Store(old.skipped.Load())
+		f.falsePositives.Store(old.falsePositives.Load())
+	}
+	t.bloom = f
+	return nil
+}
+
+// pragma bloom_filter 打开或关闭所有表的过滤器
+func (t *Table) setBloomFilter(on bool) error {
+	switch {
+	case !on:
+		t.bloom = nil
+	case t.bloom == nil:
+		return t.buildBloomFilter()
+	}
+	return nil
+}
+
+// where id = N 的查询先检查过滤器，确定不存在时不调用scan。
+// 扫描后没有找到行说明过滤器误判
+func (f *BloomFilter) lookup(id uint32, handle RowHandler, scan func(RowHandler) error) error {
+	f.lookups.Add(1)
+	if !f.mayContain(id) {
+		f.skipped.Add(1)
+		return nil
+	}
+	found := false
+	err := scan(func(row *Row) error {
+		found = true
+		return handle(row)
+	})
+	if err == nil && !found {
+		f.falsePositives.Add(1)
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestBloomFilterSkipsAbsentIDs(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "pragma bloom_filter = on")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	users, err := c.resolve(USERS_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 打开之前和之后插入的行都能找到
+	for _, id := range []uint32{1, 2} {
+		if got := execTest(t, s, fmt.Sprintf("select * from users where id = %d", id)); !slices.Equal(got, []uint32{id}) {
+			t.Errorf("id %d: got %v", id, got)
+		}
+	}
+	skipped := users.bloom.skipped.Load()
+	if got := execTest(t, s, "select * from users where id = 12345"); len(got) != 0 {
+		t.Errorf("absent id returned %v", got)
+	}
+	if users.bloom.skipped.Load() != skipped+1 {
+		t.Error("lookup of an absent id scanned the table")
+	}
+
+	execTest(t, s, "pragma bloom_filter = off")
+	if users.bloom != nil {
+		t.Error("bloom filter kept after turning it off")
+	}
+}
+
+func TestBloomFilterGrowsWithTable(t *testing.T) {
+	c := openTestCatalog(t)
+	users, err := c.resolve(USERS_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.setBloomFilter(true); err != nil {
+		t.Fatal(err)
+	}
+	capacity := users.bloom.capacity
+	for id := uint32(1); id <= capacity+1; id++ {
+		if err := users.insertRow(&Row{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if users.bloom.capacity <= capacity {
+		t.Errorf("capacity stayed at %d after %d inserts", users.bloom.capacity, capacity+1)
+	}
+	for id := uint32(1); id <= capacity+1; id++ {
+		if !users.bloom.mayContain(id) {
+			t.Fatalf("rebuilt filter lost id %d", id)
+		}
+	}
+}
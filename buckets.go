@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 除了默认的键值表，每个桶是main数据库旁边的一个 -kv-NAME 文件，
+// 与默认的键值表使用同样的记录格式和页缓存。各个桶的键互不影响，
+// 删除桶只需关闭并删除它的文件，与桶中键的个数无关
+const KV_BUCKET_SUFFIX = KV_FILE_SUFFIX + "-"
+
+var (
+	ErrNoSuchKey    = fmt.Errorf("no such key")
+	ErrNoSuchBucket = fmt.Errorf("no such bucket")
+)
+
+// 桶名只能包含字母、数字和下划线，不区分大小写
+func checkBucketName(name string) error {
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return fmt.Errorf("invalid bucket name %q", name)
+		}
+	}
+	return nil
+}
+
+// 获取一个桶，首次使用时才打开或创建，name为空时是默认的键值表
+func (c *Catalog) bucket(name string) (*KVTable, error) {
+	if name == "" {
+		return c.kvTable(MAIN_DATABASE)
+	}
+	if err := checkBucketName(name); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.databases[MAIN_DATABASE].sidecar(KV_BUCKET_SUFFIX + strings.ToLower(name))
+}
+
+// 按名称排序的所有桶，包括还没有打开的
+func (c *Catalog) buckets() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db := c.databases[MAIN_DATABASE]
+	var names []string
+	for suffix := range db.sidecars {
+		if name, ok := strings.CutPrefix(suffix, KV_BUCKET_SUFFIX); ok {
+			names = append(names, name)
+		}
+	}
+	if db.filename != "" {
+		matches, err := filepath.Glob(db.filename + KV_BUCKET_SUFFIX + "*")
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			name := strings.TrimPrefix(m, db.filename+KV_BUCKET_SUFFIX)
+			if checkBucketName(name) == nil && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// 关闭桶并删除它的文件
+func (c *Catalog) dropBucket(name string) error {
+	if err := checkBucketName(name); err != nil || name == "" {
+		return fmt.Errorf("%w: %s", ErrNoSuchBucket, name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db := c.databases[MAIN_DATABASE]
+	suffix := KV_BUCKET_SUFFIX + strings.ToLower(name)
+	kv, open := db.sidecars[suffix]
+	if open && kv.inSnapshot() {
+		return fmt.Errorf("bucket %s is %w", name, ErrInUseBySnapshot)
+	}
+	if open {
+		delete(db.sidecars, suffix)
+		if err := kv.close(); err != nil {
+			return err
+		}
+	}
+	if db.filename == "" {
+		if !open {
+			return fmt.Errorf("%w: %s", ErrNoSuchBucket, name)
+		}
+		return nil
+	}
+	err := os.Remove(sidecarFilename(db.filename, suffix))
+	if errors.Is(err, os.ErrNotExist) && !open {
+		return fmt.Errorf("%w: %s", ErrNoSuchBucket, name)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ioError(err)
+	}
+	return nil
+}
+
+// Range 按键的字典序把 start <= key < end 的键和值交给handle，end为nil时直到最后一个键。
+// 遍历的是开始时这张表的快照，之后的写入和删除不影响结果
+func (kv *KVTable) Range(start, end []byte, handle func(key, value []byte) error) error {
+	kv.mu.Lock()
+	s := kv.openSnapshot()
+	kv.mu.Unlock()
+	defer kv.releaseSnapshot(s)
+
+	snap := &Snapshot{kv: map[*KVTable]*kvSnapshot{kv: s}}
+	return snap.Range(kv, start, end, handle)
+}
+
+func metaKV(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	name := ""
+	if len(args) >= 2 && args[0] == "--bucket" {
+		name, args = args[1], args[2:]
+	}
+	if len(args) == 0 {
+		return findMetaCommand(".kv").usage()
+	}
+	switch {
+	case args[0] == "buckets" && len(args) == 1 && name == "":
+		buckets, err := c.buckets()
+		if err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			return META_COMMAND_FAILED
+		}
+		for _, b := range buckets {
+			fmt.Println(b)
+		}
+		return META_COMMAND_SUCCESS
+	case args[0] == "drop" && len(args) == 2 && name == "":
+		if err := c.dropBucket(args[1]); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			return META_COMMAND_FAILED
+		}
+		return META_COMMAND_SUCCESS
+	case args[0] == "get" && len(args) == 2,
+		args[0] == "put" && len(args) == 3,
+		args[0] == "delete" && len(args) == 2,
+		args[0] == "scan" && len(args) <= 3:
+	default:
+		return findMetaCommand(".kv").usage()
+	}
+	kv, err := c.bucket(name)
+	if err == nil {
+		err = runKVCommand(kv, args, opts)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func runKVCommand(kv *KVTable, args []string, opts *ShellOptions) error {
+	switch args[0] {
+	case "put":
+		return kv.Put([]byte(args[1]), []byte(args[2]))
+	case "delete":
+		_, err := kv.Delete([]byte(args[1]))
+		return err
+	}
+
+	out := newResultWriter(opts.writer(), opts.output, []string{"key", "value"})
+	if args[0] == "get" {
+		value, ok, err := kv.Get([]byte(args[1]))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNoSuchKey, args[1])
+		}
+		if err := out.writeRow([]any{args[1], string(value)}); err != nil {
+			return err
+		}
+		return out.finish()
+	}
+
+	var start, end []byte
+	if len(args) > 1 {
+		start = []byte(args[1])
+	}
+	if len(args) > 2 {
+		end = []byte(args[2])
+	}
+	err := kv.Range(start, end, func(key, value []byte) error {
+		return out.writeRow([]any{string(key), string(value)})
+	})
+	if err != nil {
+		return err
+	}
+	return out.finish()
+}
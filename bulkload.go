@@ -0,0 +1,47 @@
+package main
+
+import "fmt"
+
+// pragma bulk_load 打开后插入的行不维护全文索引，也不检查check_email。
+// 关闭时一次性检查这些行并重建索引；有行不满足约束时删除打开之后插入的所有行，
+// 表回到打开bulk_load之前的状态
+func (t *Table) beginBulkLoad() {
+	if !t.bulkLoad {
+		t.bulkLoad = true
+		t.bulkStart = t.numRows
+	}
+}
+
+func (t *Table) endBulkLoad() error {
+	if !t.bulkLoad {
+		return nil
+	}
+	t.bulkLoad = false
+	if t.checkEmail {
+		var row Row
+		for rowNum := t.bulkStart; rowNum < t.numRows; rowNum++ {
+			rowSlot, err := t.rowSlot(rowNum)
+			if err != nil {
+				return err
+			}
+			deserializeRow(rowSlot, &row)
+			if err := checkEmail(row.email()); err != nil {
+				loaded := t.numRows - t.bulkStart
+				t.rewind(t.bulkStart)
+				return fmt.Errorf("%w in row %d; removed the %d rows loaded with bulk_load", err, rowNum+1, loaded)
+			}
+		}
+	}
+	return t.reindex("")
+}
+
+// 结束所有表的批量导入，返回第一个错误
+func (c *Catalog) endBulkLoad() error {
+	var firstErr error
+	for _, db := range c.sortedDatabases() {
+		if err := db.table.endBulkLoad(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s.%s: %w", db.name, USERS_TABLE, err)
+		}
+	}
+	return firstErr
+}
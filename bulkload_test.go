@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBulkLoadDefersIndexing(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "create fulltext index on users(username)")
+	execTest(t, s, "pragma bulk_load = on")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	if got := execTest(t, s, "select * from users where username match alice"); len(got) != 0 {
+		t.Errorf("row indexed during bulk load: %v", got)
+	}
+	execTest(t, s, "pragma bulk_load = off")
+	if got := execTest(t, s, "select * from users where username match alice"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("match after bulk load returned %v, want [1]", got)
+	}
+}
+
+func TestBulkLoadRemovesRowsOnInvalidEmail(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "pragma check_email = on")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "pragma bulk_load = on")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	execTest(t, s, "insert 3 carol not-an-email")
+	if err := execTestErr(t, s, "pragma bulk_load = off"); !errors.Is(err, ErrConstraint) {
+		t.Errorf("ending bulk load: got %v, want ErrConstraint", err)
+	}
+	// 打开bulk_load之后插入的行全部删除
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("table after failed bulk load has ids %v, want [1]", got)
+	}
+}
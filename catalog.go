@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	MAIN_DATABASE = "main"
+	USERS_TABLE   = "users"
+)
+
+var (
+	ErrUnknownDatabase  = fmt.Errorf("no such database")
+	ErrUnknownTable     = fmt.Errorf("no such table")
+	ErrDatabaseAttached = fmt.Errorf("database is already attached")
+)
+
+// Database 对应一个数据库文件，目前每个文件只有一张users表，另外可以有物化视图
+type Database struct {
+	name     string
+	filename string
+	table    *Table
+	sidecars map[string]*KVTable
+	views    map[string]*MaterializedView
+}
+
+// Catalog 管理当前会话中所有已附加的数据库，服务模式下被多个连接共享
+type Catalog struct {
+	mu        sync.RWMutex
+	databases map[string]*Database
+	pragmas   Pragmas
+	commits   GroupCommit
+	// commit_mode为async时在后台同步
+	asyncCommits AsyncCommit
+	locks        LockManager
+	resultCache  ResultCache
+	transactions TransactionRegistry
+	// 两阶段提交中准备好的事务，按事务id保存
+	prepared map[string]*PreparedTransaction
+	// 所有会话的临时表，修改pragma时一起应用
+	temp map[*Table]bool
+}
+
+func NewCatalog(filename string) (*Catalog, error) {
+	c := &Catalog{
+		databases: make(map[string]*Database),
+		pragmas:   defaultPragmas(),
+	}
+	if err := c.attach(filename, MAIN_DATABASE); err != nil {
+		return nil, err
+	}
+	if err := c.recoverPrepared(); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Catalog) attach(filename, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name = strings.ToLower(name)
+	if _, ok := c.databases[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDatabaseAttached, name)
+	}
+	if name == TEMP_DATABASE {
+		return fmt.Errorf("database name %s is reserved for temporary tables", name)
+	}
+
+	t, err := dbOpen(filename)
+	if err != nil {
+		return err
+	}
+	t.pager.cacheSize = c.pragmas.cacheSize
+	t.pager.synchronous = c.pragmas.synchronous
+	t.checkEmail = c.pragmas.checkEmail
+	t.setHistoryRetention(c.pragmas.historyRetention)
+	if c.pragmas.bulkLoad {
+		t.beginBulkLoad()
+	}
+	db := &Database{
+		name:     name,
+		filename: filename,
+		table:    t,
+	}
+	if err := c.loadViews(db); err != nil {
+		db.close()
+		return err
+	}
+	if err := t.setBloomFilter(c.pragmas.bloomFilter); err != nil {
+		db.close()
+		return err
+	}
+	c.databases[name] = db
+	return nil
+}
+
+func (c *Catalog) detach(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name = strings.ToLower(name)
+	if name == MAIN_DATABASE {
+		return fmt.Errorf("cannot detach database %s", name)
+	}
+	db, ok := c.databases[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownDatabase, name)
+	}
+	if db.inSnapshot() {
+		return fmt.Errorf("database %s is %w", name, ErrInUseBySnapshot)
+	}
+	delete(c.databases, name)
+	for _, t := range db.snapshotTables() {
+		c.asyncCommits.forget(t.pager)
+	}
+	return db.close()
+}
+
+// 解析表名，支持 users 和 aux.users 两种形式
+func (c *Catalog) resolve(qualified string) (*Table, error) {
+	dbName, tableName := MAIN_DATABASE, qualified
+	if i := strings.IndexByte(qualified, '.'); i >= 0 {
+		dbName, tableName = qualified[:i], qualified[i+1:]
+	}
+	if tableName == "" {
+		tableName = USERS_TABLE
+	}
+
+	db, ok := c.databases[strings.ToLower(dbName)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDatabase, dbName)
+	}
+	if strings.ToLower(tableName) != USERS_TABLE {
+		if view, ok := db.views[strings.ToLower(tableName)]; ok {
+			return view.table, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTable, qualified)
+	}
+	return db.table, nil
+}
+
+// 所有数据库中的表和物化视图，main中的表不带数据库名
+func (c *Catalog) tables() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for _, db := range c.sortedDatabases() {
+		prefix := db.name + "."
+		if db.name == MAIN_DATABASE {
+			prefix = ""
+		}
+		names = append(names, prefix+USERS_TABLE)
+		for _, view := range slices.Sorted(maps.Keys(db.views)) {
+			names = append(names, prefix+view)
+		}
+	}
+	return names
+}
+
+// 每个数据库中的users表结构都相同
+var USERS_TABLE_SCHEMA = fmt.Sprintf("CREATE TABLE %s (id INTEGER, username VARCHAR(%d) COLLATE %s, email VARCHAR(%d) COLLATE %s);",
+	USERS_TABLE, COLUMN_USERNAME_SIZE, strings.ToUpper(COLUMN_COLLATIONS["username"]),
+	COLUMN_EMAIL_SIZE, strings.ToUpper(COLUMN_COLLATIONS["email"]))
+
+// 表的建表语句，name为空时返回所有表的建表语句
+func (c *Catalog) schema(name string) ([]string, error) {
+	if name == "" {
+		var schemas []string
+		for _, name := range c.tables() {
+			schemas = append(schemas, c.tableSchema(name))
+		}
+		return schemas, nil
+	}
+
+	c.mu.Lock()
+	_, err := c.resolve(name)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return []string{c.tableSchema(name)}, nil
+}
+
+// 附加数据库中的表带上数据库名
+func (c *Catalog) tableSchema(name string) string {
+	if query, ok := c.viewQuery(name); ok {
+		return fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS %s;", strings.ToLower(name), query)
+	}
+	dbName, _, ok := strings.Cut(name, ".")
+	if !ok || strings.EqualFold(dbName, MAIN_DATABASE) {
+		return USERS_TABLE_SCHEMA
+	}
+	return strings.Replace(USERS_TABLE_SCHEMA, USERS_TABLE, strings.ToLower(dbName)+"."+USERS_TABLE, 1)
+}
+
+// 物化视图的定义查询
+func (c *Catalog) viewQuery(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, view, err := c.viewDatabase(name)
+	if err != nil {
+		return "", false
+	}
+	v, ok := db.views[view]
+	if !ok {
+		return "", false
+	}
+	return v.query, true
+}
+
+// 获取数据库的键值表，首次使用时才打开
+func (c *Catalog) kvTable(name string) (*KVTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, ok := c.databases[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDatabase, name)
+	}
+	return db.kvTable()
+}
+
+// 账户保存在main数据库中
+func (c *Catalog) accounts() (*KVTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.databases[MAIN_DATABASE].accountsTable()
+}
+
+func (c *Catalog) grants() (*KVTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.databases[MAIN_DATABASE].grantsTable()
+}
+
+// 将表名规范化为 database.table 的形式
+func qualifyTableName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.Contains(name, ".") {
+		name = MAIN_DATABASE + "." + name
+	}
+	return name
+}
+
+type TableStats struct {
+	name        string
+	rows        uint32
+	usedPages   uint32
+	cachedPages int
+	fileSize    int64
+	// 没有打开布隆过滤器时为nil
+	bloom *BloomFilter
+}
+
+// 各数据库中表的统计信息，main在最前面
+func (c *Catalog) stats() ([]TableStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var stats []TableStats
+	for _, db := range c.sortedDatabases() {
+		size, err := db.table.pager.fileSize()
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, TableStats{
+			name:        db.name + "." + USERS_TABLE,
+			rows:        db.table.numRows,
+			usedPages:   (db.table.numRows + ROWS_PER_PAGE - 1) / ROWS_PER_PAGE,
+			cachedPages: db.table.pager.cachedPages(),
+			fileSize:    size,
+			bloom:       db.table.bloom,
+		})
+		for _, name := range slices.Sorted(maps.Keys(db.views)) {
+			t := db.views[name].table
+			size, err := t.pager.fileSize()
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, TableStats{
+				name:        db.name + "." + name,
+				rows:        t.numRows,
+				usedPages:   (t.numRows + ROWS_PER_PAGE - 1) / ROWS_PER_PAGE,
+				cachedPages: t.pager.cachedPages(),
+				fileSize:    size,
+				bloom:       t.bloom,
+			})
+		}
+	}
+	return stats, nil
+}
+
+func (c *Catalog) list() []*Database {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sortedDatabases()
+}
+
+func (c *Catalog) sortedDatabases() []*Database {
+	dbs := make([]*Database, 0, len(c.databases))
+	for _, db := range c.databases {
+		dbs = append(dbs, db)
+	}
+	// main始终排在最前面
+	sort.Slice(dbs, func(i, j int) bool {
+		if dbs[i].name == MAIN_DATABASE || dbs[j].name == MAIN_DATABASE {
+			return dbs[i].name == MAIN_DATABASE
+		}
+		return dbs[i].name < dbs[j].name
+	})
+	return dbs
+}
+
+func (c *Catalog) close() error {
+	c.asyncCommits.close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for _, db := range c.databases {
+		if err := db.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (db *Database) kvTable() (*KVTable, error) {
+	return db.sidecar(KV_FILE_SUFFIX)
+}
+
+func (db *Database) accountsTable() (*KVTable, error) {
+	return db.sidecar(AUTH_FILE_SUFFIX)
+}
+
+func (db *Database) grantsTable() (*KVTable, error) {
+	return db.sidecar(GRANTS_FILE_SUFFIX)
+}
+
+// 附属的键值表保存在数据库文件旁边，首次使用时才打开
+func (db *Database) sidecar(suffix string) (*KVTable, error) {
+	if kv, ok := db.sidecars[suffix]; ok {
+		return kv, nil
+	}
+	kv, err := kvOpen(sidecarFilename(db.filename, suffix))
+	if err != nil {
+		return nil, err
+	}
+	kv.pager.synchronous = db.table.pager.synchronous
+	if db.sidecars == nil {
+		db.sidecars = make(map[string]*KVTable)
+	}
+	db.sidecars[suffix] = kv
+	return kv, nil
+}
+
+func (db *Database) close() error {
+	err := db.table.close()
+	for _, view := range db.views {
+		if viewErr := view.table.close(); viewErr != nil && err == nil {
+			err = viewErr
+		}
+	}
+	for _, kv := range db.sidecars {
+		if kvErr := kv.close(); kvErr != nil && err == nil {
+			err = kvErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// 执行一条写语句，返回影响的行数
+func execTestCount(t *testing.T, s *Session, text string) int {
+	t.Helper()
+	stat := &Statement{}
+	if err := stat.prepareStatement(text); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	n, err := s.execute(stat, func(*Row) error { return nil })
+	if err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	return n
+}
+
+func TestAttachAndCopyAcrossDatabases(t *testing.T) {
+	c := openTestCatalog(t)
+	aux := filepath.Join(t.TempDir(), "aux.db")
+	if err := c.attach(aux, "aux"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.attach(aux, "AUX"); !errors.Is(err, ErrDatabaseAttached) {
+		t.Errorf("attaching aux twice: got %v, want ErrDatabaseAttached", err)
+	}
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert into aux.users 1 alice alice@example.com")
+	execTest(t, s, "insert into aux.users 2 bob bob@example.com")
+	if n := execTestCount(t, s, "insert into users select * from aux.users"); n != 2 {
+		t.Errorf("insert select copied %d rows, want 2", n)
+	}
+	if got := execTest(t, s, "select * from main.users"); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("main.users has ids %v, want [1 2]", got)
+	}
+
+	if err := c.detach(MAIN_DATABASE); err == nil {
+		t.Error("detaching main succeeded")
+	}
+	if err := c.detach("aux"); err != nil {
+		t.Fatal(err)
+	}
+	if err := execTestErr(t, s, "select * from aux.users"); !errors.Is(err, ErrUnknownDatabase) {
+		t.Errorf("select from detached database: got %v, want ErrUnknownDatabase", err)
+	}
+
+	// 重新附加后数据还在
+	if err := c.attach(aux, "aux"); err != nil {
+		t.Fatal(err)
+	}
+	if got := execTest(t, s, "select * from aux.users"); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("reattached aux.users has ids %v, want [1 2]", got)
+	}
+}
+
+func TestTableGrowsAcrossPages(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	numRows := 3*ROWS_PER_PAGE + 1
+	for i := 1; i <= numRows; i++ {
+		execTest(t, s, fmt.Sprintf("insert %d user%d user%d@example.com", i, i, i))
+	}
+	s.close()
+
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	got := execTest(t, s, "select")
+	if len(got) != numRows || got[0] != 1 || got[numRows-1] != uint32(numRows) {
+		t.Errorf("reopened table has %d rows, want %d", len(got), numRows)
+	}
+}
+
+func TestTruncateReportsRemovedRows(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	if n := execTestCount(t, s, "insert 1 alice alice@example.com"); n != 1 {
+		t.Errorf("insert affected %d rows, want 1", n)
+	}
+	execTest(t, s, "insert 2 bob bob@example.com")
+	if n := execTestCount(t, s, "truncate table users"); n != 2 {
+		t.Errorf("truncate removed %d rows, want 2", n)
+	}
+	if got := execTest(t, s, "select"); len(got) != 0 {
+		t.Errorf("truncated table has ids %v", got)
+	}
+	execTest(t, s, "insert 3 carol carol@example.com")
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{3}) {
+		t.Errorf("insert after truncate: ids %v, want [3]", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 内置的排序规则
+const (
+	COLLATION_BINARY = "binary"
+	COLLATION_NOCASE = "nocase"
+	COLLATION_RTRIM  = "rtrim"
+	COLLATION_NFC    = "nfc"
+)
+
+var (
+	ErrUnknownCollation = fmt.Errorf("no such collation")
+	ErrCollationExists  = fmt.Errorf("collation already exists")
+)
+
+// Collation 比较两个字符串，a小于、等于、大于b时分别返回负数、0、正数
+type Collation func(a, b string) int
+
+var collations = struct {
+	mu sync.RWMutex
+	m  map[string]Collation
+}{m: map[string]Collation{
+	COLLATION_BINARY: strings.Compare,
+	// 按Unicode简单大小写折叠比较
+	COLLATION_NOCASE: func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	},
+	// 忽略末尾的空格
+	COLLATION_RTRIM: func(a, b string) int {
+		return strings.Compare(strings.TrimRight(a, " "), strings.TrimRight(b, " "))
+	},
+	// 先转换为NFC再比较，组合字符和预组合字符视为相同，例如 "e\u0301" 和 "é"
+	COLLATION_NFC: func(a, b string) int {
+		return strings.Compare(norm.NFC.String(a), norm.NFC.String(b))
+	},
+}}
+
+// RegisterCollation 注册自定义的排序规则，名称不区分大小写
+func RegisterCollation(name string, cmp Collation) error {
+	collations.mu.Lock()
+	defer collations.mu.Unlock()
+
+	name = strings.ToLower(name)
+	if _, ok := collations.m[name]; ok {
+		return fmt.Errorf("%w: %s", ErrCollationExists, name)
+	}
+	collations.m[name] = cmp
+	return nil
+}
+
+func lookupCollation(name string) (Collation, bool) {
+	collations.mu.RLock()
+	defer collations.mu.RUnlock()
+
+	cmp, ok := collations.m[strings.ToLower(name)]
+	return cmp, ok
+}
+
+// 每列默认的排序规则，where中没有collate时使用
+var COLUMN_COLLATIONS = map[string]string{
+	"username": COLLATION_BINARY,
+	"email":    COLLATION_NOCASE,
+}
+
+// Condition 是 where COLUMN = VALUE [collate NAME] 或 where COLUMN match QUERY 条件
+type Condition struct {
+	Column    string
+	Value     string
+	Collation string
+	// 全文搜索，Value是查询
+	Match bool
+}
+
+// where COLUMN = VALUE [collate NAME] 或 where COLUMN match QUERY，parts从where开始
+func (stat *Statement) prepareWhere(parts []Token, offset int) error {
+	all := parts
+	parts = parts[offset:]
+	switch {
+	case len(parts) < 2:
+		return stat.syntaxError(all, offset+1, "")
+	case parts[1].Quoted:
+		return stat.syntaxError(all, offset+1, "no such column")
+	case len(parts) < 3 || !parts[2].is("=") && !parts[2].is("match"):
+		return stat.syntaxError(all, offset+2, "")
+	case len(parts) < 4:
+		return stat.syntaxError(all, offset+3, "")
+	}
+	column, ok := stat.columnRef(parts[1].Text)
+	if !ok {
+		return stat.syntaxError(all, offset+1, "no such column")
+	}
+	cond := &Condition{Column: column, Value: parts[3].Text}
+	if parts[2].is("match") {
+		switch {
+		case cond.Column == "id":
+			return stat.syntaxError(all, offset+1, "match applies only to text columns")
+		case len(parts) > 4:
+			return stat.syntaxError(all, offset+4, "")
+		}
+		cond.Match = true
+		stat.Where = cond
+		return nil
+	}
+	if cond.Column == "id" {
+		if _, err := strconv.ParseUint(cond.Value, 10, 32); err != nil {
+			return stat.syntaxError(all, offset+3, "invalid id")
+		}
+	} else {
+		cond.Collation = COLUMN_COLLATIONS[cond.Column]
+	}
+
+	if len(parts) > 4 {
+		if !parts[4].is("collate") {
+			return stat.syntaxError(all, offset+4, "")
+		}
+		if len(parts) != 6 {
+			return stat.syntaxError(all, min(len(all), offset+6), "")
+		}
+		if _, ok := lookupCollation(parts[5].Text); !ok {
+			return stat.syntaxError(all, offset+5, ErrUnknownCollation.Error())
+		}
+		if cond.Column == "id" {
+			return stat.syntaxError(all, offset+4, "collate applies only to text columns")
+		}
+		cond.Collation = strings.ToLower(parts[5].Text)
+	}
+	stat.Where = cond
+	return nil
+}
+
+// 只把满足条件的行交给handle，没有条件时原样返回
+func (cond *Condition) filter(handle RowHandler) RowHandler {
+	if cond == nil {
+		return handle
+	}
+	if cond.Column == "id" {
+		id, _ := strconv.ParseUint(cond.Value, 10, 32)
+		return func(row *Row) error {
+			if uint64(row.ID) != id {
+				return nil
+			}
+			return handle(row)
+		}
+	}
+	if cond.Match {
+		return func(row *Row) error {
+			if !fulltextMatch(columnText(row, cond.Column), cond.Value) {
+				return nil
+			}
+			return handle(row)
+		}
+	}
+	cmp, ok := lookupCollation(cond.Collation)
+	if !ok {
+		cmp = strings.Compare
+	}
+	return func(row *Row) error {
+		value := row.username()
+		if cond.Column == "email" {
+			value = row.email()
+		}
+		if cmp(value, cond.Value) != 0 {
+			return nil
+		}
+		return handle(row)
+	}
+}
+
+func (cond *Condition) String() string {
+	if cond.Match {
+		return fmt.Sprintf("%s match '%s'", cond.Column, strings.ReplaceAll(cond.Value, "'", "''"))
+	}
+	s := fmt.Sprintf("%s = '%s'", cond.Column, strings.ReplaceAll(cond.Value, "'", "''"))
+	if cond.Collation != "" {
+		s += " collate " + cond.Collation
+	}
+	return s
+}
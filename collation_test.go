@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWhereCollations(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert 1 Alice Alice@Example.com")
+	execTest(t, s, "insert 2 'bob  ' bob@example.com")
+	// 组合字符 e + U+0301，查询时用预组合的 é
+	execTest(t, s, "insert 3 'cafe\u0301' cafe@example.com")
+
+	for _, tc := range []struct {
+		where string
+		want  []uint32
+	}{
+		// email默认不区分大小写，username默认按字节比较
+		{"email = alice@example.com", []uint32{1}},
+		{"username = alice", nil},
+		{"username = alice collate NOCASE", []uint32{1}},
+		{"username = bob", nil},
+		{"username = bob collate rtrim", []uint32{2}},
+		{"username = 'caf\u00e9'", nil},
+		{"username = 'caf\u00e9' collate nfc", []uint32{3}},
+		{"id = 2", []uint32{2}},
+	} {
+		got := execTest(t, s, "select * from users where "+tc.where)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("where %s: ids %v, want %v", tc.where, got, tc.want)
+		}
+	}
+	if err := execTestErr(t, s, "select * from users where username = a collate klingon"); !errors.Is(err, ErrPrepareSyntax) {
+		t.Errorf("unknown collation: got %v, want a syntax error", err)
+	}
+}
+
+func TestRegisterCollation(t *testing.T) {
+	if err := RegisterCollation("NoCase", strings.Compare); !errors.Is(err, ErrCollationExists) {
+		t.Errorf("registering nocase again: got %v, want ErrCollationExists", err)
+	}
+	if err := RegisterCollation("test_reverse", func(a, b string) int { return strings.Compare(b, a) }); err != nil {
+		t.Fatal(err)
+	}
+	cmp, ok := lookupCollation("TEST_REVERSE")
+	if !ok || cmp("a", "b") <= 0 {
+		t.Error("registered collation is not used")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+var SQL_KEYWORDS = []string{
+	"alter", "analyze", "as", "begin", "by", "collate", "commit", "create",
+	"deallocate", "execute", "explain", "format", "from", "fulltext", "grant",
+	"increment", "index", "indexed", "insert", "into", "length", "lower", "match",
+	"materialized", "nextval", "not", "of", "on", "only", "password", "pragma",
+	"prepare", "prepared", "read", "refresh", "reindex", "revoke", "role",
+	"rollback", "select", "sequence", "start", "superuser", "table", "temp",
+	"temporary", "to", "transaction", "truncate", "upper", "user", "view", "where",
+	"with",
+}
+
+var COLUMN_NAMES = []string{"id", "username", "email"}
+
+// 根据光标前的内容补全当前单词，before是当前单词之前的输入
+func (c *Catalog) complete(before, word string) []string {
+	fields := strings.Fields(strings.ToLower(before))
+	var words []string
+	switch {
+	case len(fields) == 0 && strings.HasPrefix(word, "."):
+		words = metaCommandNames()
+	case len(fields) > 0 && strings.HasPrefix(fields[0], "."):
+		// 元命令的参数是文件名或数据库名，不补全
+	case len(fields) > 0 && slices.Contains([]string{"from", "into", "on"}, fields[len(fields)-1]):
+		// from、into和on之后只能是表名
+		words = c.tableNames()
+	case len(fields) == 1 && fields[0] == "pragma":
+		for _, p := range PRAGMAS {
+			words = append(words, p.name)
+		}
+	default:
+		words = slices.Concat(SQL_KEYWORDS, COLUMN_NAMES, c.tableNames())
+	}
+
+	// 输入大写时以大写补全
+	upper := word != "" && word == strings.ToUpper(word) && word != strings.ToLower(word)
+	var candidates []string
+	for _, w := range words {
+		if strings.HasPrefix(w, strings.ToLower(word)) {
+			if upper {
+				w = strings.ToUpper(w)
+			}
+			candidates = append(candidates, w)
+		}
+	}
+	slices.Sort(candidates)
+	return slices.Compact(candidates)
+}
+
+// 可以在语句中使用的表名，附加数据库的表需要带上数据库名
+func (c *Catalog) tableNames() []string {
+	var names []string
+	for _, db := range c.list() {
+		if db.name == MAIN_DATABASE {
+			names = append(names, USERS_TABLE)
+		}
+		names = append(names, db.name+"."+USERS_TABLE)
+	}
+	return names
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	c := openTestCatalog(t)
+	if err := c.attach(filepath.Join(t.TempDir(), "aux.db"), "aux"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		before, word string
+		want         []string
+	}{
+		{"", "se", []string{"select", "sequence"}},
+		{"", "SE", []string{"SELECT", "SEQUENCE"}},
+		{"select * ", "fr", []string{"from"}},
+		{"select * from ", "", []string{"aux.users", "main.users", "users"}},
+		{"insert into ", "a", []string{"aux.users"}},
+		{"pragma ", "max", []string{"max_result_rows"}},
+		{"", ".he", []string{".headers", ".help"}},
+		{".attach ", "fo", nil},
+		{"select ", "user", []string{"user", "username", "users"}},
+	} {
+		if got := c.complete(tc.before, tc.word); !slices.Equal(got, tc.want) {
+			t.Errorf("complete(%q, %q) = %q, want %q", tc.before, tc.word, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const CONFIG_FILE_NAME = ".golitedbrc"
+
+var ErrConfig = fmt.Errorf("invalid configuration")
+
+// 配置文件中可以设置的输出选项，值按对应的元命令解析
+var CONFIG_META_COMMANDS = map[string]string{
+	"mode":      ".mode",
+	"headers":   ".headers",
+	"timer":     ".timer",
+	"nullvalue": ".nullvalue",
+	"separator": ".separator",
+	"width":     ".width",
+}
+
+// 读取配置文件并应用到交互模式。每行一个 key = value，# 开头的行是注释：
+//
+//	mode = table
+//	headers = on
+//	history_file = ~/.golitedb_history
+//	history_size = 500
+//
+// filename为空时读取主目录下的.golitedbrc，文件不存在时不报错
+func (sh *Shell) loadConfig(filename string) error {
+	explicit := filename != ""
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		filename = filepath.Join(home, CONFIG_FILE_NAME)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	historyFile, historySize := sh.editor.historyFile, HISTORY_MAX_LINES
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%w: %s:%d: expected key = value", ErrConfig, filename, lineNum)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "history_file":
+			historyFile = expandHome(value)
+		case "history_size":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%w: %s:%d: history_size must be a non-negative number", ErrConfig, filename, lineNum)
+			}
+			historySize = n
+		default:
+			command, ok := CONFIG_META_COMMANDS[key]
+			if !ok {
+				return fmt.Errorf("%w: %s:%d: unknown setting %s", ErrConfig, filename, lineNum, key)
+			}
+			if doMetaCommand(command+" "+value, sh.catalog, &sh.opts) != META_COMMAND_SUCCESS {
+				return fmt.Errorf("%w: %s:%d: bad value for %s", ErrConfig, filename, lineNum, key)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	sh.editor.useHistory(historyFile, historySize)
+	return nil
+}
+
+// 把开头的~替换为主目录
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
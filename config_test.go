@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rc")
+	writeTestFile(t, filename, `# 输出设置
+mode = table
+Headers = on
+nullvalue = NULL
+width = 12
+history_size = 10
+`)
+	sh := &Shell{catalog: openTestCatalog(t), editor: &LineEditor{}}
+	if err := sh.loadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	want := OutputOptions{mode: OUTPUT_MODE_TABLE, headers: true, nullValue: "NULL", maxWidth: 12}
+	if sh.opts.output != want {
+		t.Errorf("output options %+v, want %+v", sh.opts.output, want)
+	}
+
+	for _, content := range []string{
+		"mode table\n",
+		"mode = xml\n",
+		"colour = on\n",
+		"history_size = -1\n",
+	} {
+		writeTestFile(t, filename, content)
+		if err := sh.loadConfig(filename); !errors.Is(err, ErrConfig) {
+			t.Errorf("%q: got %v, want ErrConfig", content, err)
+		}
+	}
+	if err := sh.loadConfig(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing explicit config file was accepted")
+	}
+}
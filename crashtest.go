@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 子进程最多插入的行数，数据库超过一半时清空重新开始
+const CRASHTEST_MAX_ROWS = 1200
+
+// golitedb crashtest [--iterations N] [--seed N] [--faults SPEC] FILENAME
+// 反复启动一个逐行插入并提交的子进程，在随机时刻杀死它，然后重新打开数据库检查：
+// 所有行都完整且按插入顺序排列，子进程确认提交过的行都还在。
+// 用 -tags faultinject 构建时每轮还会让子进程在随机的一次写页后崩溃，
+// --faults 追加其他故障，格式见faults.go
+func runCrashtest(args []string) error {
+	fs := flag.NewFlagSet("crashtest", flag.ContinueOnError)
+	iterations := fs.Int("iterations", 20, "number of times to kill and reopen the workload")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed for kill times and injected crashes")
+	faults := fs.String("faults", "", "extra faults for the workload, requires -tags faultinject")
+	worker := fs.Bool("worker", false, "run the workload instead of the harness")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: golitedb crashtest [--iterations N] [--seed N] [--faults SPEC] FILENAME")
+	}
+	filename := fs.Arg(0)
+	if *worker {
+		return crashtestWorkload(filename)
+	}
+	if *faults != "" && !FAULT_INJECTION {
+		return fmt.Errorf("--faults requires a binary built with -tags faultinject")
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return ioError(err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	fmt.Printf("crashtest seed %d\n", *seed)
+	for i := 1; i <= *iterations; i++ {
+		var spec []string
+		if FAULT_INJECTION {
+			spec = append(spec, fmt.Sprintf("crash_after_writes=%d", 1+rng.Intn(50)))
+		}
+		if *faults != "" {
+			spec = append(spec, *faults)
+		}
+		delay := time.Duration(rng.Intn(100)) * time.Millisecond
+		acknowledged, err := crashtestRun(self, filename, strings.Join(spec, ","), delay)
+		if err != nil {
+			return fmt.Errorf("iteration %d: %w", i, err)
+		}
+		rows, err := crashtestVerify(filename, acknowledged)
+		if err != nil {
+			return fmt.Errorf("iteration %d (seed %d): %w", i, *seed, err)
+		}
+		fmt.Printf("iteration %d: %d rows, %d acknowledged\n", i, rows, acknowledged)
+		// 子进程总有行可以插入
+		if rows > CRASHTEST_MAX_ROWS/2 {
+			if err := os.Truncate(filename, 0); err != nil {
+				return ioError(err)
+			}
+		}
+	}
+	fmt.Printf("crashtest passed %d iterations\n", *iterations)
+	return nil
+}
+
+// 启动子进程，delay之后杀死它，返回子进程确认提交的最大id
+func crashtestRun(self, filename, faults string, delay time.Duration) (uint32, error) {
+	cmd := exec.Command(self, "crashtest", "--worker", filename)
+	cmd.Env = append(os.Environ(), "GOLITEDB_FAULTS="+faults)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	timer := time.AfterFunc(delay, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+
+	var acknowledged uint32
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "committed "); ok {
+			n, _ := strconv.ParseUint(id, 10, 32)
+			acknowledged = uint32(n)
+		}
+	}
+	// 被杀死、模拟崩溃和注入的错误都是预期的结果
+	cmd.Wait()
+	return acknowledged, nil
+}
+
+// 检查数据库中的行是否为 1..N 的完整序列，并且不少于确认提交的行数
+func crashtestVerify(filename string, acknowledged uint32) (uint32, error) {
+	t, err := dbOpen(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer t.pager.close()
+
+	var row Row
+	for i := uint32(0); i < t.numRows; i++ {
+		rowSlot, err := t.rowSlot(i)
+		if err != nil {
+			return 0, err
+		}
+		deserializeRow(rowSlot, &row)
+		username, email := crashtestRow(i + 1)
+		if row.ID != i+1 || row.username() != username || row.email() != email {
+			return 0, fmt.Errorf("row %d is (%d, %s, %s), expected (%d, %s, %s)",
+				i+1, row.ID, row.username(), row.email(), i+1, username, email)
+		}
+	}
+	if t.numRows < acknowledged {
+		return 0, fmt.Errorf("%d rows after recovery but %d commits were acknowledged", t.numRows, acknowledged)
+	}
+	return t.numRows, nil
+}
+
+func crashtestRow(id uint32) (string, string) {
+	return fmt.Sprintf("user%d", id), fmt.Sprintf("user%d@example.com", id)
+}
+
+// 子进程：每次提交一行，提交成功后输出 "committed ID"
+func crashtestWorkload(filename string) error {
+	c, err := NewCatalog(filename)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	session := NewSession(c, "", "local")
+	execute := func(text string) error {
+		stat := &Statement{}
+		if err := stat.prepareStatement(text); err != nil {
+			return err
+		}
+		_, err := session.execute(stat, func(*Row) error { return nil })
+		return err
+	}
+	// 确认提交前必须已经写入文件
+	if err := execute("pragma synchronous = full"); err != nil {
+		return err
+	}
+	// 重新打开后从已有的行之后继续
+	for id := c.databases[MAIN_DATABASE].table.numRows + 1; id <= CRASHTEST_MAX_ROWS; id++ {
+		username, email := crashtestRow(id)
+		if err := execute(fmt.Sprintf("insert %d %s %s", id, username, email)); err != nil {
+			return err
+		}
+		fmt.Printf("committed %d\n", id)
+	}
+	return nil
+}
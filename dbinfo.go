@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DBInfoField 是 .dbinfo 输出的一行
+type DBInfoField struct {
+	label string
+	value string
+}
+
+// 数据库文件的格式信息。文件没有文件头，所有页都存放users表的行，
+// 没有B树、空闲页和溢出页，也没有schema cookie、WAL、加密和压缩
+func (c *Catalog) dbinfo(name string) ([]DBInfoField, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, ok := c.databases[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDatabase, name)
+	}
+	t := db.table
+	filename := db.filename
+	if filename == "" {
+		filename = ":memory:"
+	}
+	size, err := t.pager.fileSize()
+	if err != nil {
+		return nil, err
+	}
+	fullPages := size / PAGE_SIZE
+	partial := size % PAGE_SIZE
+	pages := fullPages
+	if partial > 0 {
+		pages++
+	}
+	info := []DBInfoField{
+		{"database", db.name},
+		{"file", filename},
+		{"page size", fmt.Sprintf("%d", PAGE_SIZE)},
+		{"row size", fmt.Sprintf("%d (%d rows per page)", ROW_SIZE, ROWS_PER_PAGE)},
+		{"file size", fmt.Sprintf("%d bytes", size)},
+		{"pages on disk", fmt.Sprintf("%d", pages)},
+		{"rows", fmt.Sprintf("%d (%d written to the file)", t.numRows, t.flushedRows)},
+		// 最后一页末尾不足一行的字节，通常是写入中断留下的
+		{"trailing bytes", fmt.Sprintf("%d", partial%ROW_SIZE)},
+		{"cached pages", fmt.Sprintf("%d", t.pager.cachedPages())},
+		{"synchronous", t.pager.synchronous},
+		{"header", "none"},
+		{"wal", "none"},
+		{"encryption", "off"},
+		{"compression", "off"},
+	}
+	if len(db.views) > 0 {
+		info = append(info, DBInfoField{"materialized views", fmt.Sprintf("%d", len(db.views))})
+	}
+	if db.filename != "" {
+		// 账户、权限、键值表和物化视图等保存在数据库文件旁边的文件中
+		matches, err := filepath.Glob(db.filename + "-*")
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(matches)
+		for _, m := range matches {
+			st, err := os.Stat(m)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, ioError(err)
+			}
+			info = append(info, DBInfoField{"sidecar " + strings.TrimPrefix(m, db.filename), fmt.Sprintf("%d bytes", st.Size())})
+		}
+	}
+	return info, nil
+}
+
+func metaDBInfo(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) > 1 {
+		return findMetaCommand(".dbinfo").usage()
+	}
+	name := MAIN_DATABASE
+	if len(args) == 1 {
+		name = args[0]
+	}
+	info, err := c.dbinfo(name)
+	if err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	width := 0
+	for _, f := range info {
+		width = max(width, len(f.label)+1)
+	}
+	for _, f := range info {
+		fmt.Printf("%-*s %s\n", width, f.label+":", f.value)
+	}
+	return META_COMMAND_SUCCESS
+}
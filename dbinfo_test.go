@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDBInfo(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "create user bob password secret")
+
+	info, err := c.dbinfo("MAIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for _, f := range info {
+		fields[f.label] = f.value
+	}
+	for label, want := range map[string]string{
+		"database":       "main",
+		"page size":      fmt.Sprint(PAGE_SIZE),
+		"trailing bytes": "0",
+		"header":         "none",
+	} {
+		if fields[label] != want {
+			t.Errorf("%s: %q, want %q", label, fields[label], want)
+		}
+	}
+	if !strings.HasPrefix(fields["rows"], "1 (") {
+		t.Errorf("rows %q, want 1", fields["rows"])
+	}
+	if !strings.HasSuffix(fields["file"], "test.db") {
+		t.Errorf("file %q", fields["file"])
+	}
+	sidecar := false
+	for label := range fields {
+		sidecar = sidecar || strings.HasPrefix(label, "sidecar -")
+	}
+	if !sidecar {
+		t.Errorf("no sidecar files listed: %v", fields)
+	}
+
+	if _, err := c.dbinfo("nosuch"); !errors.Is(err, ErrUnknownDatabase) {
+		t.Errorf("unknown database: got %v, want ErrUnknownDatabase", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务模式下 --admin 监听的排查接口：
+// /debug/pprof/ 是Go的性能分析，/debug/db 以JSON输出页缓存、进行中的事务和表锁。
+// /healthz 在进程运行时返回200，/readyz 在数据库打开、所有监听器就绪之后
+// 到开始关闭之前返回200，其他时候返回503。
+// 这些接口不做身份验证，只应监听在内部地址上
+func (s *Server) adminHandler() http.Handler {
+	c := s.catalog
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/db", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.debugState())
+	})
+	return mux
+}
+
+type DebugState struct {
+	BufferPool   []DebugTablePages  `json:"buffer_pool"`
+	Transactions []DebugTransaction `json:"transactions"`
+	Locks        []DebugLock        `json:"locks"`
+}
+
+// DebugTablePages 是一张表缓存的页，按最近使用的顺序排列，最后一个是最近使用的
+type DebugTablePages struct {
+	Table     string   `json:"table"`
+	CacheSize int      `json:"cache_size"`
+	Pages     []uint32 `json:"pages"`
+}
+
+type DebugTransaction struct {
+	Client  string    `json:"client"`
+	User    string    `json:"user,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+type DebugLockOwner struct {
+	Client string `json:"client"`
+	User   string `json:"user,omitempty"`
+	Mode   string `json:"mode"`
+}
+
+type DebugLock struct {
+	Table   string           `json:"table"`
+	Holders []DebugLockOwner `json:"holders"`
+	Waiting []DebugLockOwner `json:"waiting"`
+}
+
+func (c *Catalog) debugState() DebugState {
+	return DebugState{
+		BufferPool:   c.bufferPool(),
+		Transactions: c.transactions.list(),
+		Locks:        c.locks.list(),
+	}
+}
+
+func (c *Catalog) bufferPool() []DebugTablePages {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var pools []DebugTablePages
+	add := func(name string, t *Table) {
+		// 并发的查询在这把锁下加载和换出页
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		pools = append(pools, DebugTablePages{Table: name, CacheSize: t.pager.cacheSize, Pages: t.pager.recentPages()})
+	}
+	for _, db := range c.sortedDatabases() {
+		add(db.name+"."+USERS_TABLE, db.table)
+		for _, name := range slices.Sorted(maps.Keys(db.views)) {
+			add(db.name+"."+name, db.views[name].table)
+		}
+	}
+	return pools
+}
+
+// TransactionRegistry 记录所有会话中进行中的事务，只用于排查
+type TransactionRegistry struct {
+	mu      sync.Mutex
+	started map[*Session]time.Time
+}
+
+func (r *TransactionRegistry) add(s *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started == nil {
+		r.started = map[*Session]time.Time{}
+	}
+	r.started[s] = time.Now()
+}
+
+func (r *TransactionRegistry) remove(s *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.started, s)
+}
+
+// 事务按开始时间排序，最早的在前面
+func (r *TransactionRegistry) list() []DebugTransaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	txs := []DebugTransaction{}
+	for s, started := range r.started {
+		txs = append(txs, DebugTransaction{Client: s.client, User: s.user, Started: started})
+	}
+	slices.SortFunc(txs, func(a, b DebugTransaction) int {
+		return a.Started.Compare(b.Started)
+	})
+	return txs
+}
+
+func (lm *LockManager) list() []DebugLock {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	locks := []DebugLock{}
+	for _, table := range slices.Sorted(maps.Keys(lm.tables)) {
+		tl := lm.tables[table]
+		lock := DebugLock{Table: table, Holders: []DebugLockOwner{}, Waiting: []DebugLockOwner{}}
+		for holder, mode := range tl.holders {
+			lock.Holders = append(lock.Holders, DebugLockOwner{Client: holder.client, User: holder.user, Mode: mode.String()})
+		}
+		slices.SortFunc(lock.Holders, func(a, b DebugLockOwner) int {
+			return strings.Compare(a.Client, b.Client)
+		})
+		for _, req := range tl.queue {
+			lock.Waiting = append(lock.Waiting, DebugLockOwner{Client: req.owner.client, User: req.owner.user, Mode: req.mode.String()})
+		}
+		locks = append(locks, lock)
+	}
+	return locks
+}
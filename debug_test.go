@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 向排查接口发送GET请求，返回状态码和响应体
+func adminTest(s *Server, path string) (int, string) {
+	w := httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestAdminHealthAndReadiness(t *testing.T) {
+	s := newTestServer(t)
+	if code, _ := adminTest(s, "/healthz"); code != http.StatusOK {
+		t.Errorf("healthz: status %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := adminTest(s, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before start: status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	s.ready.Store(true)
+	if code, _ := adminTest(s, "/readyz"); code != http.StatusOK {
+		t.Errorf("readyz when ready: status %d, want %d", code, http.StatusOK)
+	}
+	s.ready.Store(false)
+	if code, _ := adminTest(s, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while shutting down: status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestDebugDBShowsTransactionsAndLocks(t *testing.T) {
+	s := newTestServer(t)
+	session := NewSession(s.catalog, "", "tx")
+	defer session.close()
+	execTest(t, session, "begin")
+	execTest(t, session, "insert 1 alice alice@example.com")
+
+	code, body := adminTest(s, "/debug/db")
+	if code != http.StatusOK {
+		t.Fatalf("debug/db: status %d %s", code, body)
+	}
+	var state DebugState
+	if err := json.Unmarshal([]byte(body), &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.BufferPool) != 1 || state.BufferPool[0].Table != "main.users" {
+		t.Errorf("buffer pool %+v, want main.users", state.BufferPool)
+	}
+	if len(state.Transactions) != 1 || state.Transactions[0].Client != "tx" {
+		t.Errorf("transactions %+v, want the one from tx", state.Transactions)
+	}
+	if len(state.Locks) != 1 || len(state.Locks[0].Holders) != 1 || state.Locks[0].Holders[0].Client != "tx" {
+		t.Errorf("locks %+v, want one held by tx", state.Locks)
+	}
+
+	execTest(t, session, "rollback")
+	if state := s.catalog.debugState(); len(state.Transactions) != 0 {
+		t.Errorf("transactions %+v after rollback", state.Transactions)
+	}
+}
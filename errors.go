@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrorCode 对错误分类，调用方可以用errors.As取出Error后按Code处理
+type ErrorCode int
+
+const (
+	ERROR_INTERNAL ErrorCode = iota
+	ERROR_SYNTAX
+	ERROR_UNRECOGNIZED
+	ERROR_DUPLICATE_KEY
+	ERROR_FULL
+	ERROR_CONSTRAINT
+	ERROR_IO
+)
+
+var errorCodeNames = [...]string{
+	ERROR_INTERNAL:      "INTERNAL",
+	ERROR_SYNTAX:        "SYNTAX",
+	ERROR_UNRECOGNIZED:  "UNRECOGNIZED",
+	ERROR_DUPLICATE_KEY: "DUPLICATE_KEY",
+	ERROR_FULL:          "FULL",
+	ERROR_CONSTRAINT:    "CONSTRAINT",
+	ERROR_IO:            "IO",
+}
+
+func (c ErrorCode) String() string {
+	if int(c) < len(errorCodeNames) {
+		return errorCodeNames[c]
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// Error 是引擎返回的错误。语法错误带有出错的单词和从1开始的字符位置，
+// Near为空而Pos不为0表示语句在结束前出错
+type Error struct {
+	Code ErrorCode
+	Msg  string
+	Near string
+	Pos  int
+	// 底层错误，例如文件读写错误
+	Err error
+}
+
+// 同一类错误的哨兵值，errors.Is按Code比较
+var (
+	ErrFull                = &Error{Code: ERROR_FULL, Msg: "database or disk is full"}
+	ErrPrepareSyntax       = &Error{Code: ERROR_SYNTAX, Msg: "syntax error in statement"}
+	ErrPrepareUnRecognized = &Error{Code: ERROR_UNRECOGNIZED, Msg: "unrecognized statement type"}
+	ErrDuplicateKey        = &Error{Code: ERROR_DUPLICATE_KEY, Msg: "duplicate key"}
+	ErrConstraint          = &Error{Code: ERROR_CONSTRAINT, Msg: "constraint violation"}
+)
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Err != nil {
+		if msg == "" {
+			msg = e.Err.Error()
+		} else {
+			msg += ": " + e.Err.Error()
+		}
+	}
+	switch {
+	case e.Near != "":
+		return fmt.Sprintf("%s near '%s' at position %d", msg, e.Near, e.Pos)
+	case e.Pos > 0:
+		return fmt.Sprintf("%s at end of input", msg)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// 语句在结束前出错，补充后续输入后可能可以解析
+func (e *Error) incomplete() bool {
+	return e.Code == ERROR_SYNTAX && e.Near == "" && e.Pos > 0
+}
+
+// 把文件读写错误包装为ERROR_IO，空间不足时为ERROR_FULL
+func ioError(err error) error {
+	if err == nil {
+		return nil
+	}
+	// 磁盘满、超出磁盘配额或文件大小限制时表不能再增长
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) || errors.Is(err, syscall.EFBIG) {
+		return &Error{Code: ERROR_FULL, Msg: ErrFull.Msg, Err: err}
+	}
+	return &Error{Code: ERROR_IO, Err: err}
+}
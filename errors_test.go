@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	stat := &Statement{}
+	err := stat.prepareStatement("insert x alice alice@example.com")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("got %v, want *Error", err)
+	}
+	if e.Code != ERROR_SYNTAX || e.Near != "x" || e.Pos != 8 {
+		t.Errorf("got code %v near %q at %d, want SYNTAX near 'x' at 8", e.Code, e.Near, e.Pos)
+	}
+	if !errors.Is(err, ErrPrepareSyntax) {
+		t.Error("syntax error does not match ErrPrepareSyntax")
+	}
+
+	// 语句在结束前出错，交互模式继续读取下一行
+	err = stat.prepareStatement("insert 1 alice")
+	if !errors.As(err, &e) || !e.incomplete() {
+		t.Errorf("truncated insert: got %v, want an incomplete statement", err)
+	}
+	if statementComplete("insert 1 alice") || !statementComplete("insert 1 alice alice@example.com") {
+		t.Error("statementComplete does not follow the parser")
+	}
+}
+
+func TestUnrecognizedStatement(t *testing.T) {
+	stat := &Statement{}
+	if err := stat.prepareStatement("upsert 1"); !errors.Is(err, ErrPrepareUnRecognized) {
+		t.Errorf("got %v, want ErrPrepareUnRecognized", err)
+	}
+	// 关键字不区分大小写
+	if err := stat.prepareStatement("INSERT 1 Alice alice@example.com"); err != nil {
+		t.Errorf("upper case insert: %v", err)
+	}
+}
+
+func TestIOErrorDiskFull(t *testing.T) {
+	full := ioError(&os.PathError{Op: "write", Path: "test.db", Err: syscall.ENOSPC})
+	if !errors.Is(full, ErrFull) || !errors.Is(full, syscall.ENOSPC) {
+		t.Errorf("ENOSPC: got %v, want ErrFull wrapping ENOSPC", full)
+	}
+	other := ioError(&os.PathError{Op: "write", Path: "test.db", Err: syscall.EIO})
+	var e *Error
+	if !errors.As(other, &e) || e.Code != ERROR_IO {
+		t.Errorf("EIO: got %v, want ERROR_IO", other)
+	}
+}
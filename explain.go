@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// explain 的输出格式
+const (
+	EXPLAIN_FORMAT_TEXT = "text"
+	EXPLAIN_FORMAT_JSON = "json"
+)
+
+// 没有analyze收集的直方图时等值条件的选择率
+const DEFAULT_EQUALITY_SELECTIVITY = 0.1
+
+// PlanNode 是执行计划中的一个算子，子节点为它读取的输入
+type PlanNode struct {
+	Operator      string      `json:"operator"`
+	Table         string      `json:"table,omitempty"`
+	Index         string      `json:"index,omitempty"`
+	Filter        string      `json:"filter,omitempty"`
+	EstimatedRows uint32      `json:"estimated_rows"`
+	ActualRows    *int        `json:"actual_rows,omitempty"`
+	Children      []*PlanNode `json:"children,omitempty"`
+}
+
+// explain [(format text|json[, analyze])] [analyze] STATEMENT
+func (stat *Statement) prepareExplain(input string, parts []Token) error {
+	format, analyze := EXPLAIN_FORMAT_TEXT, false
+	next := 1
+	if next < len(parts) && strings.HasPrefix(parts[next].Text, "(") && !parts[next].Quoted {
+		var options []string
+		for ; next < len(parts); next++ {
+			options = append(options, parts[next].Text)
+			if strings.HasSuffix(parts[next].Text, ")") {
+				break
+			}
+		}
+		if next == len(parts) {
+			return stat.syntaxError(parts, next, "")
+		}
+		list := strings.TrimSuffix(strings.TrimPrefix(strings.Join(options, " "), "("), ")")
+		for _, option := range strings.Split(list, ",") {
+			switch fields := strings.Fields(strings.ToLower(option)); {
+			case len(fields) == 2 && fields[0] == "format" && (fields[1] == EXPLAIN_FORMAT_TEXT || fields[1] == EXPLAIN_FORMAT_JSON):
+				format = fields[1]
+			case len(fields) == 1 && fields[0] == "analyze":
+				analyze = true
+			default:
+				return stat.syntaxError(parts, 1, "unknown explain option")
+			}
+		}
+		next++
+	}
+	if next < len(parts) && parts[next].is("analyze") {
+		analyze = true
+		next++
+	}
+	if next >= len(parts) {
+		return stat.syntaxError(parts, next, "")
+	}
+	explained := &Statement{}
+	if err := explained.prepareStatement(input[parts[next].Pos:]); err != nil {
+		// 错误位置相对于整条语句
+		var e *Error
+		if errors.As(err, &e) && e.Pos > 0 {
+			e.Pos += utf8.RuneCountInString(input[:parts[next].Pos])
+		}
+		return err
+	}
+	if analyze && explained.Typ != StatementTypeSelect {
+		return stat.syntaxError(parts, next, "explain analyze only supports select")
+	}
+	stat.Typ = StatementTypeExplain
+	stat.Prepared = explained
+	stat.Value = format
+	stat.Analyze = analyze
+	return nil
+}
+
+// 生成语句的执行计划，估计的行数来自表当前的行数和analyze收集的直方图
+func (c *Catalog) plan(stat *Statement) (*PlanNode, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	scan := func(name string) (*PlanNode, *Table, error) {
+		t, err := stat.table(name, c.resolve)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &PlanNode{Operator: "Seq Scan", Table: qualifyTableName(name), EstimatedRows: t.numRows}, t, nil
+	}
+	switch stat.Typ {
+	case StatementTypeSelect:
+		node, t, err := scan(stat.TableName)
+		if err != nil || stat.Where == nil {
+			return node, err
+		}
+		if stat.Where.Match && !stat.NotIndexed {
+			idx, ok := t.fulltext[stat.Where.Column]
+			if !ok {
+				return nil, fmt.Errorf("%w on %s", ErrNoFulltextIndex, stat.Where.Column)
+			}
+			node.Operator = "Fulltext Search"
+			node.Index = fmt.Sprintf("fulltext(%s)", stat.Where.Column)
+			node.Filter = stat.Where.String()
+			node.EstimatedRows = uint32(len(idx.search(stat.Where.Value, t.numRows)))
+			return node, nil
+		}
+		return &PlanNode{
+			Operator:      "Filter",
+			Filter:        stat.Where.String(),
+			EstimatedRows: t.estimateRows(stat.Where),
+			Children:      []*PlanNode{node},
+		}, nil
+	case StatementTypeInsert:
+		if _, err := stat.table(stat.TableName, c.resolve); err != nil {
+			return nil, err
+		}
+		return &PlanNode{Operator: "Insert", Table: qualifyTableName(stat.TableName), EstimatedRows: 1}, nil
+	case StatementTypeInsertSelect:
+		if _, err := stat.table(stat.TableName, c.resolve); err != nil {
+			return nil, err
+		}
+		source, _, err := scan(stat.SourceTable)
+		if err != nil {
+			return nil, err
+		}
+		return &PlanNode{Operator: "Insert", Table: qualifyTableName(stat.TableName),
+			EstimatedRows: source.EstimatedRows, Children: []*PlanNode{source}}, nil
+	case StatementTypeTruncate:
+		node, _, err := scan(stat.TableName)
+		if err != nil {
+			return nil, err
+		}
+		node.Operator = "Truncate"
+		return node, nil
+	}
+	return &PlanNode{Operator: stat.Typ.String()}, nil
+}
+
+// 输出计划，text格式每个算子一行，子节点缩进
+func (node *PlanNode) format(format string) (string, error) {
+	if format == EXPLAIN_FORMAT_JSON {
+		b, err := json.MarshalIndent(node, "", "  ")
+		return string(b), err
+	}
+	var b strings.Builder
+	node.writeText(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func (node *PlanNode) writeText(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(node.Operator)
+	if node.Table != "" {
+		b.WriteString(" " + node.Table)
+	}
+	if node.Index != "" {
+		b.WriteString(" using " + node.Index)
+	}
+	if node.Filter != "" {
+		b.WriteString(" where " + node.Filter)
+	}
+	fmt.Fprintf(b, " (estimated rows %d", node.EstimatedRows)
+	if node.ActualRows != nil {
+		fmt.Fprintf(b, ", actual rows %d", *node.ActualRows)
+	}
+	b.WriteString(")\n")
+	for _, child := range node.Children {
+		child.writeText(b, depth+1)
+	}
+}
+
+// 生成计划，analyze时执行查询并记录实际返回的行数
+func (s *Session) explain(stat *Statement) error {
+	node, err := s.catalog.plan(stat.Prepared)
+	if err != nil {
+		return err
+	}
+	if stat.Analyze {
+		run := *stat.Prepared
+		run.Ctx = stat.Ctx
+		rows := 0
+		if _, err := s.execute(&run, func(*Row) error {
+			rows++
+			return nil
+		}); err != nil {
+			return err
+		}
+		node.ActualRows = &rows
+	}
+	stat.Result, err = node.format(stat.Value)
+	return err
+}
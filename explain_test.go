@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExplainEstimatesFromHistogram(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	for i := 1; i <= 10; i++ {
+		name := "alice"
+		if i > 8 {
+			name = "bob"
+		}
+		execTest(t, s, fmt.Sprintf("insert %d %s %s%d@example.com", i, name, name, i))
+	}
+	// 没有直方图时按固定的选择率估计
+	want := "Filter where username = 'alice' collate binary (estimated rows 1)\n  Seq Scan main.users (estimated rows 10)"
+	if got := pragmaTest(t, s, "explain select * from users where username = alice"); got != want {
+		t.Errorf("explain before analyze:\n%s\nwant:\n%s", got, want)
+	}
+	execTest(t, s, "analyze users")
+	want = "Filter where username = 'alice' collate binary (estimated rows 8)\n  Seq Scan main.users (estimated rows 10)"
+	if got := pragmaTest(t, s, "explain select * from users where username = alice"); got != want {
+		t.Errorf("explain after analyze:\n%s\nwant:\n%s", got, want)
+	}
+	if got := pragmaTest(t, s, "explain select * from users where username = carol"); got != "Filter where username = 'carol' collate binary (estimated rows 0)\n  Seq Scan main.users (estimated rows 10)" {
+		t.Errorf("explain of an absent value:\n%s", got)
+	}
+}
+
+func TestExplainJSONAnalyze(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	var plan PlanNode
+	if err := json.Unmarshal([]byte(pragmaTest(t, s, "explain (format json, analyze) select * from users where id = 2")), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Operator != "Filter" || plan.ActualRows == nil || *plan.ActualRows != 1 {
+		t.Errorf("plan %+v, want a Filter with 1 actual row", plan)
+	}
+	if len(plan.Children) != 1 || plan.Children[0].Operator != "Seq Scan" || plan.Children[0].EstimatedRows != 2 {
+		t.Errorf("plan children %+v, want a Seq Scan of 2 rows", plan.Children)
+	}
+
+	if err := execTestErr(t, s, "explain analyze insert 3 carol carol@example.com"); !errors.Is(err, ErrPrepareSyntax) {
+		t.Errorf("explain analyze insert: got %v, want a syntax error", err)
+	}
+	// explain 不执行语句
+	pragmaTest(t, s, "explain insert 3 carol carol@example.com")
+	if got := execTest(t, s, "select"); len(got) != 2 {
+		t.Errorf("explain inserted a row: %v", got)
+	}
+}
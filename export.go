@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// .export 和 .import 支持的文件格式，第一个为默认格式
+var (
+	EXPORT_FORMATS = []string{"arrow", "parquet"}
+	IMPORT_FORMATS = []string{"parquet"}
+)
+
+// 把查询结果按format写入文件，失败时删除写了一半的文件
+func exportFile(c *Catalog, format, filename, query string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	var rows int
+	switch format {
+	case "arrow":
+		rows, err = c.exportArrow(f, query)
+	case "parquet":
+		rows, err = c.exportParquet(f, query)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+	fmt.Printf("exported %d rows to %s\n", rows, filename)
+	return nil
+}
+
+// 把文件中的行导入表，mappings为 COLUMN=SOURCE 形式的列映射
+func importFile(c *Catalog, format, filename, table string, mappings []string) error {
+	mapping := map[string]string{}
+	for _, m := range mappings {
+		column, source, ok := strings.Cut(m, "=")
+		if !ok || column == "" || source == "" {
+			return fmt.Errorf("invalid column mapping '%s', expected COLUMN=SOURCE", m)
+		}
+		mapping[strings.ToLower(column)] = source
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var rows int
+	switch format {
+	case "parquet":
+		rows, err = c.importParquet(data, table, mapping)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d rows into %s\n", rows, table)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	src := openTestCatalog(t)
+	s := NewSession(src, "", "test")
+	defer s.close()
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	execTest(t, s, "insert 3 carol carol@example.com")
+
+	var buf bytes.Buffer
+	n, err := src.exportParquet(&buf, "select * from users where email = BOB@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("exported %d rows, want 1", n)
+	}
+	buf.Reset()
+	if _, err := src.exportParquet(&buf, "select"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := openTestCatalog(t)
+	if n, err := dst.importParquet(buf.Bytes(), USERS_TABLE, nil); err != nil || n != 3 {
+		t.Fatalf("import = %d, %v, want 3 rows", n, err)
+	}
+	// 用户名列从文件的email列导入
+	if err := dst.attach(filepath.Join(t.TempDir(), "aux.db"), "aux"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.importParquet(buf.Bytes(), "aux.users", map[string]string{"username": "EMAIL"}); err != nil {
+		t.Fatal(err)
+	}
+	d := NewSession(dst, "", "test")
+	defer d.close()
+	if got := execTest(t, d, "select"); !slices.Equal(got, []uint32{1, 2, 3}) {
+		t.Errorf("imported ids %v, want [1 2 3]", got)
+	}
+	if got := execTest(t, d, "select * from aux.users where username = bob@example.com"); !slices.Equal(got, []uint32{2}) {
+		t.Errorf("mapped import: ids %v, want [2]", got)
+	}
+
+	if _, err := dst.importParquet([]byte("not a parquet file"), USERS_TABLE, nil); err == nil {
+		t.Error("importing garbage succeeded")
+	}
+	if _, err := src.exportParquet(&buf, "select id from users"); err == nil {
+		t.Error("exporting a projection succeeded")
+	}
+}
+
+func TestArrowExport(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "insert 1 alice alice@example.com")
+
+	var buf bytes.Buffer
+	n, err := c.exportArrow(&buf, "select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("exported %d rows, want 1", n)
+	}
+	// Arrow IPC文件以 ARROW1 开始和结束
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte(ARROW_MAGIC)) || !bytes.HasSuffix(data, []byte(ARROW_MAGIC)) {
+		t.Errorf("export is not framed by %q", ARROW_MAGIC)
+	}
+	if !bytes.Contains(data, []byte("alice@example.com")) {
+		t.Error("export does not contain the row")
+	}
+	if _, err := c.exportArrow(&buf, "insert 2 bob bob@example.com"); err == nil {
+		t.Error("exporting an insert succeeded")
+	}
+}
@@ -0,0 +1,80 @@
+//go:build faultinject
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 用 -tags faultinject 构建时，环境变量 GOLITEDB_FAULTS 向页的写入和同步注入故障，
+// 格式是逗号分隔的 NAME=N：
+//
+//	crash_after_writes=N  第N次写页之后直接退出进程，模拟崩溃
+//	short_write=N         第N次写页只写入一半并返回错误
+//	sync_error=N          第N次同步返回错误
+const FAULT_INJECTION = true
+
+// 模拟崩溃时进程的退出码
+const FAULT_CRASH_EXIT_CODE = 137
+
+var (
+	faultsOnce       sync.Once
+	faultCrashAfter  int64
+	faultShortWrite  int64
+	faultSyncError   int64
+	faultWrites      atomic.Int64
+	faultSyncs       atomic.Int64
+	ErrInjectedFault = fmt.Errorf("injected fault")
+)
+
+func loadFaults() {
+	spec := os.Getenv("GOLITEDB_FAULTS")
+	if spec == "" {
+		return
+	}
+	for _, item := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid GOLITEDB_FAULTS entry %q\n", item)
+			os.Exit(2)
+		}
+		switch name {
+		case "crash_after_writes":
+			faultCrashAfter = n
+		case "short_write":
+			faultShortWrite = n
+		case "sync_error":
+			faultSyncError = n
+		default:
+			fmt.Fprintf(os.Stderr, "unknown fault %q in GOLITEDB_FAULTS\n", name)
+			os.Exit(2)
+		}
+	}
+}
+
+// 返回实际要写入的数据，以及写入之后要返回的错误
+func faultWrite(data []byte) ([]byte, error) {
+	faultsOnce.Do(loadFaults)
+	n := faultWrites.Add(1)
+	if faultCrashAfter > 0 && n > faultCrashAfter {
+		os.Exit(FAULT_CRASH_EXIT_CODE)
+	}
+	if n == faultShortWrite {
+		return data[:len(data)/2], fmt.Errorf("%w: short write", ErrInjectedFault)
+	}
+	return data, nil
+}
+
+func faultSync() error {
+	faultsOnce.Do(loadFaults)
+	if faultSyncs.Add(1) == faultSyncError {
+		return fmt.Errorf("%w: sync failed", ErrInjectedFault)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrNoFulltextIndex     = fmt.Errorf("no fulltext index")
+	ErrFulltextIndexExists = fmt.Errorf("fulltext index already exists")
+)
+
+// FulltextIndex 是文本列的倒排索引，记录每个词出现在哪些行以及出现的次数。
+// 索引只保存在内存中，创建时扫描全表建立，之后随插入更新
+type FulltextIndex struct {
+	column   string
+	postings map[string]map[uint32]int
+}
+
+func newFulltextIndex(column string) *FulltextIndex {
+	return &FulltextIndex{column: column, postings: map[string]map[uint32]int{}}
+}
+
+// 按字母和数字以外的字符切分并转为小写
+func fulltextTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func columnText(row *Row, column string) string {
+	if column == "email" {
+		return row.email()
+	}
+	return row.username()
+}
+
+func (idx *FulltextIndex) add(rowNum uint32, row *Row) {
+	for _, term := range fulltextTerms(columnText(row, idx.column)) {
+		rows, ok := idx.postings[term]
+		if !ok {
+			rows = map[uint32]int{}
+			idx.postings[term] = rows
+		}
+		rows[rowNum]++
+	}
+}
+
+// 删除行号不小于numRows的行，用于回滚失败的提交
+func (idx *FulltextIndex) truncate(numRows uint32) {
+	for term, rows := range idx.postings {
+		for rowNum := range rows {
+			if rowNum >= numRows {
+				delete(rows, rowNum)
+			}
+		}
+		if len(rows) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+}
+
+// 返回包含查询中所有词的行号，按相关度从高到低排列。
+// 以*结尾的词按前缀匹配，相关度是每个词的词频乘以逆文档频率之和
+func (idx *FulltextIndex) search(query string, numRows uint32) []uint32 {
+	scores := map[uint32]float64{}
+	for i, term := range fulltextQuery(query) {
+		matched := map[uint32]float64{}
+		for _, t := range idx.expand(term) {
+			rows := idx.postings[t]
+			idf := math.Log(1 + float64(numRows)/float64(len(rows)))
+			for rowNum, tf := range rows {
+				matched[rowNum] += float64(tf) * idf
+			}
+		}
+		// 每个词都必须出现
+		for rowNum, score := range matched {
+			if i == 0 {
+				scores[rowNum] = score
+			} else if _, ok := scores[rowNum]; ok {
+				scores[rowNum] += score
+			}
+		}
+		for rowNum := range scores {
+			if _, ok := matched[rowNum]; !ok {
+				delete(scores, rowNum)
+			}
+		}
+	}
+
+	result := make([]uint32, 0, len(scores))
+	for rowNum := range scores {
+		result = append(result, rowNum)
+	}
+	slices.SortFunc(result, func(a, b uint32) int {
+		if scores[a] != scores[b] {
+			if scores[a] > scores[b] {
+				return -1
+			}
+			return 1
+		}
+		return int(a) - int(b)
+	})
+	return result
+}
+
+// 查询中的词，前缀查询保留末尾的*
+func fulltextQuery(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		prefix := strings.HasSuffix(field, "*")
+		words := fulltextTerms(field)
+		for i, w := range words {
+			if prefix && i == len(words)-1 {
+				w += "*"
+			}
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// 前缀查询展开为索引中所有以该前缀开头的词
+func (idx *FulltextIndex) expand(term string) []string {
+	prefix, ok := strings.CutSuffix(term, "*")
+	if !ok {
+		return []string{term}
+	}
+	var terms []string
+	for t := range idx.postings {
+		if strings.HasPrefix(t, prefix) {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// 不经过索引判断一行是否匹配，用于事务中尚未提交的行
+func fulltextMatch(text, query string) bool {
+	words := fulltextTerms(text)
+	for _, term := range fulltextQuery(query) {
+		prefix, ok := strings.CutSuffix(term, "*")
+		found := slices.ContainsFunc(words, func(w string) bool {
+			return w == term || ok && strings.HasPrefix(w, prefix)
+		})
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// create fulltext index on TABLE(COLUMN)，表名和括号之间可以有空格
+func (stat *Statement) prepareCreateFulltextIndex(parts []Token) error {
+	switch {
+	case len(parts) < 3 || !parts[2].is("index"):
+		return stat.syntaxError(parts, 2, "")
+	case len(parts) < 4 || !parts[3].is("on"):
+		return stat.syntaxError(parts, 3, "")
+	case len(parts) < 5:
+		return stat.syntaxError(parts, 4, "")
+	}
+	var target strings.Builder
+	for _, p := range parts[4:] {
+		target.WriteString(p.Text)
+	}
+	table, column, ok := strings.Cut(target.String(), "(")
+	column, closed := strings.CutSuffix(column, ")")
+	if !ok || !closed || table == "" {
+		return stat.syntaxError(parts, 4, "")
+	}
+	column = strings.ToLower(strings.TrimSpace(column))
+	if COLUMN_COLLATIONS[column] == "" {
+		return stat.syntaxError(parts, 4, "fulltext index requires a text column")
+	}
+	stat.Typ = StatementTypeCreateFulltextIndex
+	stat.TableName = table
+	stat.Column = column
+	return nil
+}
+
+// indexed by COLUMN | not indexed，从第i个单词到where之前。
+// 全文索引以列名称呼，indexed by 只能用于该列上的match条件
+func (stat *Statement) prepareIndexHint(parts []Token, i, where int) error {
+	if parts[i].is("not") {
+		switch {
+		case where < i+2 || !parts[i+1].is("indexed"):
+			return stat.syntaxError(parts, i+1, "")
+		case where != i+2:
+			return stat.syntaxError(parts, i+2, "")
+		}
+		stat.NotIndexed = true
+		return nil
+	}
+	switch {
+	case where < i+2 || !parts[i+1].is("by"):
+		return stat.syntaxError(parts, i+1, "")
+	case where < i+3:
+		return stat.syntaxError(parts, i+2, "")
+	case where != i+3:
+		return stat.syntaxError(parts, i+3, "")
+	}
+	column := strings.ToLower(parts[i+2].Text)
+	if COLUMN_COLLATIONS[column] == "" {
+		return stat.syntaxError(parts, i+2, "fulltext index requires a text column")
+	}
+	if stat.Where == nil || !stat.Where.Match || stat.Where.Column != column {
+		return stat.syntaxError(parts, i, fmt.Sprintf("fulltext index on %s cannot be used without a match on %s", column, column))
+	}
+	stat.IndexedBy = column
+	return nil
+}
+
+// 扫描全表建立索引，之后插入的行由insertRow加入索引
+func (t *Table) createFulltextIndex(column string) error {
+	if _, ok := t.fulltext[column]; ok {
+		return fmt.Errorf("%w on %s", ErrFulltextIndexExists, column)
+	}
+	return t.buildFulltextIndex(column)
+}
+
+// 扫描全表建立索引并替换已有的索引
+func (t *Table) buildFulltextIndex(column string) error {
+	idx := newFulltextIndex(column)
+	var rowNum uint32
+	err := t.executeSelect(func(row *Row) error {
+		idx.add(rowNum, row)
+		rowNum++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if t.fulltext == nil {
+		t.fulltext = map[string]*FulltextIndex{}
+	}
+	t.fulltext[column] = idx
+	return nil
+}
+
+// reindex [TABLE[(COLUMN)]]
+func (stat *Statement) prepareReindex(parts []Token) error {
+	stat.Typ = StatementTypeReindex
+	if len(parts) == 1 {
+		return nil
+	}
+	var target strings.Builder
+	for _, p := range parts[1:] {
+		target.WriteString(p.Text)
+	}
+	table, column, ok := strings.Cut(target.String(), "(")
+	if ok {
+		var closed bool
+		if column, closed = strings.CutSuffix(column, ")"); !closed || column == "" {
+			return stat.syntaxError(parts, 1, "")
+		}
+	} else if len(parts) > 2 {
+		return stat.syntaxError(parts, 2, "")
+	}
+	if table == "" {
+		return stat.syntaxError(parts, 1, "")
+	}
+	stat.TableName = table
+	stat.Column = strings.ToLower(strings.TrimSpace(column))
+	return nil
+}
+
+// 从表中重新建立全文索引，column为空时重建表上的所有索引
+func (t *Table) reindex(column string) error {
+	if column != "" {
+		if _, ok := t.fulltext[column]; !ok {
+			return fmt.Errorf("%w on %s", ErrNoFulltextIndex, column)
+		}
+		return t.buildFulltextIndex(column)
+	}
+	for column := range t.fulltext {
+		if err := t.buildFulltextIndex(column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindex不带表名时重建所有数据库中的索引
+func (c *Catalog) executeReindex(stat *Statement) error {
+	if stat.TableName != "" {
+		t, err := c.resolve(stat.TableName)
+		if err != nil {
+			return err
+		}
+		return t.reindex(stat.Column)
+	}
+	for _, db := range c.sortedDatabases() {
+		if err := db.table.reindex(""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 通过索引查找匹配的行，只读取命中的行，只查找前numRows行
+func (t *Table) executeMatch(cond *Condition, numRows uint32, handle RowHandler) error {
+	idx, ok := t.fulltext[cond.Column]
+	if !ok {
+		return fmt.Errorf("%w on %s", ErrNoFulltextIndex, cond.Column)
+	}
+	var row Row
+	for _, rowNum := range idx.search(cond.Value, numRows) {
+		// 索引包含快照之后插入的行
+		if rowNum >= numRows {
+			continue
+		}
+		rowSlot, err := t.rowSlot(rowNum)
+		if err != nil {
+			return err
+		}
+		deserializeRow(rowSlot, &row)
+		if err := handle(&row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 把表恢复到numRows行，同时从索引中删除之后的行
+func (t *Table) rewind(numRows uint32) {
+	t.numRows = numRows
+	t.flushedRows = min(t.flushedRows, numRows)
+	t.bulkStart = min(t.bulkStart, numRows)
+	t.version++
+	// 清空表时过滤器也可以清空，否则保留被删除的id
+	if t.bloom != nil && numRows == 0 {
+		t.bloom.reset()
+	}
+	if t.history != nil {
+		t.history.rewind(numRows)
+	}
+	for _, idx := range t.fulltext {
+		idx.truncate(numRows)
+	}
+}
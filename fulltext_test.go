@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTestCatalog(t *testing.T) *Catalog {
+	t.Helper()
+	c, err := NewCatalog(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.close() })
+	return c
+}
+
+// 执行一条语句，返回结果行的id
+func execTest(t *testing.T, s *Session, text string) []uint32 {
+	t.Helper()
+	stat := &Statement{}
+	if err := stat.prepareStatement(text); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	var ids []uint32
+	if _, err := s.execute(stat, func(row *Row) error {
+		ids = append(ids, row.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	return ids
+}
+
+// 执行一条预期失败的语句，返回错误
+func execTestErr(t *testing.T, s *Session, text string) error {
+	t.Helper()
+	stat := &Statement{}
+	if err := stat.prepareStatement(text); err != nil {
+		return err
+	}
+	_, err := s.execute(stat, func(*Row) error { return nil })
+	if err == nil {
+		t.Fatalf("%s: expected an error", text)
+	}
+	return err
+}
+
+func TestMatchAsOfSkipsLaterRows(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "pragma history_retention = 3600")
+	execTest(t, s, "create fulltext index on users(username)")
+	execTest(t, s, "insert 1 alice1 alice1@example.com")
+	// as of 只精确到秒，等到下一秒之后再插入
+	at := time.Now().Truncate(time.Second).Add(time.Second)
+	time.Sleep(time.Until(at) + 10*time.Millisecond)
+	execTest(t, s, "insert 2 alice2 alice2@example.com")
+
+	got := execTest(t, s, "select * from users as of '"+at.UTC().Format(time.RFC3339)+"' where username match 'alice*'")
+	if !slices.Equal(got, []uint32{1}) {
+		t.Errorf("as of match returned ids %v, want [1]", got)
+	}
+}
+
+func TestMatchInSnapshotSkipsLaterRows(t *testing.T) {
+	c := openTestCatalog(t)
+	reader := NewSession(c, "", "reader")
+	defer reader.close()
+	writer := NewSession(c, "", "writer")
+	defer writer.close()
+
+	execTest(t, writer, "create fulltext index on users(username)")
+	execTest(t, writer, "insert 1 alice1 alice1@example.com")
+	execTest(t, reader, "begin read only")
+	execTest(t, writer, "insert 2 alice2 alice2@example.com")
+
+	got := execTest(t, reader, "select * from users where username match 'alice*'")
+	if !slices.Equal(got, []uint32{1}) {
+		t.Errorf("snapshot match returned ids %v, want [1]", got)
+	}
+	execTest(t, reader, "commit")
+}
+
+func TestMatchRanksByRelevance(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "create fulltext index on users(username)")
+	execTest(t, s, "insert 1 'alice carol' a@example.com")
+	execTest(t, s, "insert 2 'Alice alice bob' b@example.com")
+	execTest(t, s, "insert 3 dave d@example.com")
+
+	for _, tc := range []struct {
+		query string
+		want  []uint32
+	}{
+		// 词频高的行在前
+		{"alice", []uint32{2, 1}},
+		{"alice bob", []uint32{2}},
+		{"car*", []uint32{1}},
+		{"eve", nil},
+	} {
+		got := execTest(t, s, "select * from users where username match '"+tc.query+"'")
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("match %q: ids %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestReindexAndIndexHints(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert 1 alice alice@example.com")
+	if err := execTestErr(t, s, "select * from users where username match alice"); !errors.Is(err, ErrNoFulltextIndex) {
+		t.Errorf("match without an index: got %v, want ErrNoFulltextIndex", err)
+	}
+	// not indexed 逐行比较，不需要索引
+	if got := execTest(t, s, "select * from users not indexed where username match alice"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("not indexed match returned %v, want [1]", got)
+	}
+	if err := execTestErr(t, s, "select * from users indexed by email where username match alice"); !errors.Is(err, ErrPrepareSyntax) {
+		t.Errorf("hint on another column: got %v, want a syntax error", err)
+	}
+
+	execTest(t, s, "create fulltext index on users (username)")
+	if err := execTestErr(t, s, "create fulltext index on users(username)"); !errors.Is(err, ErrFulltextIndexExists) {
+		t.Errorf("duplicate index: got %v, want ErrFulltextIndexExists", err)
+	}
+	if err := execTestErr(t, s, "reindex users(email)"); !errors.Is(err, ErrNoFulltextIndex) {
+		t.Errorf("reindex of a missing index: got %v, want ErrNoFulltextIndex", err)
+	}
+	execTest(t, s, "insert 2 alice alice2@example.com")
+	execTest(t, s, "reindex users(username)")
+	execTest(t, s, "reindex")
+	if got := execTest(t, s, "select * from users indexed by username where username match alice"); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("match after reindex returned %v, want [1 2]", got)
+	}
+}
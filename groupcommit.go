@@ -0,0 +1,202 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// commit_mode 为async时后台同步的间隔，崩溃时最多丢失这段时间内的提交
+const ASYNC_COMMIT_INTERVAL = 100 * time.Millisecond
+
+// GroupCommit 合并并发提交的fsync。第一个提交者负责同步，
+// 同步期间到达的提交排队，由它在下一轮一起同步，
+// 因此同时提交的N个事务只需要一两次fsync
+type GroupCommit struct {
+	mu      sync.Mutex
+	syncing bool
+	queue   []*syncRequest
+}
+
+type syncRequest struct {
+	pagers []*Pager
+	done   chan error
+}
+
+// 把pagers同步到磁盘，返回时数据已经持久化
+func (g *GroupCommit) sync(pagers []*Pager) error {
+	req := &syncRequest{pagers: pagers, done: make(chan error, 1)}
+
+	g.mu.Lock()
+	g.queue = append(g.queue, req)
+	if g.syncing {
+		g.mu.Unlock()
+		return <-req.done
+	}
+	g.syncing = true
+	for len(g.queue) > 0 {
+		batch := g.queue
+		g.queue = nil
+		g.mu.Unlock()
+		syncBatch(batch)
+		g.mu.Lock()
+	}
+	g.syncing = false
+	g.mu.Unlock()
+	return <-req.done
+}
+
+// 每个文件只同步一次，同一个文件的所有请求得到相同的结果
+func syncBatch(batch []*syncRequest) {
+	results := map[*Pager]error{}
+	for _, req := range batch {
+		for _, p := range req.pagers {
+			if _, ok := results[p]; !ok {
+				results[p] = p.sync()
+				metricCommitSyncs.Add(1)
+			}
+		}
+	}
+	for _, req := range batch {
+		var err error
+		for _, p := range req.pagers {
+			if err == nil {
+				err = results[p]
+			}
+		}
+		metricSyncedCommits.Add(1)
+		req.done <- err
+	}
+}
+
+// 把上次提交之后插入的行所在的页写回文件
+func (t *Table) flushNewRows() error {
+	if t.numRows > t.flushedRows {
+		for pageNum := t.flushedRows / ROWS_PER_PAGE; pageNum <= (t.numRows-1)/ROWS_PER_PAGE; pageNum++ {
+			if err := t.pager.flush(pageNum, t.pageBytes(pageNum)); err != nil {
+				return err
+			}
+		}
+	}
+	t.flushedRows = t.numRows
+	return nil
+}
+
+// synchronous为full时，提交返回前把写入的表持久化。
+// 写页在目录的锁内完成，fsync在锁外进行，以便并发的提交合并同步
+func (c *Catalog) makeDurable(tables []string) error {
+	c.mu.Lock()
+	if c.pragmas.synchronous != SYNCHRONOUS_FULL {
+		c.mu.Unlock()
+		return nil
+	}
+	var pagers []*Pager
+	for _, name := range tables {
+		t, err := c.resolve(name)
+		if err == nil {
+			err = t.flushNewRows()
+		}
+		if err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		if t.pager.file != nil {
+			pagers = append(pagers, t.pager)
+		}
+	}
+	async := c.pragmas.commitMode == COMMIT_MODE_ASYNC
+	c.mu.Unlock()
+
+	if len(pagers) == 0 {
+		return nil
+	}
+	if async {
+		c.asyncCommits.add(pagers)
+		return nil
+	}
+	return c.commits.sync(pagers)
+}
+
+// AsyncCommit 在后台定期同步异步提交写入的文件，提交不等待fsync
+type AsyncCommit struct {
+	mu      sync.Mutex
+	pending map[*Pager]bool
+	// 同步期间一直持有，forget等待正在进行的同步结束
+	syncing sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// 记录需要同步的文件，第一次调用时启动后台goroutine
+func (a *AsyncCommit) add(pagers []*Pager) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pending == nil {
+		a.pending = map[*Pager]bool{}
+	}
+	for _, p := range pagers {
+		a.pending[p] = true
+	}
+	metricSyncedCommits.Add(1)
+	if a.stop == nil {
+		a.stop, a.done = make(chan struct{}), make(chan struct{})
+		go a.run(a.stop, a.done)
+	}
+}
+
+func (a *AsyncCommit) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(ASYNC_COMMIT_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.syncPending()
+		case <-stop:
+			a.syncPending()
+			return
+		}
+	}
+}
+
+func (a *AsyncCommit) syncPending() {
+	a.syncing.Lock()
+	defer a.syncing.Unlock()
+
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	for p := range pending {
+		metricCommitSyncs.Add(1)
+		if err := p.sync(); err != nil {
+			slog.Error("asynchronous commit sync failed", "file", p.file.Name(), "error", err)
+		}
+	}
+}
+
+// 数据库分离前调用，关闭时由表自己同步。返回后后台不会再同步这个文件
+func (a *AsyncCommit) forget(p *Pager) {
+	a.syncing.Lock()
+	defer a.syncing.Unlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.pending, p)
+}
+
+// 停止后台goroutine并同步剩余的文件
+func (a *AsyncCommit) close() {
+	a.mu.Lock()
+	stop, done := a.stop, a.done
+	a.stop = nil
+	a.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAsyncCommitForgetDuringSync(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "pragma synchronous = full")
+	execTest(t, s, "pragma commit_mode = async")
+
+	// 同步失败只会记录日志
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	// 分离数据库与后台同步并发进行，分离后文件已经关闭，不能再被同步
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		filename := filepath.Join(dir, fmt.Sprintf("aux%d.db", i))
+		if err := c.attach(filename, "aux"); err != nil {
+			t.Fatal(err)
+		}
+		execTest(t, s, fmt.Sprintf("insert into aux.users %d user%d user%d@example.com", i+1, i, i))
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.asyncCommits.syncPending()
+		}()
+		if err := c.detach("aux"); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+	}
+	if logs.Len() > 0 {
+		t.Errorf("sync failed after detach: %s", logs.String())
+	}
+	c.asyncCommits.mu.Lock()
+	defer c.asyncCommits.mu.Unlock()
+	if len(c.asyncCommits.pending) != 0 {
+		t.Errorf("%d detached files still pending", len(c.asyncCommits.pending))
+	}
+}
+
+func TestAsyncCommitDurableAfterClose(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "pragma synchronous = full")
+	execTest(t, s, "pragma commit_mode = async")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	s.close()
+
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := execTest(t, s, "select"); len(got) != 1 {
+		t.Errorf("rows after reopen = %v, want [1]", got)
+	}
+}
+
+func TestSynchronousFullSyncsCommits(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	syncs := metricCommitSyncs.Value()
+	execTest(t, s, "insert 1 alice alice@example.com")
+	if metricCommitSyncs.Value() != syncs {
+		t.Error("commit under synchronous=normal called fsync")
+	}
+	execTest(t, s, "pragma synchronous = full")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	if metricCommitSyncs.Value() != syncs+1 {
+		t.Errorf("commit under synchronous=full made %d fsyncs, want 1", metricCommitSyncs.Value()-syncs)
+	}
+	// 只读语句不需要同步
+	execTest(t, s, "select")
+	if metricCommitSyncs.Value() != syncs+1 {
+		t.Error("select called fsync")
+	}
+}
+
+func TestGroupCommitSharesSyncs(t *testing.T) {
+	c := openTestCatalog(t)
+	users, err := c.resolve(USERS_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一批中的请求对每个文件只同步一次
+	batch := make([]*syncRequest, 3)
+	for i := range batch {
+		batch[i] = &syncRequest{pagers: []*Pager{users.pager}, done: make(chan error, 1)}
+	}
+	syncs := metricCommitSyncs.Value()
+	syncBatch(batch)
+	if got := metricCommitSyncs.Value() - syncs; got != 1 {
+		t.Errorf("batch of 3 commits made %d fsyncs, want 1", got)
+	}
+	for i, req := range batch {
+		if err := <-req.done; err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+
+	// 并发的提交都在同步后返回
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.commits.sync([]*Pager{users.pager})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoHistory      = fmt.Errorf("time travel requires pragma history_retention")
+	ErrHistoryExpired = fmt.Errorf("no history retained")
+)
+
+// 表只在末尾追加行，某一时刻的表就是当时已提交的前N行。
+// TableHistory 记录每次提交后的行数和提交时间，select ... as of 据此只读取前N行。
+// 历史只保存在内存中，从打开history_retention或清空表之后开始记录
+type TableHistory struct {
+	retention time.Duration
+	// 早于since的时刻没有记录
+	since   time.Time
+	entries []HistoryEntry
+}
+
+type HistoryEntry struct {
+	rows uint32
+	time time.Time
+}
+
+func newTableHistory(retention time.Duration, rows uint32) *TableHistory {
+	now := time.Now()
+	return &TableHistory{retention: retention, since: now, entries: []HistoryEntry{{rows, now}}}
+}
+
+// 提交后记录表的行数，并丢弃保留期之前的记录，只保留保留期开始时的那一条
+func (t *Table) recordHistory() {
+	h := t.history
+	if h == nil {
+		return
+	}
+	now := time.Now()
+	if last := h.entries[len(h.entries)-1]; last.rows != t.numRows {
+		h.entries = append(h.entries, HistoryEntry{t.numRows, now})
+	}
+	horizon := now.Add(-h.retention)
+	i := 0
+	for i+1 < len(h.entries) && !h.entries[i+1].time.After(horizon) {
+		i++
+	}
+	h.entries = h.entries[i:]
+}
+
+// 删除了已提交的行时，之前的历史不再能重现
+func (h *TableHistory) rewind(numRows uint32) {
+	if h.entries[len(h.entries)-1].rows <= numRows {
+		return
+	}
+	now := time.Now()
+	h.since = now
+	h.entries = []HistoryEntry{{numRows, now}}
+}
+
+// as of 'TIME'，从第i个单词到end之前，时间为RFC 3339格式
+func (stat *Statement) prepareAsOf(parts []Token, i, end int) error {
+	switch {
+	case end < i+2 || !parts[i+1].is("of"):
+		return stat.syntaxError(parts, i+1, "")
+	case end < i+3:
+		return stat.syntaxError(parts, i+2, "")
+	case end != i+3:
+		return stat.syntaxError(parts, i+3, "")
+	}
+	at, err := time.Parse(time.RFC3339, parts[i+2].Text)
+	if err != nil {
+		return stat.syntaxError(parts, i+2, "invalid time, expected RFC 3339 such as 2024-05-01T00:00:00Z")
+	}
+	stat.AsOf = at
+	return nil
+}
+
+// 在at时刻已经提交的行数
+func (t *Table) rowsAsOf(at time.Time) (uint32, error) {
+	h := t.history
+	if h == nil {
+		return 0, ErrNoHistory
+	}
+	horizon := time.Now().Add(-h.retention)
+	if h.since.After(horizon) {
+		horizon = h.since
+	}
+	if at.Before(horizon) {
+		return 0, fmt.Errorf("%w before %s", ErrHistoryExpired, horizon.UTC().Format(time.RFC3339))
+	}
+	rows := h.entries[0].rows
+	for _, e := range h.entries {
+		if e.time.After(at) {
+			break
+		}
+		rows = e.rows
+	}
+	return rows, nil
+}
+
+// pragma history_retention 打开、关闭或调整所有表的历史记录
+func (t *Table) setHistoryRetention(retention time.Duration) {
+	switch {
+	case retention == 0:
+		t.history = nil
+	case t.history == nil:
+		t.history = newTableHistory(retention, t.numRows)
+	default:
+		t.history.retention = retention
+	}
+}
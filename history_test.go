@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRowsAsOf(t *testing.T) {
+	now := time.Now()
+	tbl := &Table{numRows: 3, history: &TableHistory{
+		retention: time.Hour,
+		since:     now.Add(-30 * time.Minute),
+		entries: []HistoryEntry{
+			{0, now.Add(-30 * time.Minute)},
+			{2, now.Add(-20 * time.Minute)},
+			{3, now.Add(-10 * time.Minute)},
+		},
+	}}
+	for _, tc := range []struct {
+		ago  time.Duration
+		want uint32
+	}{
+		{25 * time.Minute, 0},
+		{20 * time.Minute, 2},
+		{15 * time.Minute, 2},
+		{0, 3},
+	} {
+		got, err := tbl.rowsAsOf(now.Add(-tc.ago))
+		if err != nil || got != tc.want {
+			t.Errorf("%v ago: got %d, %v, want %d", tc.ago, got, err, tc.want)
+		}
+	}
+	// 打开历史记录之前的时刻没有记录
+	if _, err := tbl.rowsAsOf(now.Add(-40 * time.Minute)); !errors.Is(err, ErrHistoryExpired) {
+		t.Errorf("before since: got %v, want ErrHistoryExpired", err)
+	}
+
+	// 删除已提交的行后历史重新开始
+	tbl.rewind(1)
+	if _, err := tbl.rowsAsOf(now.Add(-15 * time.Minute)); !errors.Is(err, ErrHistoryExpired) {
+		t.Errorf("after rewind: got %v, want ErrHistoryExpired", err)
+	}
+}
+
+func TestRecordHistoryDropsExpiredEntries(t *testing.T) {
+	now := time.Now()
+	tbl := &Table{numRows: 4, history: &TableHistory{
+		retention: time.Hour,
+		since:     now.Add(-3 * time.Hour),
+		entries: []HistoryEntry{
+			{1, now.Add(-3 * time.Hour)},
+			{2, now.Add(-2 * time.Hour)},
+			{3, now.Add(-30 * time.Minute)},
+		},
+	}}
+	tbl.recordHistory()
+	// 保留期开始时的那一条仍然需要，用来回答保留期内较早的时刻
+	entries := tbl.history.entries
+	if len(entries) != 3 || entries[0].rows != 2 || entries[2].rows != 4 {
+		t.Errorf("history entries %+v, want rows 2, 3, 4", entries)
+	}
+}
+
+func TestSelectAsOfRequiresHistory(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	if err := execTestErr(t, s, "select * from users as of '2024-05-01T00:00:00Z'"); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("as of without history: got %v, want ErrNoHistory", err)
+	}
+	if err := execTestErr(t, s, "select * from users as of yesterday"); !errors.Is(err, ErrPrepareSyntax) {
+		t.Errorf("invalid time: got %v, want a syntax error", err)
+	}
+	execTest(t, s, "pragma history_retention = 60")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	at := time.Now().UTC().Add(time.Second).Format(time.RFC3339)
+	if got := execTest(t, s, "select * from users as of '"+at+"'"); len(got) != 1 {
+		t.Errorf("as of now has ids %v, want [1]", got)
+	}
+}
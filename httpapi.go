@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	HTTP_MAX_BODY_SIZE   = 1 << 20
+	HTTP_DATABASE_HEADER = "X-Database"
+)
+
+type httpRequest struct {
+	SQL string `json:"sql"`
+}
+
+// 按列名保存的一行
+type httpRow map[string]any
+
+type httpQueryResponse struct {
+	Columns []string  `json:"columns"`
+	Rows    []httpRow `json:"rows"`
+}
+
+type httpExecResponse struct {
+	OK bool `json:"ok"`
+	// 插入或删除的行数
+	RowsAffected int `json:"rows_affected"`
+	// pragma的值
+	Result string `json:"result,omitempty"`
+}
+
+type httpErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+func (s *Server) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", s.handleHTTPQuery)
+	mux.HandleFunc("/exec", s.handleHTTPExec)
+	mux.HandleFunc("/batch", s.handleHTTPBatch)
+	return mux
+}
+
+// POST /query 只接受select，以JSON返回结果行
+func (s *Server) handleHTTPQuery(w http.ResponseWriter, r *http.Request) {
+	stat, c, user, ok := s.prepareHTTP(w, r)
+	if !ok {
+		return
+	}
+	if stat.Typ != StatementTypeSelect {
+		writeHTTPError(w, http.StatusBadRequest, "only select statements are allowed on /query, use /exec")
+		return
+	}
+
+	resp := httpQueryResponse{
+		Columns: stat.columnNames(),
+		Rows:    []httpRow{},
+	}
+	session := NewSession(c, user, r.RemoteAddr)
+	defer session.close()
+	_, err := s.executeStatement(session, stat, func(row *Row) error {
+		values := httpRow{}
+		for i, v := range stat.project(row) {
+			values[resp.Columns[i]] = v
+		}
+		resp.Rows = append(resp.Rows, values)
+		return nil
+	})
+	if err != nil {
+		writeHTTPStatementError(w, err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, resp)
+}
+
+// POST /exec 执行写语句
+func (s *Server) handleHTTPExec(w http.ResponseWriter, r *http.Request) {
+	stat, c, user, ok := s.prepareHTTP(w, r)
+	if !ok {
+		return
+	}
+	if stat.Typ == StatementTypeSelect {
+		writeHTTPError(w, http.StatusBadRequest, "select statements are not allowed on /exec, use /query")
+		return
+	}
+	// 每个请求使用单独的会话，事务和预处理语句无法跨请求，多条语句用/batch
+	switch stat.Typ {
+	case StatementTypeBegin, StatementTypeCommit, StatementTypeRollback, StatementTypePrepareTransaction:
+		writeHTTPError(w, http.StatusBadRequest, "transaction statements are not allowed on /exec, use /batch")
+		return
+	case StatementTypePrepare, StatementTypeExecute, StatementTypeDeallocate:
+		writeHTTPError(w, http.StatusBadRequest, "prepared statements are not allowed on /exec, use /batch")
+		return
+	}
+
+	session := NewSession(c, user, r.RemoteAddr)
+	defer session.close()
+	rows, err := s.executeStatement(session, stat, func(row *Row) error { return nil })
+	if err != nil {
+		writeHTTPStatementError(w, err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, httpExecResponse{OK: true, RowsAffected: rows, Result: stat.Result})
+}
+
+// POST /batch 在一个事务中执行以分号分隔的多条写语句，任何一条失败时全部回滚
+func (s *Server) handleHTTPBatch(w http.ResponseWriter, r *http.Request) {
+	input, c, user, ok := s.readHTTP(w, r)
+	if !ok {
+		return
+	}
+	var stats []*Statement
+	for _, text := range splitStatements(input) {
+		if text == "" {
+			continue
+		}
+		stat, err := prepareNetworkStatement(text)
+		if err == nil {
+			err = c.authorize(user, stat)
+		}
+		if err != nil {
+			writeHTTPStatementError(w, fmt.Errorf("statement %d: %w", len(stats)+1, err))
+			return
+		}
+		stats = append(stats, stat)
+	}
+
+	session := NewSession(c, user, r.RemoteAddr)
+	defer session.close()
+	rows, err := s.executeBatch(session, stats)
+	if err != nil {
+		writeHTTPStatementError(w, err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, httpExecResponse{OK: true, RowsAffected: rows})
+}
+
+// 请求体可以是 {"sql": "..."}，也可以直接是SQL文本
+func (s *Server) prepareHTTP(w http.ResponseWriter, r *http.Request) (*Statement, *Catalog, string, bool) {
+	input, c, user, ok := s.readHTTP(w, r)
+	if !ok {
+		return nil, nil, "", false
+	}
+	stat, err := prepareNetworkStatement(input)
+	if err == nil {
+		err = c.authorize(user, stat)
+	}
+	if err != nil {
+		writeHTTPStatementError(w, err)
+		return nil, nil, "", false
+	}
+	return stat, c, user, true
+}
+
+// 选择数据库、验证用户并读取请求体中的SQL
+func (s *Server) readHTTP(w http.ResponseWriter, r *http.Request) (string, *Catalog, string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return "", nil, "", false
+	}
+
+	c, err := s.httpCatalog(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrUnknownTenant) {
+			status = http.StatusNotFound
+		}
+		writeHTTPError(w, status, err.Error())
+		return "", nil, "", false
+	}
+
+	user, err := httpAuthenticate(c, r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="golitedb"`)
+		writeHTTPError(w, http.StatusUnauthorized, err.Error())
+		return "", nil, "", false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, HTTP_MAX_BODY_SIZE))
+	if err != nil {
+		writeHTTPError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return "", nil, "", false
+	}
+
+	input := string(body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req httpRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return "", nil, "", false
+		}
+		input = req.SQL
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(input), ";")), c, user, true
+}
+
+// 请求选择的数据库，由查询参数database或请求头X-Database指定，没有指定时使用默认的数据库
+func (s *Server) httpCatalog(r *http.Request) (*Catalog, error) {
+	name := r.URL.Query().Get("database")
+	if name == "" {
+		name = r.Header.Get(HTTP_DATABASE_HEADER)
+	}
+	if name == "" {
+		return s.catalog, nil
+	}
+	return s.tenant(name)
+}
+
+// 使用HTTP Basic认证，返回通过认证的用户。用户属于各自的数据库
+func httpAuthenticate(c *Catalog, r *http.Request) (string, error) {
+	required, err := c.authRequired()
+	if err != nil || !required {
+		return "", err
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", ErrAuthRequired
+	}
+	if err := c.authenticate(user, password); err != nil {
+		return "", err
+	}
+	return user, nil
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPrepareSyntax), errors.Is(err, ErrPrepareUnRecognized), errors.Is(err, ErrNotAllowedInTx):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInUseBySnapshot):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnknownTable), errors.Is(err, ErrUnknownDatabase), errors.Is(err, ErrUnknownTenant),
+		errors.Is(err, ErrUnknownPreparedStmt), errors.Is(err, ErrUnknownPreparedTx):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPreparedStatementExist), errors.Is(err, ErrPreparedTxExists), errors.Is(err, ErrPreparedTxCommit),
+		errors.Is(err, ErrTableExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrTooManyRows):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, ErrConstraint):
+		return http.StatusConflict
+	case errors.Is(err, ErrLockTimeout):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrDeadlock):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	writeHTTPJSON(w, status, httpErrorResponse{Error: message})
+}
+
+// 引擎错误同时返回错误分类
+func writeHTTPStatementError(w http.ResponseWriter, err error) {
+	resp := httpErrorResponse{Error: err.Error()}
+	var e *Error
+	if errors.As(err, &e) {
+		resp.Code = e.Code.String()
+	}
+	writeHTTPJSON(w, httpStatus(err), resp)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	return &Server{catalog: openTestCatalog(t), rates: newClientLimiters(0)}
+}
+
+// 发送一个HTTP请求，返回状态码和响应体
+func httpTest(s *Server, path, sql string) (int, string) {
+	w := httptest.NewRecorder()
+	s.httpHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(sql)))
+	return w.Code, w.Body.String()
+}
+
+func TestHTTPExecRejectsSessionStatements(t *testing.T) {
+	s := newTestServer(t)
+	for _, sql := range []string{
+		"begin",
+		"commit",
+		"rollback",
+		"prepare transaction 'x'",
+		"prepare p as select",
+		"execute p",
+		"deallocate p",
+	} {
+		if code, body := httpTest(s, "/exec", sql); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d %s, want %d", sql, code, body, http.StatusBadRequest)
+		}
+	}
+	if n := len(s.catalog.transactions.list()); n != 0 {
+		t.Errorf("%d transactions left open", n)
+	}
+}
+
+func TestHTTPExecClosesSession(t *testing.T) {
+	s := newTestServer(t)
+	if code, body := httpTest(s, "/exec", "create temp table t"); code != http.StatusOK {
+		t.Fatalf("create temp table: status %d %s", code, body)
+	}
+	if len(s.catalog.temp) != 0 {
+		t.Error("temp table outlived its request")
+	}
+}
+
+func TestHTTPQueryReturnsRows(t *testing.T) {
+	s := newTestServer(t)
+	if code, body := httpTest(s, "/exec", "insert 1 alice alice@example.com"); code != http.StatusOK || !strings.Contains(body, `"rows_affected":1`) {
+		t.Fatalf("insert: status %d %s", code, body)
+	}
+
+	code, body := httpTest(s, "/query", "select username, id from users;")
+	if code != http.StatusOK {
+		t.Fatalf("select: status %d %s", code, body)
+	}
+	var resp httpQueryResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resp.Columns, []string{"username", "id"}) {
+		t.Errorf("columns %v, want [username id]", resp.Columns)
+	}
+	if len(resp.Rows) != 1 || resp.Rows[0]["username"] != "alice" || resp.Rows[0]["id"] != float64(1) {
+		t.Errorf("rows %v, want alice with id 1", resp.Rows)
+	}
+
+	if code, _ := httpTest(s, "/query", "insert 2 bob bob@example.com"); code != http.StatusBadRequest {
+		t.Errorf("insert on /query: status %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := httpTest(s, "/exec", "select * from users"); code != http.StatusBadRequest {
+		t.Errorf("select on /exec: status %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := httpTest(s, "/query", "select * from nosuch"); code != http.StatusNotFound {
+		t.Errorf("unknown table: status %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestHTTPJSONBodyAndMethod(t *testing.T) {
+	s := newTestServer(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader(`{"sql": "insert 1 alice alice@example.com"}`))
+	r.Header.Set("Content-Type", "application/json")
+	s.httpHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("JSON body: status %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	s.httpHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET: status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestHTTPBatchIsAtomic(t *testing.T) {
+	s := newTestServer(t)
+	code, body := httpTest(s, "/batch", "insert 1 alice alice@example.com; insert 2 bob bob@example.com;")
+	if code != http.StatusOK || !strings.Contains(body, `"rows_affected":2`) {
+		t.Fatalf("batch: status %d %s", code, body)
+	}
+
+	// 第二条语句执行失败，第一条也不写入
+	if code, body := httpTest(s, "/batch", "insert 3 carol carol@example.com; select * from nosuch"); code != http.StatusNotFound || !strings.Contains(body, "statement 2") {
+		t.Errorf("batch with an unknown table: status %d %s", code, body)
+	}
+	if code, body := httpTest(s, "/batch", "insert 4 eve eve@example.com; bogus"); code != http.StatusBadRequest || !strings.Contains(body, "statement 2") {
+		t.Errorf("batch with a syntax error: status %d %s", code, body)
+	}
+	if code, body := httpTest(s, "/batch", "insert 5 frank frank@example.com; commit"); code != http.StatusBadRequest {
+		t.Errorf("batch with commit: status %d %s", code, body)
+	}
+
+	_, body = httpTest(s, "/query", "select * from users")
+	var resp httpQueryResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Rows) != 2 {
+		t.Errorf("%d rows after the failed batches, want 2: %v", len(resp.Rows), resp.Rows)
+	}
+	if n := len(s.catalog.transactions.list()); n != 0 {
+		t.Errorf("%d transactions left open", n)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	KV_KEY_SIZE   = 64
+	KV_VALUE_SIZE = 255
+
+	KV_FLAG_SIZE        = 1
+	KV_LENGTH_SIZE      = 2
+	KV_FLAG_OFFSET      = 0
+	KV_KEY_LEN_OFFSET   = KV_FLAG_OFFSET + KV_FLAG_SIZE
+	KV_VAL_LEN_OFFSET   = KV_KEY_LEN_OFFSET + KV_LENGTH_SIZE
+	KV_KEY_OFFSET       = KV_VAL_LEN_OFFSET + KV_LENGTH_SIZE
+	KV_VALUE_OFFSET     = KV_KEY_OFFSET + KV_KEY_SIZE
+	KV_RECORD_SIZE      = KV_VALUE_OFFSET + KV_VALUE_SIZE
+	KV_RECORDS_PER_PAGE = PAGE_SIZE / KV_RECORD_SIZE
+
+	KV_FILE_SUFFIX = "-kv"
+)
+
+var (
+	ErrKeyTooLarge   = fmt.Errorf("key is too large")
+	ErrValueTooLarge = fmt.Errorf("value is too large")
+)
+
+// KVTable 是一张键值表，每条记录占一个固定大小的槽位，
+// 每次写入都会立即把所在页写回文件，synchronous为full时还会同步到磁盘
+type KVTable struct {
+	mu       sync.Mutex
+	pager    *Pager
+	numSlots uint32
+	index    map[string]uint32
+	free     []uint32
+	// 打开的快照，修改键之前先为它们保存原来的值
+	snapshots []*kvSnapshot
+}
+
+// 键值表保存在数据库文件旁边的独立文件中，filename为空时为纯内存表
+func kvOpen(filename string) (*KVTable, error) {
+	pager, err := openPager(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := &KVTable{
+		pager: pager,
+		index: make(map[string]uint32),
+	}
+
+	numPages := uint32(pager.fileLength / PAGE_SIZE)
+	if pager.fileLength%PAGE_SIZE != 0 {
+		numPages++
+	}
+	kv.numSlots = numPages * KV_RECORDS_PER_PAGE
+	for slot := uint32(0); slot < kv.numSlots; slot++ {
+		record, err := kv.slot(slot)
+		if err != nil {
+			pager.close()
+			return nil, err
+		}
+		if record[KV_FLAG_OFFSET] == 0 {
+			kv.free = append(kv.free, slot)
+			continue
+		}
+		kv.index[string(kvKey(record))] = slot
+	}
+
+	return kv, nil
+}
+
+func (kv *KVTable) slot(slot uint32) ([]byte, error) {
+	page, err := kv.pager.getPage(slot / KV_RECORDS_PER_PAGE)
+	if err != nil {
+		return nil, err
+	}
+	offset := (slot % KV_RECORDS_PER_PAGE) * KV_RECORD_SIZE
+	return page[offset : offset+KV_RECORD_SIZE], nil
+}
+
+// 把槽位所在的页写回文件，synchronous为full时同步到磁盘
+func (kv *KVTable) flushSlot(slot uint32) error {
+	if err := kv.pager.flush(slot/KV_RECORDS_PER_PAGE, PAGE_SIZE); err != nil {
+		return err
+	}
+	return kv.syncFull()
+}
+
+// 调用方持有锁
+func (kv *KVTable) syncFull() error {
+	if kv.pager.synchronous != SYNCHRONOUS_FULL {
+		return nil
+	}
+	return kv.pager.sync()
+}
+
+// pragma synchronous 同样作用于键值表
+func (kv *KVTable) setSynchronous(mode string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.pager.synchronous = mode
+}
+
+func kvKey(record []byte) []byte {
+	n := binary.LittleEndian.Uint16(record[KV_KEY_LEN_OFFSET:])
+	return record[KV_KEY_OFFSET : KV_KEY_OFFSET+int(n)]
+}
+
+func kvValue(record []byte) []byte {
+	n := binary.LittleEndian.Uint16(record[KV_VAL_LEN_OFFSET:])
+	return record[KV_VALUE_OFFSET : KV_VALUE_OFFSET+int(n)]
+}
+
+// 数据库文件旁边的附属文件名，内存数据库没有附属文件
+func sidecarFilename(filename, suffix string) string {
+	if filename == "" {
+		return ""
+	}
+	return filename + suffix
+}
+
+func (kv *KVTable) Len() int {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return len(kv.index)
+}
+
+// Keys 按字典序返回所有以prefix开头的键
+func (kv *KVTable) Keys(prefix string) []string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	var keys []string
+	for key := range kv.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (kv *KVTable) Get(key []byte) ([]byte, bool, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return kv.get(key)
+}
+
+// 调用方持有锁
+func (kv *KVTable) get(key []byte) ([]byte, bool, error) {
+	slot, ok := kv.index[string(key)]
+	if !ok {
+		return nil, false, nil
+	}
+	record, err := kv.slot(slot)
+	if err != nil {
+		return nil, false, err
+	}
+	return append([]byte(nil), kvValue(record)...), true, nil
+}
+
+func (kv *KVTable) Put(key, value []byte) error {
+	if err := checkKV(key, value); err != nil {
+		return err
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	slot, err := kv.put(key, value)
+	if err != nil {
+		return err
+	}
+	return kv.flushSlot(slot)
+}
+
+func checkKV(key, value []byte) error {
+	if len(key) > KV_KEY_SIZE {
+		return ErrKeyTooLarge
+	}
+	if len(value) > KV_VALUE_SIZE {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// 在页缓存中写入一条记录，返回所在的槽位，调用方持有锁并负责写回文件
+func (kv *KVTable) put(key, value []byte) (uint32, error) {
+	if err := kv.preserve(key); err != nil {
+		return 0, err
+	}
+	slot, ok := kv.index[string(key)]
+	if !ok {
+		switch {
+		case len(kv.free) > 0:
+			slot = kv.free[len(kv.free)-1]
+			kv.free = kv.free[:len(kv.free)-1]
+		case kv.numSlots < math.MaxUint32:
+			slot = kv.numSlots
+			kv.numSlots++
+		default:
+			return 0, ErrFull
+		}
+	}
+
+	record, err := kv.slot(slot)
+	if err != nil {
+		return 0, err
+	}
+	clear(record)
+	record[KV_FLAG_OFFSET] = 1
+	binary.LittleEndian.PutUint16(record[KV_KEY_LEN_OFFSET:], uint16(len(key)))
+	binary.LittleEndian.PutUint16(record[KV_VAL_LEN_OFFSET:], uint16(len(value)))
+	copy(record[KV_KEY_OFFSET:], key)
+	copy(record[KV_VALUE_OFFSET:], value)
+	kv.index[string(key)] = slot
+	return slot, nil
+}
+
+func (kv *KVTable) Delete(key []byte) (bool, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	slot, ok, err := kv.delete(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, kv.flushSlot(slot)
+}
+
+// 在页缓存中删除一条记录，返回它原来的槽位，调用方持有锁并负责写回文件
+func (kv *KVTable) delete(key []byte) (uint32, bool, error) {
+	slot, ok := kv.index[string(key)]
+	if !ok {
+		return 0, false, nil
+	}
+	if err := kv.preserve(key); err != nil {
+		return 0, false, err
+	}
+	record, err := kv.slot(slot)
+	if err != nil {
+		return 0, false, err
+	}
+	clear(record)
+	delete(kv.index, string(key))
+	kv.free = append(kv.free, slot)
+	return slot, true, nil
+}
+
+// Scan 从cursor号槽位开始最多检查count个槽位，返回匹配pattern的键和下一个cursor，
+// cursor为0表示遍历结束
+func (kv *KVTable) Scan(cursor uint32, pattern string, count int) ([][]byte, uint32, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	var keys [][]byte
+	slot := cursor
+	for ; slot < kv.numSlots && count > 0; slot++ {
+		count--
+		record, err := kv.slot(slot)
+		if err != nil {
+			return nil, 0, err
+		}
+		if record[KV_FLAG_OFFSET] == 0 {
+			continue
+		}
+		key := kvKey(record)
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, string(key)); !ok {
+				continue
+			}
+		}
+		keys = append(keys, append([]byte(nil), key...))
+	}
+
+	if slot >= kv.numSlots {
+		slot = 0
+	}
+	return keys, slot, nil
+}
+
+func (kv *KVTable) close() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.pager.synchronous != SYNCHRONOUS_OFF {
+		if err := kv.pager.sync(); err != nil {
+			kv.pager.close()
+			return err
+		}
+	}
+	return kv.pager.close()
+}
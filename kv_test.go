@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestKVSynchronousFollowsPragma(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "pragma synchronous = full")
+
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.pager.synchronous != SYNCHRONOUS_FULL {
+		t.Errorf("kv synchronous = %s, want %s", kv.pager.synchronous, SYNCHRONOUS_FULL)
+	}
+	if err := kv.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	var batch WriteBatch
+	batch.Put(kv, []byte("b"), []byte("2"))
+	batch.Delete(kv, []byte("a"))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	if err := c.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	kv, err = c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := kv.Get([]byte("a")); ok {
+		t.Error("deleted key a survived reopen")
+	}
+	if value, ok, _ := kv.Get([]byte("b")); !ok || string(value) != "2" {
+		t.Errorf("key b after reopen = %q, %v, want \"2\", true", value, ok)
+	}
+}
+
+func TestKVPutGetDelete(t *testing.T) {
+	c := openTestCatalog(t)
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Put([]byte("k"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Put([]byte("k"), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := kv.Get([]byte("k")); err != nil || !ok || string(value) != "v2" {
+		t.Errorf("Get after overwrite = %q, %v, %v", value, ok, err)
+	}
+	if kv.Len() != 1 {
+		t.Errorf("Len = %d, want 1", kv.Len())
+	}
+	if found, err := kv.Delete([]byte("k")); err != nil || !found {
+		t.Errorf("Delete = %v, %v", found, err)
+	}
+	if found, _ := kv.Delete([]byte("k")); found {
+		t.Error("deleting a missing key reported it as found")
+	}
+
+	if err := kv.Put([]byte(strings.Repeat("k", KV_KEY_SIZE+1)), nil); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("long key: got %v, want ErrKeyTooLarge", err)
+	}
+	if err := kv.Put([]byte("k"), make([]byte, KV_VALUE_SIZE+1)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("long value: got %v, want ErrValueTooLarge", err)
+	}
+}
+
+func TestKVRangeAndScan(t *testing.T) {
+	c := openTestCatalog(t)
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"user:3", "user:1", "order:1", "user:2"} {
+		if err := kv.Put([]byte(key), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []string
+	err = kv.Range([]byte("user:"), []byte("user;"), func(key, value []byte) error {
+		keys = append(keys, string(key))
+		// 遍历期间的写入不影响结果
+		return kv.Put([]byte("user:9"), []byte("x"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"user:1", "user:2", "user:3"}; !slices.Equal(keys, want) {
+		t.Errorf("Range = %v, want %v", keys, want)
+	}
+
+	// 按游标分批扫描，直到游标回到0
+	var scanned []string
+	cursor := uint32(0)
+	for {
+		batch, next, err := kv.Scan(cursor, "user:*", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range batch {
+			scanned = append(scanned, string(key))
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	slices.Sort(scanned)
+	if want := []string{"user:1", "user:2", "user:3", "user:9"}; !slices.Equal(scanned, want) {
+		t.Errorf("Scan = %v, want %v", scanned, want)
+	}
+}
+
+func TestKVBuckets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.bucket("Alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.bucket("beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 各个桶的键互不影响
+	a.Put([]byte("k"), []byte("a"))
+	b.Put([]byte("k"), []byte("b"))
+	if value, _, _ := a.Get([]byte("k")); string(value) != "a" {
+		t.Errorf("bucket alpha has k = %q", value)
+	}
+	if _, err := c.bucket("bad-name"); err == nil {
+		t.Error("invalid bucket name was accepted")
+	}
+
+	c = reopenTestCatalog(t, c, filename)
+	names, err := c.buckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alpha", "beta"}; !slices.Equal(names, want) {
+		t.Errorf("buckets after reopen = %v, want %v", names, want)
+	}
+	if err := c.dropBucket("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.dropBucket("alpha"); !errors.Is(err, ErrNoSuchBucket) {
+		t.Errorf("dropping twice: got %v, want ErrNoSuchBucket", err)
+	}
+	a, err = c.bucket("alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Len() != 0 {
+		t.Errorf("recreated bucket has %d keys", a.Len())
+	}
+}
+
+func TestWriteBatchAcrossTables(t *testing.T) {
+	c := openTestCatalog(t)
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.bucket("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put([]byte("gone"), []byte("x"))
+
+	var batch WriteBatch
+	for i := 0; i < 2*KV_RECORDS_PER_PAGE; i++ {
+		if err := batch.Put(kv, []byte(fmt.Sprintf("k%d", i)), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch.Put(other, []byte("k"), []byte("other"))
+	batch.Delete(kv, []byte("gone"))
+	if err := batch.Put(kv, []byte("k"), make([]byte, KV_VALUE_SIZE+1)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("oversized value in a batch: got %v, want ErrValueTooLarge", err)
+	}
+	if batch.Len() != 2*KV_RECORDS_PER_PAGE+2 {
+		t.Errorf("batch has %d operations", batch.Len())
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if kv.Len() != 2*KV_RECORDS_PER_PAGE || other.Len() != 1 {
+		t.Errorf("after commit kv has %d keys and other %d", kv.Len(), other.Len())
+	}
+	if _, ok, _ := kv.Get([]byte("gone")); ok {
+		t.Error("deleted key survived the batch")
+	}
+}
+
+func TestSnapshotFreezesKeyValues(t *testing.T) {
+	c := openTestCatalog(t)
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put([]byte("a"), []byte("1"))
+	kv.Put([]byte("b"), []byte("1"))
+	if _, err := c.bucket("frozen"); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put([]byte("a"), []byte("2"))
+	kv.Delete([]byte("b"))
+	kv.Put([]byte("c"), []byte("2"))
+
+	if value, ok, _ := snap.Get(kv, []byte("a")); !ok || string(value) != "1" {
+		t.Errorf("snapshot a = %q, %v, want \"1\"", value, ok)
+	}
+	var keys []string
+	snap.Range(kv, nil, nil, func(key, value []byte) error {
+		keys = append(keys, string(key)+"="+string(value))
+		return nil
+	})
+	if want := []string{"a=1", "b=1"}; !slices.Equal(keys, want) {
+		t.Errorf("snapshot Range = %v, want %v", keys, want)
+	}
+	if err := c.dropBucket("frozen"); !errors.Is(err, ErrInUseBySnapshot) {
+		t.Errorf("dropping a bucket in a snapshot: got %v, want ErrInUseBySnapshot", err)
+	}
+	snap.Release()
+	if kv.inSnapshot() {
+		t.Error("released snapshot still registered")
+	}
+}
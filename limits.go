@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 长时间没有请求的客户端的限流状态会被清理
+const RATE_LIMITER_IDLE_TIMEOUT = time.Minute
+
+var (
+	ErrRateLimited     = fmt.Errorf("rate limit exceeded")
+	ErrTooManyRows     = fmt.Errorf("result row limit exceeded")
+	ErrTooManyConns    = fmt.Errorf("too many connections")
+	ErrLimitOutOfRange = fmt.Errorf("limit must not be negative")
+)
+
+// ServerLimits 中为0的项表示不限制
+type ServerLimits struct {
+	maxConnections      int
+	statementsPerSecond float64
+	maxResultRows       int
+}
+
+func (l ServerLimits) validate() error {
+	if l.maxConnections < 0 || l.statementsPerSecond < 0 || l.maxResultRows < 0 {
+		return ErrLimitOutOfRange
+	}
+	return nil
+}
+
+// 令牌桶，容量为一秒的配额
+type rateLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+// clientLimiters 按客户端IP限制语句速率，同一个客户端的多个连接共享配额
+type clientLimiters struct {
+	mu       sync.Mutex
+	rate     float64
+	limiters map[string]*rateLimiter
+}
+
+func newClientLimiters(rate float64) *clientLimiters {
+	return &clientLimiters{
+		rate:     rate,
+		limiters: make(map[string]*rateLimiter),
+	}
+}
+
+func (cl *clientLimiters) allow(client string) error {
+	if cl.rate == 0 {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	now := time.Now()
+	for key, l := range cl.limiters {
+		if now.Sub(l.last) > RATE_LIMITER_IDLE_TIMEOUT {
+			delete(cl.limiters, key)
+		}
+	}
+
+	l, ok := cl.limiters[client]
+	if !ok {
+		l = &rateLimiter{tokens: cl.rate, last: now}
+		cl.limiters[client] = l
+	}
+	l.tokens = min(cl.rate, l.tokens+now.Sub(l.last).Seconds()*cl.rate)
+	l.last = now
+	if l.tokens < 1 {
+		return ErrRateLimited
+	}
+	l.tokens--
+	return nil
+}
+
+// 超过最大行数时中止扫描
+func limitRows(handle RowHandler, maxRows int) RowHandler {
+	if maxRows == 0 {
+		return handle
+	}
+	n := 0
+	return func(row *Row) error {
+		n++
+		if n > maxRows {
+			return fmt.Errorf("%w: %d", ErrTooManyRows, maxRows)
+		}
+		return handle(row)
+	}
+}
+
+// limitListener 在所有监听器之间限制同时存在的连接数，超出时直接关闭新连接
+type limitListener struct {
+	net.Listener
+	active *atomic.Int64
+	max    int64
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.active.Add(1) > l.max {
+			l.active.Add(-1)
+			slog.Warn("connection rejected", "client", conn.RemoteAddr().String(), "error", ErrTooManyConns)
+			conn.Close()
+			continue
+		}
+		return &limitConn{Conn: conn, active: l.active}, nil
+	}
+}
+
+type limitConn struct {
+	net.Conn
+	active *atomic.Int64
+	once   sync.Once
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(func() { c.active.Add(-1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRateLimitPerClientHost(t *testing.T) {
+	cl := newClientLimiters(2)
+	for i := 0; i < 2; i++ {
+		if err := cl.allow("10.0.0.1:5000"); err != nil {
+			t.Fatalf("statement %d: %v", i+1, err)
+		}
+	}
+	// 同一个IP的另一个连接共享配额
+	if err := cl.allow("10.0.0.1:5001"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("third statement: got %v, want ErrRateLimited", err)
+	}
+	if err := cl.allow("10.0.0.2:5000"); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+	if err := newClientLimiters(0).allow("10.0.0.1:5000"); err != nil {
+		t.Errorf("unlimited: %v", err)
+	}
+}
+
+func TestServerLimitsRejectNegative(t *testing.T) {
+	if err := (ServerLimits{maxResultRows: -1}).validate(); !errors.Is(err, ErrLimitOutOfRange) {
+		t.Errorf("got %v, want ErrLimitOutOfRange", err)
+	}
+	if err := (ServerLimits{maxConnections: 10}).validate(); err != nil {
+		t.Errorf("valid limits: %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	HISTORY_FILE_NAME = ".golitedb_history"
+	HISTORY_MAX_LINES = 1000
+)
+
+// 行编辑器使用的控制键
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEnter     = '\r'
+	keyNewline   = '\n'
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+	keyTab       = '\t'
+)
+
+// LineEditor 在终端上提供行编辑和历史记录，输入不是终端时逐行读取
+type LineEditor struct {
+	in          *os.File
+	out         io.Writer
+	reader      *bufio.Reader
+	terminal    bool
+	history     []string
+	historyFile string
+	historySize int
+	// 处于原始模式时用于恢复终端
+	restore func()
+	// 按Tab时返回当前单词的候选项，before是当前单词之前的输入
+	completer func(before, word string) []string
+}
+
+func NewLineEditor(in *os.File, out io.Writer) *LineEditor {
+	e := &LineEditor{
+		in:       in,
+		out:      out,
+		reader:   bufio.NewReader(in),
+		terminal: isTerminal(in.Fd()),
+	}
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, HISTORY_FILE_NAME)
+	}
+	e.useHistory(historyFile, HISTORY_MAX_LINES)
+	return e
+}
+
+// 设置历史记录文件和保留的条数并重新读取历史记录，filename为空时不保存历史记录
+func (e *LineEditor) useHistory(filename string, size int) {
+	if !e.terminal {
+		return
+	}
+	e.historyFile = filename
+	e.historySize = size
+	e.history = nil
+	if filename != "" {
+		e.loadHistory()
+	}
+}
+
+func (e *LineEditor) loadHistory() {
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > e.historySize {
+		e.history = e.history[len(e.history)-e.historySize:]
+	}
+}
+
+// 与上一条相同的输入不重复记录
+func (e *LineEditor) addHistory(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.Contains(line, "\n") || e.historySize == 0 {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > e.historySize {
+		e.history = e.history[1:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// 读取一行输入，不包含行尾换行符。输入不是终端时不显示提示符
+func (e *LineEditor) readLine(prompt string) (string, error) {
+	if !e.terminal {
+		line, err := e.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(e.out, prompt)
+
+	restore, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	e.restore = restore
+	defer e.close()
+
+	line, err := e.edit(prompt)
+	fmt.Fprint(e.out, "\r\n")
+	if err == nil {
+		e.addHistory(line)
+	}
+	return line, err
+}
+
+// 在原始模式下读取一个按键，用于分页输出时等待用户
+func (e *LineEditor) readKey() (rune, error) {
+	restore, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return 0, err
+	}
+	e.restore = restore
+	defer e.close()
+
+	r, _, err := e.reader.ReadRune()
+	return r, err
+}
+
+// 恢复终端设置，在读取输入时退出程序也不会留下原始模式的终端
+func (e *LineEditor) close() {
+	if e.restore != nil {
+		e.restore()
+		e.restore = nil
+	}
+}
+
+// ErrInterrupted 表示用户按Ctrl-C放弃了当前输入
+var ErrInterrupted = fmt.Errorf("interrupted")
+
+func (e *LineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	// 浏览历史时保留正在编辑的内容
+	histPos := len(e.history)
+	saved := ""
+
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+		refresh()
+	}
+	historyMove := func(delta int) {
+		next := histPos + delta
+		if next < 0 || next > len(e.history) {
+			return
+		}
+		if histPos == len(e.history) {
+			saved = string(buf)
+		}
+		histPos = next
+		if histPos == len(e.history) {
+			setLine(saved)
+		} else {
+			setLine(e.history[histPos])
+		}
+	}
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyNewline:
+			return string(buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(buf) == 0 {
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+				refresh()
+			}
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+				refresh()
+			}
+		case keyCtrlA:
+			pos = 0
+			refresh()
+		case keyCtrlE:
+			pos = len(buf)
+			refresh()
+		case keyCtrlB:
+			if pos > 0 {
+				pos--
+				refresh()
+			}
+		case keyCtrlF:
+			if pos < len(buf) {
+				pos++
+				refresh()
+			}
+		case keyCtrlK:
+			buf = buf[:pos]
+			refresh()
+		case keyCtrlU:
+			buf = buf[pos:]
+			pos = 0
+			refresh()
+		case keyCtrlP:
+			historyMove(-1)
+		case keyCtrlN:
+			historyMove(1)
+		case keyEscape:
+			e.escape(&buf, &pos, refresh, historyMove)
+		case keyTab:
+			buf, pos = e.completeWord(prompt, buf, pos)
+			refresh()
+		default:
+			if r < ' ' {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+			refresh()
+		}
+	}
+}
+
+// 只有一个候选项时直接补全，多个候选项时补全公共前缀并列出所有候选项
+func (e *LineEditor) completeWord(prompt string, buf []rune, pos int) ([]rune, int) {
+	if e.completer == nil {
+		return buf, pos
+	}
+	start := pos
+	for start > 0 && buf[start-1] != ' ' {
+		start--
+	}
+	word := string(buf[start:pos])
+	candidates := e.completer(string(buf[:start]), word)
+	if len(candidates) == 0 {
+		return buf, pos
+	}
+
+	completion := candidates[0]
+	if len(candidates) == 1 {
+		completion += " "
+	} else {
+		for _, c := range candidates[1:] {
+			for !strings.HasPrefix(c, completion) {
+				completion = completion[:len(completion)-1]
+			}
+		}
+		if len([]rune(completion)) <= len([]rune(word)) {
+			fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		}
+	}
+	if len([]rune(completion)) < len([]rune(word)) {
+		return buf, pos
+	}
+
+	rest := slices.Clone(buf[pos:])
+	buf = append(append(buf[:start], []rune(completion)...), rest...)
+	return buf, start + len([]rune(completion))
+}
+
+// 处理方向键、Home/End和Delete的转义序列
+func (e *LineEditor) escape(buf *[]rune, pos *int, refresh func(), historyMove func(int)) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	code, _, err := e.reader.ReadRune()
+	if err != nil {
+		return
+	}
+	if code >= '0' && code <= '9' {
+		// ESC [ n ~
+		if tilde, _, err := e.reader.ReadRune(); err != nil || tilde != '~' {
+			return
+		}
+		switch code {
+		case '1', '7':
+			code = 'H'
+		case '4', '8':
+			code = 'F'
+		case '3':
+			if *pos < len(*buf) {
+				*buf = append((*buf)[:*pos], (*buf)[*pos+1:]...)
+				refresh()
+			}
+			return
+		}
+	}
+
+	switch code {
+	case 'A':
+		historyMove(-1)
+	case 'B':
+		historyMove(1)
+	case 'C':
+		if *pos < len(*buf) {
+			*pos++
+			refresh()
+		}
+	case 'D':
+		if *pos > 0 {
+			*pos--
+			refresh()
+		}
+	case 'H':
+		*pos = 0
+		refresh()
+	case 'F':
+		*pos = len(*buf)
+		refresh()
+	}
+}
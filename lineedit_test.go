@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLineEditorHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	e := &LineEditor{historyFile: filename, historySize: 2}
+	for _, line := range []string{"select 1", "select 1", "  ", "insert 1 a b", "select 2"} {
+		e.addHistory(line)
+	}
+	// 连续相同的输入只记录一次，只保留最近的historySize条
+	if want := []string{"insert 1 a b", "select 2"}; !slices.Equal(e.history, want) {
+		t.Errorf("history %q, want %q", e.history, want)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "select 1\ninsert 1 a b\nselect 2\n" {
+		t.Errorf("history file %q", data)
+	}
+
+	e = &LineEditor{historyFile: filename, historySize: 2}
+	e.loadHistory()
+	if want := []string{"insert 1 a b", "select 2"}; !slices.Equal(e.history, want) {
+		t.Errorf("loaded history %q, want %q", e.history, want)
+	}
+
+	e = &LineEditor{historyFile: filename, historySize: 0}
+	e.addHistory("select 3")
+	if len(e.history) != 0 {
+		t.Errorf("history size 0 kept %q", e.history)
+	}
+}
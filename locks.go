@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 默认的锁等待时间
+const DEFAULT_LOCK_TIMEOUT = 5 * time.Second
+
+var (
+	ErrLockTimeout = fmt.Errorf("lock wait timeout exceeded")
+	ErrDeadlock    = fmt.Errorf("deadlock detected")
+)
+
+type LockMode int
+
+const (
+	LOCK_SHARED LockMode = iota
+	LOCK_EXCLUSIVE
+)
+
+func (m LockMode) String() string {
+	if m == LOCK_EXCLUSIVE {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// LockManager 按表授予共享锁和排他锁。事务中的锁保持到提交或回滚，
+// 自动提交的语句在语句结束时释放。等待的请求按到达顺序排队，
+// 后来的请求不会越过队列中的请求，避免写者饿死
+type LockManager struct {
+	mu     sync.Mutex
+	tables map[string]*tableLock
+}
+
+type tableLock struct {
+	holders map[*Session]LockMode
+	queue   []*lockRequest
+}
+
+type lockRequest struct {
+	owner *Session
+	mode  LockMode
+	ready chan struct{}
+}
+
+// 获取表锁，已经持有足够的锁时直接返回。timeout为0表示一直等待，
+// ctx被取消时放弃等待
+func (lm *LockManager) acquire(ctx context.Context, owner *Session, table string, mode LockMode, timeout time.Duration) error {
+	table = qualifyTableName(table)
+
+	lm.mu.Lock()
+	if lm.tables == nil {
+		lm.tables = map[string]*tableLock{}
+	}
+	tl, ok := lm.tables[table]
+	if !ok {
+		tl = &tableLock{holders: map[*Session]LockMode{}}
+		lm.tables[table] = tl
+	}
+	if held, ok := tl.holders[owner]; ok && held >= mode {
+		lm.mu.Unlock()
+		return nil
+	}
+	if len(tl.queue) == 0 && tl.compatible(owner, mode) {
+		tl.holders[owner] = mode
+		lm.mu.Unlock()
+		return nil
+	}
+	req := &lockRequest{owner: owner, mode: mode, ready: make(chan struct{})}
+	if _, upgrade := tl.holders[owner]; upgrade {
+		// 升级请求排在最前面，否则会等待排在它后面的请求
+		tl.queue = append([]*lockRequest{req}, tl.queue...)
+	} else {
+		tl.queue = append(tl.queue, req)
+	}
+	// 等待会形成环时由发起请求的一方放弃，而不是让双方一直等到超时
+	if lm.waitsFor(owner, owner, map[*Session]bool{}) {
+		tl.remove(req)
+		lm.mu.Unlock()
+		return fmt.Errorf("%w: waiting for %s lock on %s", ErrDeadlock, mode, table)
+	}
+	lm.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var cancelled <-chan struct{}
+	if ctx != nil {
+		cancelled = ctx.Done()
+	}
+	err := fmt.Errorf("%w: %s lock on %s", ErrLockTimeout, mode, table)
+	select {
+	case <-req.ready:
+		return nil
+	case <-expired:
+	case <-cancelled:
+		err = ErrInterrupted
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	select {
+	case <-req.ready:
+		// 超时的同时得到了锁
+		return nil
+	default:
+	}
+	tl.remove(req)
+	tl.grant()
+	return err
+}
+
+// 把from持有的锁全部转交给to，from不能正在等待锁
+func (lm *LockManager) transfer(from, to *Session) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, tl := range lm.tables {
+		if mode, ok := tl.holders[from]; ok {
+			delete(tl.holders, from)
+			tl.holders[to] = mode
+		}
+	}
+}
+
+// 释放owner持有的所有表锁
+func (lm *LockManager) releaseAll(owner *Session) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for table, tl := range lm.tables {
+		if _, ok := tl.holders[owner]; !ok {
+			continue
+		}
+		delete(tl.holders, owner)
+		tl.grant()
+		if len(tl.holders) == 0 && len(tl.queue) == 0 {
+			delete(lm.tables, table)
+		}
+	}
+}
+
+// 在等待图中从from出发能否到达target。排队的请求等待与它不相容的持有者，
+// 以及排在它前面的请求
+func (lm *LockManager) waitsFor(from, target *Session, visited map[*Session]bool) bool {
+	if visited[from] {
+		return false
+	}
+	visited[from] = true
+	for _, tl := range lm.tables {
+		for i, req := range tl.queue {
+			if req.owner != from {
+				continue
+			}
+			var blockers []*Session
+			for holder, held := range tl.holders {
+				if holder != from && (req.mode == LOCK_EXCLUSIVE || held == LOCK_EXCLUSIVE) {
+					blockers = append(blockers, holder)
+				}
+			}
+			for _, ahead := range tl.queue[:i] {
+				blockers = append(blockers, ahead.owner)
+			}
+			for _, b := range blockers {
+				if b == target || lm.waitsFor(b, target, visited) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// 共享锁之间相容，排他锁与其他所有者的任何锁都不相容
+func (tl *tableLock) compatible(owner *Session, mode LockMode) bool {
+	for holder, held := range tl.holders {
+		if holder != owner && (mode == LOCK_EXCLUSIVE || held == LOCK_EXCLUSIVE) {
+			return false
+		}
+	}
+	return true
+}
+
+// 按顺序授予队首可以授予的请求
+func (tl *tableLock) grant() {
+	for len(tl.queue) > 0 {
+		req := tl.queue[0]
+		if !tl.compatible(req.owner, req.mode) {
+			return
+		}
+		tl.holders[req.owner] = max(tl.holders[req.owner], req.mode)
+		tl.queue = tl.queue[1:]
+		close(req.ready)
+	}
+}
+
+func (tl *tableLock) remove(req *lockRequest) {
+	for i, r := range tl.queue {
+		if r == req {
+			tl.queue = append(tl.queue[:i], tl.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// 语句需要的表锁：读取的表加共享锁，写入的表加排他锁
+func statementLocks(stat *Statement) map[string]LockMode {
+	switch stat.Typ {
+	case StatementTypeSelect:
+		return map[string]LockMode{qualifyTableName(stat.TableName): LOCK_SHARED}
+	case StatementTypeInsert, StatementTypeTruncate, StatementTypeRefreshMaterializedView:
+		return map[string]LockMode{qualifyTableName(stat.TableName): LOCK_EXCLUSIVE}
+	case StatementTypeCreateMaterializedView:
+		locks := map[string]LockMode{qualifyTableName(stat.Prepared.TableName): LOCK_SHARED}
+		locks[qualifyTableName(stat.TableName)] = LOCK_EXCLUSIVE
+		return locks
+	case StatementTypeInsertSelect:
+		locks := map[string]LockMode{qualifyTableName(stat.SourceTable): LOCK_SHARED}
+		locks[qualifyTableName(stat.TableName)] = LOCK_EXCLUSIVE
+		return locks
+	}
+	return nil
+}
+
+// 获取语句需要的表锁，按表名顺序加锁
+func (s *Session) lockTables(stat *Statement) error {
+	locks := statementLocks(stat)
+	tables := make([]string, 0, len(locks))
+	for table := range locks {
+		tables = append(tables, table)
+	}
+	slices.Sort(tables)
+	timeout := s.catalog.lockTimeout()
+	for _, table := range tables {
+		if err := s.catalog.locks.acquire(stat.Ctx, s, table, locks[table], timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) lockTimeout() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.pragmas.lockTimeout
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 等待表的锁队列中有n个请求
+func waitQueued(t *testing.T, lm *LockManager, table string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		lm.mu.Lock()
+		tl := lm.tables[qualifyTableName(table)]
+		queued := tl != nil && len(tl.queue) == n
+		lm.mu.Unlock()
+		if queued {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("lock queue on %s never reached %d requests", table, n)
+}
+
+func acquireAsync(lm *LockManager, owner *Session, mode LockMode, timeout time.Duration) chan error {
+	done := make(chan error, 1)
+	go func() { done <- lm.acquire(nil, owner, USERS_TABLE, mode, timeout) }()
+	return done
+}
+
+func TestLockSharedGrantedTogether(t *testing.T) {
+	var lm LockManager
+	a, b := &Session{}, &Session{}
+	if err := lm.acquire(nil, a, USERS_TABLE, LOCK_SHARED, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := lm.acquire(nil, b, USERS_TABLE, LOCK_SHARED, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockExclusiveWaitsInOrder(t *testing.T) {
+	var lm LockManager
+	a, b, c := &Session{}, &Session{}, &Session{}
+	if err := lm.acquire(nil, a, USERS_TABLE, LOCK_SHARED, 0); err != nil {
+		t.Fatal(err)
+	}
+	writer := acquireAsync(&lm, b, LOCK_EXCLUSIVE, 0)
+	waitQueued(t, &lm, USERS_TABLE, 1)
+	// 共享锁与a相容，但不能越过排队的写者
+	reader := acquireAsync(&lm, c, LOCK_SHARED, 0)
+	waitQueued(t, &lm, USERS_TABLE, 2)
+
+	lm.releaseAll(a)
+	if err := <-writer; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-reader:
+		t.Fatalf("reader granted while the writer holds the lock: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	lm.releaseAll(b)
+	if err := <-reader; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockUpgradeDeadlock(t *testing.T) {
+	var lm LockManager
+	a, b := &Session{}, &Session{}
+	for _, s := range []*Session{a, b} {
+		if err := lm.acquire(nil, s, USERS_TABLE, LOCK_SHARED, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upgrade := acquireAsync(&lm, a, LOCK_EXCLUSIVE, 0)
+	waitQueued(t, &lm, USERS_TABLE, 1)
+
+	if err := lm.acquire(nil, b, USERS_TABLE, LOCK_EXCLUSIVE, 0); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("second upgrade: %v, want %v", err, ErrDeadlock)
+	}
+	lm.releaseAll(b)
+	if err := <-upgrade; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockTimeoutLetsNextWaiterIn(t *testing.T) {
+	var lm LockManager
+	a, b, c := &Session{}, &Session{}, &Session{}
+	if err := lm.acquire(nil, a, USERS_TABLE, LOCK_SHARED, 0); err != nil {
+		t.Fatal(err)
+	}
+	writer := acquireAsync(&lm, b, LOCK_EXCLUSIVE, 30*time.Millisecond)
+	waitQueued(t, &lm, USERS_TABLE, 1)
+	reader := acquireAsync(&lm, c, LOCK_SHARED, 0)
+	waitQueued(t, &lm, USERS_TABLE, 2)
+
+	if err := <-writer; !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("writer: %v, want %v", err, ErrLockTimeout)
+	}
+	select {
+	case err := <-reader:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader still waiting after the writer timed out")
+	}
+}
+
+func TestSessionLockTimeout(t *testing.T) {
+	c := openTestCatalog(t)
+	holder := NewSession(c, "", "holder")
+	defer holder.close()
+	waiter := NewSession(c, "", "waiter")
+	defer waiter.close()
+
+	execTest(t, holder, "pragma lock_timeout = 50")
+	execTest(t, holder, "begin")
+	execTest(t, holder, "insert 1 alice alice@example.com")
+
+	start := time.Now()
+	if err := execTestErr(t, waiter, "insert 2 bob bob@example.com"); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("write while the table is locked: %v, want %v", err, ErrLockTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("gave up after %v, before lock_timeout", elapsed)
+	}
+
+	// 提交释放锁之后可以写入
+	execTest(t, holder, "commit")
+	execTest(t, waiter, "insert 2 bob bob@example.com")
+	if got := execTest(t, waiter, "select * from users"); len(got) != 2 {
+		t.Errorf("rows %v, want two", got)
+	}
+}
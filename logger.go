@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// 引擎日志统一通过slog输出，嵌入方可以用slog.SetDefault接管
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+var (
+	ErrUnknownLogLevel  = fmt.Errorf("unknown log level")
+	ErrUnknownLogFormat = fmt.Errorf("unknown log format")
+)
+
+// level为debug、info、warn或error，format为text或json
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLogLevel, level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case LOG_FORMAT_TEXT:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case LOG_FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownLogFormat, format)
+}
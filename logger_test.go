@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "warn", "JSON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "table", "users")
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if entry["msg"] != "shown" || entry["table"] != "users" {
+		t.Errorf("log entry %v", entry)
+	}
+
+	if _, err := newLogger(&buf, "loud", LOG_FORMAT_TEXT); !errors.Is(err, ErrUnknownLogLevel) {
+		t.Errorf("unknown level: got %v, want ErrUnknownLogLevel", err)
+	}
+	if _, err := newLogger(&buf, "info", "xml"); !errors.Is(err, ErrUnknownLogFormat) {
+		t.Errorf("unknown format: got %v, want ErrUnknownLogFormat", err)
+	}
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/binary"
+	"errors"
+	"expvar"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/mail"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -19,16 +29,10 @@ const (
 	EMAIL_OFFSET    = USERNAME_OFFSET + COLUMN_USERNAME_SIZE
 	ROW_SIZE        = ID_SIZE + COLUMN_USERNAME_SIZE + COLUMN_EMAIL_SIZE
 
-	PAGE_SIZE       = 4096
-	TABLE_MAX_PAGES = 100
-	ROWS_PER_PAGE   = PAGE_SIZE / ROW_SIZE
-	TABLE_MAX_ROWS  = ROWS_PER_PAGE * TABLE_MAX_PAGES
-)
-
-var (
-	ErrTableFull           = fmt.Errorf("table is full")
-	ErrPrepareSyntax       = fmt.Errorf("syntax error in statement")
-	ErrPrepareUnRecognized = fmt.Errorf("unrecognized statement type")
+	PAGE_SIZE     = 4096
+	ROWS_PER_PAGE = PAGE_SIZE / ROW_SIZE
+	// 行号是uint32，表随插入增长，直到行号用完或磁盘写满
+	TABLE_MAX_ROWS = math.MaxUint32
 )
 
 type Row struct {
@@ -42,16 +46,167 @@ type StatementType int
 const (
 	StatementTypeInsert StatementType = iota
 	StatementTypeSelect
+	StatementTypeInsertSelect
+	StatementTypeCreateUser
+	StatementTypeAlterUser
+	StatementTypeCreateRole
+	StatementTypeGrant
+	StatementTypeRevoke
+	StatementTypeGrantRole
+	StatementTypeRevokeRole
+	StatementTypeBegin
+	StatementTypeCommit
+	StatementTypeRollback
+	StatementTypePrepare
+	StatementTypeExecute
+	StatementTypeDeallocate
+	StatementTypePragma
+	StatementTypeCreateFulltextIndex
+	StatementTypeCreateSequence
+	StatementTypeNextval
+	StatementTypeReindex
+	StatementTypeTruncate
+	StatementTypeCreateMaterializedView
+	StatementTypeRefreshMaterializedView
+	StatementTypeExplain
+	StatementTypeAnalyze
+	StatementTypePrepareTransaction
+	StatementTypeCommitPrepared
+	StatementTypeRollbackPrepared
+	StatementTypeCreateTempTable
 )
 
+var statementTypeNames = [...]string{
+	StatementTypeInsert:                  "insert",
+	StatementTypeSelect:                  "select",
+	StatementTypeInsertSelect:            "insert_select",
+	StatementTypeCreateUser:              "create_user",
+	StatementTypeAlterUser:               "alter_user",
+	StatementTypeCreateRole:              "create_role",
+	StatementTypeGrant:                   "grant",
+	StatementTypeRevoke:                  "revoke",
+	StatementTypeGrantRole:               "grant_role",
+	StatementTypeRevokeRole:              "revoke_role",
+	StatementTypeBegin:                   "begin",
+	StatementTypeCommit:                  "commit",
+	StatementTypeRollback:                "rollback",
+	StatementTypePrepare:                 "prepare",
+	StatementTypeExecute:                 "execute",
+	StatementTypeDeallocate:              "deallocate",
+	StatementTypePragma:                  "pragma",
+	StatementTypeCreateFulltextIndex:     "create_fulltext_index",
+	StatementTypeCreateSequence:          "create_sequence",
+	StatementTypeNextval:                 "nextval",
+	StatementTypeReindex:                 "reindex",
+	StatementTypeTruncate:                "truncate",
+	StatementTypeCreateMaterializedView:  "create_materialized_view",
+	StatementTypeRefreshMaterializedView: "refresh_materialized_view",
+	StatementTypeExplain:                 "explain",
+	StatementTypeAnalyze:                 "analyze",
+	StatementTypePrepareTransaction:      "prepare_transaction",
+	StatementTypeCommitPrepared:          "commit_prepared",
+	StatementTypeRollbackPrepared:        "rollback_prepared",
+	StatementTypeCreateTempTable:         "create_temp_table",
+}
+
+func (t StatementType) String() string {
+	if int(t) < len(statementTypeNames) {
+		return statementTypeNames[t]
+	}
+	return "unknown"
+}
+
+// 语句是否增加或删除行，执行后报告影响的行数
+func (t StatementType) changesRows() bool {
+	switch t {
+	case StatementTypeInsert, StatementTypeInsertSelect, StatementTypeTruncate:
+		return true
+	}
+	return false
+}
+
+func rowsAffected(n int) string {
+	if n == 1 {
+		return "1 row affected"
+	}
+	return fmt.Sprintf("%d rows affected", n)
+}
+
 type Statement struct {
 	Typ         StatementType
+	Text        string
+	TableName   string
+	SourceTable string
+	// select中from TABLE之后的别名
+	TableAlias  string
 	RowToInsert Row
+	UserName    string
+	Password    string
+	Superuser   bool
+	RoleName    string
+	Grantee     string
+	Privileges  []string
+	Name        string
+	Prepared    *Statement
+	// select输出的列，为nil时输出所有列
+	Columns []Projection
+	// select的过滤条件
+	Where *Condition
+	// select的索引提示：indexed by COLUMN 要求使用该列的全文索引，not indexed 禁止使用索引
+	IndexedBy  string
+	NotIndexed bool
+	// select ... as of 读取的时刻，为零值时读取当前的行
+	AsOf time.Time
+	// 只读事务中的select读取事务开始时的快照
+	Snapshot *Snapshot
+	// begin read only
+	ReadOnly bool
+	// 执行语句的会话的临时表
+	Temp map[string]*Table
+	// pragma设置的值，为空表示读取
+	Value string
+	// pragma读取或设置后的值
+	Result string
+	// create fulltext index的列
+	Column string
+	// create sequence的起始值和增量
+	Start     int64
+	Increment int64
+	// 取消后停止扫描和等待锁，为nil时不能取消
+	Ctx context.Context
+	// explain analyze：执行语句并记录实际行数
+	Analyze bool
 }
 
+// RowHandler 依次接收select返回的每一行
+type RowHandler func(row *Row) error
+
 type Table struct {
+	// 并发的查询只持有目录的读锁，页的加载和换出由这把锁串行化
+	mu      sync.Mutex
 	numRows uint32
-	pages   [TABLE_MAX_PAGES]*[PAGE_SIZE]byte
+	pager   *Pager
+	// 插入时检查email列的格式，由pragma check_email设置
+	checkEmail bool
+	// 按列名保存的全文索引
+	fulltext map[string]*FulltextIndex
+	// 已经在提交时写回文件的行数
+	flushedRows uint32
+	// 批量导入中，从第bulkStart行开始的行还没有检查约束和加入索引
+	bulkLoad  bool
+	bulkStart uint32
+	// 每次行改变时增加，用于判断缓存的查询结果是否过期
+	version uint64
+	// 物化视图的行只能由refresh改变
+	materialized bool
+	// analyze收集的每列直方图
+	histograms map[string]*Histogram
+	// id列的布隆过滤器，由pragma bloom_filter打开
+	bloom *BloomFilter
+	// 每次提交后的行数，由pragma history_retention打开
+	history *TableHistory
+	// 冻结了这张表的快照个数
+	snapshots int
 }
 
 type MetaCommandResult int
@@ -59,27 +214,49 @@ type MetaCommandResult int
 const (
 	META_COMMAND_SUCCESS MetaCommandResult = iota
 	META_COMMAND_UNRECOGNIZED
+	META_COMMAND_EXIT
+	// 命令已识别但执行失败，错误已经输出
+	META_COMMAND_FAILED
 )
 
-type PrepareResult int
+func printRows(w io.Writer, stat *Statement) RowHandler {
+	lw := &listWriter{w: w, separator: LIST_SEPARATOR}
+	return func(row *Row) error {
+		return lw.writeRow(stat.project(row))
+	}
+}
 
-const (
-	PREPARE_SUCCESS PrepareResult = iota
-	PREPARE_SYNTAX_ERROR
-	PREPARE_UNRECOGNIZED_STATEMENT
-)
+// 去掉填充的用户名
+func (r *Row) username() string {
+	return strings.TrimRight(string(r.Username[:]), "\x00")
+}
 
-type ExecuteResult int
+func (r *Row) email() string {
+	return strings.TrimRight(string(r.Email[:]), "\x00")
+}
 
-const (
-	EXECUTE_SUCCESS ExecuteResult = iota
-	EXECUTE_TABLE_FULL
-)
+// 检查写入定长列的文本，返回错误信息。列按字节存储，超长的值直接拒绝，
+// 不会在多字节字符中间截断；NUL用作填充，不能出现在值中
+func checkText(column, value string, size int) string {
+	switch {
+	case !utf8.ValidString(value):
+		return column + " is not valid UTF-8"
+	case strings.ContainsRune(value, 0):
+		return column + " contains a NUL character"
+	case len(value) > size:
+		return fmt.Sprintf("%s is too long: %d characters take %d bytes, at most %d bytes fit",
+			column, utf8.RuneCountInString(value), len(value), size)
+	}
+	return ""
+}
 
-func printRow(row *Row) {
-	username := strings.TrimRight(string(row.Username[:]), "\x00")
-	email := strings.TrimRight(string(row.Email[:]), "\x00")
-	fmt.Printf("(%d, %s, %s)\n", row.ID, username, email)
+// 检查email的格式，只接受不带显示名称的地址，例如 alice@example.com
+func checkEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return &Error{Code: ERROR_CONSTRAINT, Msg: fmt.Sprintf("invalid email address '%s'", email)}
+	}
+	return nil
 }
 
 // 序列化：将Row转成字节流
@@ -96,63 +273,244 @@ func deserializeRow(src []byte, dest *Row) {
 	copy(dest.Email[:], src[EMAIL_OFFSET:EMAIL_OFFSET+COLUMN_EMAIL_SIZE])
 }
 
-func NewTable() *Table {
+// 打开数据库文件，filename为空时为纯内存数据库
+func dbOpen(filename string) (*Table, error) {
+	pager, err := openPager(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每页末尾的空隙不存放行，最后一页可能只写了一部分
+	fullPages := uint32(pager.fileLength / PAGE_SIZE)
+	partialRows := uint32(pager.fileLength%PAGE_SIZE) / ROW_SIZE
+
+	numRows := fullPages*ROWS_PER_PAGE + partialRows
 	return &Table{
-		numRows: 0,
-		pages:   [TABLE_MAX_PAGES]*[PAGE_SIZE]byte{},
+		numRows:     numRows,
+		pager:       pager,
+		flushedRows: numRows,
+	}, nil
+}
+
+// 将所有页写回文件并关闭
+func (t *Table) close() error {
+	numFullPages := t.numRows / ROWS_PER_PAGE
+	for i := uint32(0); i < numFullPages; i++ {
+		if err := t.pager.flush(i, PAGE_SIZE); err != nil {
+			return err
+		}
 	}
+
+	numAdditionalRows := t.numRows % ROWS_PER_PAGE
+	if numAdditionalRows > 0 {
+		if err := t.pager.flush(numFullPages, numAdditionalRows*ROW_SIZE); err != nil {
+			return err
+		}
+	}
+
+	// 换出的页中可能有回滚的事务写入的行
+	length := int64(numFullPages)*PAGE_SIZE + int64(numAdditionalRows*ROW_SIZE)
+	if err := t.pager.truncate(length); err != nil {
+		return err
+	}
+	if t.pager.synchronous != SYNCHRONOUS_OFF {
+		if err := t.pager.sync(); err != nil {
+			return err
+		}
+	}
+	return t.pager.close()
 }
 
-func (t *Table) rowSlot(rowNum uint32) []byte {
-	pageNum := rowNum / ROWS_PER_PAGE
-	page := t.pages[pageNum]
+// 第pageNum页中有效数据的字节数
+func (t *Table) pageBytes(pageNum uint32) uint32 {
+	switch full := t.numRows / ROWS_PER_PAGE; {
+	case pageNum < full:
+		return PAGE_SIZE
+	case pageNum == full:
+		return t.numRows % ROWS_PER_PAGE * ROW_SIZE
+	}
+	return 0
+}
 
-	if page == nil {
-		newPage := new([PAGE_SIZE]byte)
-		t.pages[pageNum] = newPage
-		page = newPage
+// 缓存的页数超过cache_size时把最久未使用的页写回文件后换出，keep是正在使用的页。
+// 内存数据库的页只存在于缓存中，不换出
+func (t *Table) evictPages(keep uint32) error {
+	p := t.pager
+	if p.file == nil || p.cacheSize == 0 {
+		return nil
+	}
+	for p.cachedPages() > p.cacheSize {
+		victim, ok := p.leastRecentlyUsed(keep)
+		if !ok {
+			return nil
+		}
+		if err := p.flush(victim, t.pageBytes(victim)); err != nil {
+			return err
+		}
+		if p.synchronous == SYNCHRONOUS_FULL {
+			if err := p.sync(); err != nil {
+				return err
+			}
+		}
+		p.evict(victim)
+	}
+	return nil
+}
+
+func (t *Table) rowSlot(rowNum uint32) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pageNum := rowNum / ROWS_PER_PAGE
+	page, err := t.pager.getPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.evictPages(pageNum); err != nil {
+		return nil, err
 	}
 
 	rowOffset := rowNum % ROWS_PER_PAGE
 	byteOffset := rowOffset * uint32(ROW_SIZE)
 
-	return page[byteOffset : byteOffset+ROW_SIZE]
+	return page[byteOffset : byteOffset+ROW_SIZE], nil
 }
 
-func printPrompt() {
-	fmt.Printf("db > ")
+func printStats(c *Catalog) error {
+	stats, err := c.stats()
+	if err != nil {
+		return err
+	}
+	hits, misses := metricPageCacheHits.Value(), metricPageCacheMisses.Value()
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses) * 100
+	}
+	fmt.Printf("page cache: %d hits, %d misses, %.1f%% hit ratio\n", hits, misses, ratio)
+	fmt.Printf("pages: %d read, %d written\n", metricPagesRead.Value(), metricPagesWritten.Value())
+	results, rows := c.resultCache.size()
+	fmt.Printf("result cache: %d hits, %d misses, %d results with %d rows cached\n",
+		metricResultCacheHits.Value(), metricResultCacheMisses.Value(), results, rows)
+	for _, t := range stats {
+		fmt.Printf("%s: %d rows, %d pages used, %d cached, %d bytes on disk\n",
+			t.name, t.rows, t.usedPages, t.cachedPages, t.fileSize)
+		if t.bloom != nil {
+			fmt.Printf("%s: bloom filter %d lookups, %d skipped, %d false positives\n",
+				t.name, t.bloom.lookups.Load(), t.bloom.skipped.Load(), t.bloom.falsePositives.Load())
+		}
+	}
+	metricStatements.Do(func(kv expvar.KeyValue) {
+		fmt.Printf("%s: %s executed\n", kv.Key, kv.Value)
+	})
+	return nil
+}
+
+// 空语句或者已经能解析的输入是完整的语句，否则继续读取下一行
+func statementComplete(input string) bool {
+	if input == "" {
+		return true
+	}
+	stat := &Statement{}
+	var e *Error
+	return !errors.As(stat.prepareStatement(input), &e) || !e.incomplete()
+}
+
+// ShellOptions 保存交互模式下由元命令设置的选项
+type ShellOptions struct {
+	timer  bool
+	output OutputOptions
+	// .output 打开的文件，为nil时查询结果输出到标准输出
+	outFile *os.File
+}
+
+// 查询结果的输出位置
+func (opts *ShellOptions) writer() io.Writer {
+	if opts.outFile != nil {
+		return opts.outFile
+	}
+	return os.Stdout
+}
+
+// 把之后的查询结果写到文件中，stdout表示恢复为标准输出
+func (opts *ShellOptions) setOutput(filename string) error {
+	var f *os.File
+	if filename != "stdout" {
+		var err error
+		f, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if err := opts.closeOutput(); err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return err
+	}
+	opts.outFile = f
+	return nil
 }
 
-func doMetaCommand(input string) MetaCommandResult {
-	if input == ".exit" {
-		os.Exit(0)
+func (opts *ShellOptions) closeOutput() error {
+	if opts.outFile == nil {
+		return nil
 	}
-	return META_COMMAND_UNRECOGNIZED
+	err := opts.outFile.Close()
+	opts.outFile = nil
+	return err
 }
 
-func (stat *Statement) prepareStatement(input string) PrepareResult {
-	parts := strings.Fields(input)
-	if len(parts) == 0 {
-		return PREPARE_UNRECOGNIZED_STATEMENT
+func (stat *Statement) prepareStatement(input string) error {
+	input, _ = stripComments(input)
+	input = strings.TrimSpace(input)
+	stat.Text = input
+	parts, err := tokenize(input)
+	if err != nil {
+		return &Error{Code: ERROR_SYNTAX, Msg: ErrUnterminatedString.Error(), Pos: utf8.RuneCountInString(input) + 1}
+	}
+	if len(parts) == 0 || parts[0].Quoted {
+		return stat.unrecognized()
 	}
 
-	switch parts[0] {
+	switch parts[0].keyword() {
 	case "insert":
-		if len(parts) < 4 {
-			return PREPARE_SYNTAX_ERROR
+		// insert [into TABLE] id username email
+		stat.TableName = USERS_TABLE
+		if len(parts) > 1 && parts[1].is("into") {
+			if len(parts) < 3 {
+				return stat.syntaxError(parts, 2, "")
+			}
+			stat.TableName = parts[2].Text
+			parts = append(parts[:1], parts[3:]...)
+		}
+		// insert into TABLE select * from TABLE
+		if len(parts) > 1 && parts[1].is("select") {
+			source, bad := prepareSelectSource(parts[1:])
+			if bad >= 0 {
+				return stat.syntaxError(parts, bad+1, "")
+			}
+			stat.Typ = StatementTypeInsertSelect
+			stat.SourceTable = source
+			return nil
+		}
+		if len(parts) != 4 {
+			return stat.syntaxError(parts, min(len(parts), 4), "")
 		}
-		id, err := strconv.ParseUint(parts[1], 10, 32)
+		id, err := strconv.ParseUint(parts[1].Text, 10, 32)
 		if err != nil {
-			return PREPARE_SYNTAX_ERROR
+			return stat.syntaxError(parts, 1, "invalid id")
 		}
 
 		var username [COLUMN_USERNAME_SIZE]byte
 		var email [COLUMN_EMAIL_SIZE]byte
-		if len(parts[2]) > COLUMN_USERNAME_SIZE || len(parts[3]) > COLUMN_EMAIL_SIZE {
-			return PREPARE_SYNTAX_ERROR
+		if msg := checkText("username", parts[2].Text, COLUMN_USERNAME_SIZE); msg != "" {
+			return stat.syntaxError(parts, 2, msg)
+		}
+		if msg := checkText("email", parts[3].Text, COLUMN_EMAIL_SIZE); msg != "" {
+			return stat.syntaxError(parts, 3, msg)
 		}
-		copy(username[:], parts[2])
-		copy(email[:], parts[3])
+		copy(username[:], parts[2].Text)
+		copy(email[:], parts[3].Text)
 		stat.Typ = StatementTypeInsert
 		stat.RowToInsert = Row{
 			ID:       uint32(id),
@@ -160,87 +518,530 @@ func (stat *Statement) prepareStatement(input string) PrepareResult {
 			Email:    email,
 		}
 
-		return PREPARE_SUCCESS
+		return nil
 	case "select":
+		// select nextval('NAME')
+		if len(parts) > 1 && strings.HasPrefix(parts[1].keyword(), "nextval") {
+			return stat.prepareNextval(parts)
+		}
+		// select [* | COLUMN [as ALIAS], ... [from TABLE [ALIAS]]] [as of 'TIME'] [indexed by COLUMN | not indexed] [where COLUMN = VALUE [collate NAME]]
+		where := slices.IndexFunc(parts, func(t Token) bool { return t.is("where") })
+		if where < 0 {
+			where = len(parts)
+		}
+		hint := slices.IndexFunc(parts[:where], func(t Token) bool { return t.is("indexed") || t.is("not") })
+		if hint < 0 {
+			hint = where
+		}
+		// as也用于别名，as of才是读取历史的时刻
+		asOf := hint
+		for i := 1; i+1 < hint; i++ {
+			if parts[i].is("as") && parts[i+1].is("of") {
+				asOf = i
+				break
+			}
+		}
+		if err := stat.prepareSelectList(parts, asOf); err != nil {
+			return err
+		}
+		if asOf < hint {
+			if err := stat.prepareAsOf(parts, asOf, hint); err != nil {
+				return err
+			}
+		}
+		if where < len(parts) {
+			if err := stat.prepareWhere(parts, where); err != nil {
+				return err
+			}
+		}
+		if hint < where {
+			if err := stat.prepareIndexHint(parts, hint, where); err != nil {
+				return err
+			}
+		}
 		stat.Typ = StatementTypeSelect
-		return PREPARE_SUCCESS
+		return nil
+	case "create", "alter":
+		// create fulltext index on TABLE(COLUMN)
+		if parts[0].is("create") && len(parts) > 1 && parts[1].is("fulltext") {
+			return stat.prepareCreateFulltextIndex(parts)
+		}
+		// create materialized view NAME as select ...
+		if parts[0].is("create") && len(parts) > 1 && parts[1].is("materialized") {
+			return stat.prepareCreateMaterializedView(input, parts)
+		}
+		// create temp[orary] table NAME [as select ...]
+		if parts[0].is("create") && len(parts) > 1 && (parts[1].is("temp") || parts[1].is("temporary")) {
+			return stat.prepareCreateTempTable(input, parts)
+		}
+		// create sequence NAME [start [with] N] [increment [by] N]
+		if parts[0].is("create") && len(parts) > 1 && parts[1].is("sequence") {
+			return stat.prepareCreateSequence(parts)
+		}
+		// create role NAME
+		if parts[0].is("create") && len(parts) == 3 && parts[1].is("role") {
+			stat.Typ = StatementTypeCreateRole
+			stat.RoleName = parts[2].Text
+			return nil
+		}
+		// create user NAME password PASSWORD [superuser]
+		if len(parts) > 1 && !parts[1].is("user") {
+			return stat.syntaxError(parts, 1, "")
+		}
+		if len(parts) > 3 && !parts[3].is("password") {
+			return stat.syntaxError(parts, 3, "")
+		}
+		if len(parts) < 5 {
+			return stat.syntaxError(parts, len(parts), "")
+		}
+		stat.Typ = StatementTypeCreateUser
+		if parts[0].is("alter") {
+			stat.Typ = StatementTypeAlterUser
+		}
+		switch {
+		case len(parts) == 6 && parts[0].is("create") && parts[5].is("superuser"):
+			stat.Superuser = true
+		case len(parts) != 5:
+			return stat.syntaxError(parts, 5, "")
+		}
+		stat.UserName = parts[2].Text
+		stat.Password = parts[4].Text
+		return nil
+	case "grant", "revoke":
+		return stat.prepareGrant(parts)
+	case "begin", "commit", "rollback":
+		if len(parts) > 1 && parts[1].is("prepared") {
+			if parts[0].is("commit") {
+				return stat.prepareTwoPhase(parts, StatementTypeCommitPrepared)
+			} else if parts[0].is("rollback") {
+				return stat.prepareTwoPhase(parts, StatementTypeRollbackPrepared)
+			}
+		}
+		// begin [transaction] [read only]
+		n := 1
+		if len(parts) > n && parts[n].is("transaction") {
+			n++
+		}
+		if parts[0].is("begin") && len(parts) > n && parts[n].is("read") {
+			if len(parts) == n+1 || !parts[n+1].is("only") {
+				return stat.syntaxError(parts, n+1, "")
+			}
+			stat.ReadOnly = true
+			n += 2
+		}
+		if len(parts) > n {
+			return stat.syntaxError(parts, n, "")
+		}
+		stat.Typ = map[string]StatementType{
+			"begin":    StatementTypeBegin,
+			"commit":   StatementTypeCommit,
+			"rollback": StatementTypeRollback,
+		}[parts[0].keyword()]
+		return nil
+	case "prepare":
+		if len(parts) > 1 && parts[1].is("transaction") {
+			return stat.prepareTwoPhase(parts, StatementTypePrepareTransaction)
+		}
+		// prepare NAME as STATEMENT
+		if len(parts) > 2 && !parts[2].is("as") {
+			return stat.syntaxError(parts, 2, "")
+		}
+		if len(parts) < 4 {
+			return stat.syntaxError(parts, len(parts), "")
+		}
+		prepared := &Statement{}
+		if err := prepared.prepareStatement(input[parts[3].Pos:]); err != nil {
+			// 错误位置相对于整条语句
+			var e *Error
+			if errors.As(err, &e) && e.Pos > 0 {
+				e.Pos += utf8.RuneCountInString(input[:parts[3].Pos])
+			}
+			return err
+		}
+		switch prepared.Typ {
+		case StatementTypeSelect, StatementTypeInsert, StatementTypeInsertSelect:
+		default:
+			return stat.syntaxError(parts, 3, "only select and insert can be prepared")
+		}
+		stat.Typ = StatementTypePrepare
+		stat.Name = parts[1].Text
+		stat.Prepared = prepared
+		return nil
+	case "pragma":
+		return stat.preparePragma(parts)
+	case "reindex":
+		return stat.prepareReindex(parts)
+	case "explain":
+		return stat.prepareExplain(input, parts)
+	case "analyze":
+		return stat.prepareAnalyze(parts)
+	case "refresh":
+		return stat.prepareRefreshMaterializedView(parts)
+	case "truncate":
+		// truncate [table] TABLE
+		if len(parts) > 1 && parts[1].is("table") {
+			parts = append(parts[:1], parts[2:]...)
+		}
+		if len(parts) != 2 {
+			return stat.syntaxError(parts, min(len(parts), 2), "")
+		}
+		stat.Typ = StatementTypeTruncate
+		stat.TableName = parts[1].Text
+		return nil
+	case "execute", "deallocate":
+		if len(parts) != 2 {
+			return stat.syntaxError(parts, min(len(parts), 2), "")
+		}
+		stat.Typ = StatementTypeExecute
+		if parts[0].is("deallocate") {
+			stat.Typ = StatementTypeDeallocate
+		}
+		stat.Name = parts[1].Text
+		return nil
 	}
 
-	return PREPARE_UNRECOGNIZED_STATEMENT
+	return stat.unrecognized()
 }
 
-func (t *Table) executeInsert(stat *Statement) ExecuteResult {
-	if t.numRows > TABLE_MAX_ROWS {
-		return EXECUTE_TABLE_FULL
+// grant PRIVILEGES on TABLE to NAME
+// revoke PRIVILEGES on TABLE from NAME
+// grant ROLE to USER
+// revoke ROLE from USER
+func (stat *Statement) prepareGrant(parts []Token) error {
+	grant := parts[0].is("grant")
+	target := "to"
+	if !grant {
+		target = "from"
 	}
 
-	rowSlot := t.rowSlot(t.numRows)
-	rowToInsert := &stat.RowToInsert
+	on := slices.IndexFunc(parts, func(t Token) bool { return t.is("on") })
+	if on < 0 {
+		if len(parts) > 2 && !parts[2].is(target) {
+			return stat.syntaxError(parts, 2, "")
+		}
+		if len(parts) != 4 {
+			return stat.syntaxError(parts, min(len(parts), 4), "")
+		}
+		stat.Typ = StatementTypeGrantRole
+		if !grant {
+			stat.Typ = StatementTypeRevokeRole
+		}
+		stat.RoleName = parts[1].Text
+		stat.UserName = parts[3].Text
+		return nil
+	}
+
+	if on < 2 {
+		return stat.syntaxError(parts, on, "")
+	}
+	if len(parts) > on+2 && !parts[on+2].is(target) {
+		return stat.syntaxError(parts, on+2, "")
+	}
+	if len(parts) != on+4 {
+		return stat.syntaxError(parts, min(len(parts), on+4), "")
+	}
+	list := make([]string, 0, on-1)
+	for _, p := range parts[1:on] {
+		list = append(list, p.Text)
+	}
+	privileges, ok := parsePrivileges(strings.Join(list, " "))
+	if !ok {
+		return stat.syntaxError(parts, 1, "unknown privilege")
+	}
+	stat.Typ = StatementTypeGrant
+	if !grant {
+		stat.Typ = StatementTypeRevoke
+	}
+	stat.Privileges = privileges
+	stat.TableName = parts[on+1].Text
+	stat.Grantee = parts[on+3].Text
+	return nil
+}
 
-	serializeRow(rowToInsert, rowSlot)
+// 解析 select [* from TABLE]，返回被查询的表名，出错时返回出错单词的下标
+func prepareSelectSource(parts []Token) (string, int) {
+	if len(parts) == 1 {
+		return USERS_TABLE, -1
+	}
+	switch {
+	case !parts[1].is("*"):
+		return "", 1
+	case len(parts) > 2 && !parts[2].is("from"):
+		return "", 2
+	case len(parts) != 4:
+		return "", min(len(parts), 4)
+	}
+	return parts[3].Text, -1
+}
+
+// 第i个单词处的语法错误，i超出范围表示语句不完整
+func (stat *Statement) syntaxError(parts []Token, i int, msg string) error {
+	if msg == "" {
+		msg = "syntax error"
+	}
+	if i >= len(parts) {
+		return &Error{Code: ERROR_SYNTAX, Msg: msg, Pos: utf8.RuneCountInString(stat.Text) + 1}
+	}
+	return &Error{
+		Code: ERROR_SYNTAX,
+		Msg:  msg,
+		Near: stat.Text[parts[i].Pos:parts[i].End],
+		Pos:  utf8.RuneCountInString(stat.Text[:parts[i].Pos]) + 1,
+	}
+}
+
+func (stat *Statement) unrecognized() error {
+	return &Error{Code: ERROR_UNRECOGNIZED, Msg: fmt.Sprintf("unrecognized keyword at start of '%s'", stat.Text)}
+}
+
+func (t *Table) insertRow(row *Row) error {
+	if t.numRows >= TABLE_MAX_ROWS {
+		return ErrFull
+	}
+	if t.checkEmail && !t.bulkLoad {
+		if err := checkEmail(row.email()); err != nil {
+			return err
+		}
+	}
+	// 先重建过滤器，失败时不插入这一行
+	if t.bloom != nil && t.bloom.full() {
+		if err := t.buildBloomFilter(); err != nil {
+			return err
+		}
+	}
+
+	rowSlot, err := t.rowSlot(t.numRows)
+	if err != nil {
+		return err
+	}
+
+	serializeRow(row, rowSlot)
+	if t.bloom != nil {
+		t.bloom.add(row.ID)
+	}
+	if !t.bulkLoad {
+		for _, idx := range t.fulltext {
+			idx.add(t.numRows, row)
+		}
+	}
 	t.numRows++
+	t.version++
+
+	return nil
+}
+
+func (t *Table) executeInsert(stat *Statement) (int, error) {
+	if err := t.insertRow(&stat.RowToInsert); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// 将源表的所有行复制到目标表，源表和目标表可以位于不同的数据库文件。
+// 任何一行失败时撤销已经复制的行
+func (t *Table) executeInsertSelect(source *Table) (int, error) {
+	// 先确定行数，避免源表和目标表相同时无限复制
+	numRows := source.numRows
+	saved := t.numRows
+	var row Row
+	for i := uint32(0); i < numRows; i++ {
+		rowSlot, err := source.rowSlot(i)
+		if err == nil {
+			deserializeRow(rowSlot, &row)
+			err = t.insertRow(&row)
+		}
+		if err != nil {
+			t.rewind(saved)
+			return 0, err
+		}
+	}
+	return int(numRows), nil
+}
+
+// 一次丢弃表中所有的行：把文件截断为空并清空页缓存，返回删除的行数
+func (t *Table) executeTruncate() (int, error) {
+	if t.snapshots > 0 {
+		return 0, fmt.Errorf("table is %w", ErrInUseBySnapshot)
+	}
+	if err := t.pager.truncate(0); err != nil {
+		return 0, err
+	}
+	for pageNum, page := range t.pager.pages {
+		if page != nil {
+			t.pager.evict(uint32(pageNum))
+		}
+	}
+	numRows := t.numRows
+	t.rewind(0)
+	return int(numRows), nil
+}
 
-	return EXECUTE_SUCCESS
+func (t *Table) executeSelect(handle RowHandler) error {
+	return t.scanRows(t.numRows, handle)
 }
 
-func (t *Table) executeSelect() ExecuteResult {
+// 依次读取前numRows行
+func (t *Table) scanRows(numRows uint32, handle RowHandler) error {
 	var row Row
-	for i := uint32(0); i < t.numRows; i++ {
-		rowSlot := t.rowSlot(i)
+	for i := uint32(0); i < numRows; i++ {
+		rowSlot, err := t.rowSlot(i)
+		if err != nil {
+			return err
+		}
 		deserializeRow(rowSlot, &row)
-		printRow(&row)
+		if err := handle(&row); err != nil {
+			return err
+		}
 	}
-	return EXECUTE_SUCCESS
+	return nil
 }
 
-func (t *Table) executeStatement(stat *Statement) ExecuteResult {
+// 执行语句，返回写语句影响的行数
+func (c *Catalog) executeStatement(stat *Statement, handle RowHandler) (rows int, err error) {
+	// 查询之间可以并行，其他语句独占目录
+	if stat.Typ == StatementTypeSelect {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	} else {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	}
+
+	defer func(start time.Time) {
+		slog.Debug("statement executed", "statement", redactStatement(stat),
+			"rows", rows, "duration", time.Since(start), "error", err)
+	}(time.Now())
+
+	switch stat.Typ {
+	case StatementTypeCreateUser:
+		return 0, c.executeCreateUser(stat)
+	case StatementTypeAlterUser:
+		return 0, c.executeAlterUser(stat)
+	case StatementTypeCreateRole:
+		return 0, c.executeCreateRole(stat)
+	case StatementTypeGrant:
+		return 0, c.executeGrant(stat)
+	case StatementTypeRevoke:
+		return 0, c.executeRevoke(stat)
+	case StatementTypeGrantRole:
+		return 0, c.executeGrantRole(stat, true)
+	case StatementTypeRevokeRole:
+		return 0, c.executeGrantRole(stat, false)
+	case StatementTypePragma:
+		return 0, c.executePragma(stat)
+	case StatementTypeCreateSequence:
+		return 0, c.executeCreateSequence(stat)
+	case StatementTypeNextval:
+		return 0, c.executeNextval(stat)
+	case StatementTypeReindex:
+		return 0, c.executeReindex(stat)
+	case StatementTypeAnalyze:
+		return 0, c.executeAnalyze(stat)
+	case StatementTypeCreateMaterializedView:
+		return c.executeCreateMaterializedView(stat)
+	case StatementTypeRefreshMaterializedView:
+		return c.executeRefreshMaterializedView(stat)
+	}
+
+	resolve := c.resolve
+	switch stat.Typ {
+	case StatementTypeInsert, StatementTypeInsertSelect, StatementTypeTruncate:
+		resolve = c.resolveWritable
+	}
+	t, err := stat.table(stat.TableName, resolve)
+	if err != nil {
+		return 0, err
+	}
+	if stat.Typ != StatementTypeSelect {
+		defer t.recordHistory()
+	}
+
 	switch stat.Typ {
 	case StatementTypeInsert:
 		return t.executeInsert(stat)
 	case StatementTypeSelect:
-		return t.executeSelect()
+		return 0, c.cachedSelect(stat, t, handle, func(handle RowHandler) error {
+			return c.selectRows(stat, t, handle)
+		})
+	case StatementTypeCreateFulltextIndex:
+		return 0, t.createFulltextIndex(stat.Column)
+	case StatementTypeInsertSelect:
+		source, err := stat.table(stat.SourceTable, c.resolve)
+		if err != nil {
+			return 0, err
+		}
+		return t.executeInsertSelect(source)
+	case StatementTypeTruncate:
+		return t.executeTruncate()
 	}
-	return EXECUTE_SUCCESS
+	return 0, nil
 }
 
-func main() {
-	reader := bufio.NewReader(os.Stdin)
-	t := NewTable()
-
-	for {
-		printPrompt()
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			break
+// 执行查询，有全文搜索条件时通过索引查找，按id查找时先检查布隆过滤器
+func (c *Catalog) selectRows(stat *Statement, t *Table, handle RowHandler) error {
+	numRows := t.numRows
+	if stat.Snapshot != nil {
+		numRows = stat.Snapshot.numRows(t)
+	}
+	if !stat.AsOf.IsZero() {
+		var err error
+		if numRows, err = t.rowsAsOf(stat.AsOf); err != nil {
+			return err
 		}
-		input = strings.TrimSpace(input)
+	}
+	if stat.Where != nil && stat.Where.Match && !stat.NotIndexed {
+		return t.executeMatch(stat.Where, numRows, c.withTimeout(withContext(stat.Ctx, handle)))
+	}
+	if t.bloom != nil && stat.Where != nil && stat.Where.Column == "id" {
+		id, _ := strconv.ParseUint(stat.Where.Value, 10, 32)
+		return t.bloom.lookup(uint32(id), handle, func(handle RowHandler) error {
+			return t.scanRows(numRows, c.withTimeout(withContext(stat.Ctx, stat.Where.filter(handle))))
+		})
+	}
+	return t.scanRows(numRows, c.withTimeout(withContext(stat.Ctx, stat.Where.filter(handle))))
+}
 
-		if strings.HasPrefix(input, ".") {
-			switch doMetaCommand(input) {
-			case META_COMMAND_SUCCESS:
-				continue
-			case META_COMMAND_UNRECOGNIZED:
-				fmt.Printf("Unrecognized command '%s'.\n", input)
-				continue
-			}
+// 每读取一行检查语句是否已被取消
+func withContext(ctx context.Context, handle RowHandler) RowHandler {
+	if ctx == nil {
+		return handle
+	}
+	return func(row *Row) error {
+		if ctx.Err() != nil {
+			return ErrInterrupted
 		}
+		return handle(row)
+	}
+}
 
-		stat := &Statement{}
-		switch stat.prepareStatement(input) {
-		case PREPARE_SYNTAX_ERROR:
-			fmt.Println("Syntax error. Could not parse statement.")
-			continue
-		case PREPARE_UNRECOGNIZED_STATEMENT:
-			fmt.Printf("Unrecognized keyword at start of '%s'.\n", input)
-			continue
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := runServe(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			os.Exit(1)
 		}
-
-		switch t.executeStatement(stat) {
-		case EXECUTE_SUCCESS:
-			fmt.Println("Executed.")
-		case EXECUTE_TABLE_FULL:
-			fmt.Println("Error: Table full.")
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			os.Exit(1)
 		}
-
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "crashtest" {
+		if err := runCrashtest(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "salvage" {
+		if err := runSalvage(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			os.Exit(1)
+		}
+		return
 	}
+	os.Exit(runShell(os.Args[1:]))
 }
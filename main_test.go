@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestInsertSelectFailureKeepsNoRows(t *testing.T) {
+	c := openTestCatalog(t)
+	if err := c.attach(filepath.Join(t.TempDir(), "aux.db"), "aux"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert into aux.users 1 alice alice@example.com")
+	execTest(t, s, "insert into aux.users 2 bob not-an-email")
+	execTest(t, s, "pragma check_email = on")
+
+	stat := &Statement{}
+	if err := stat.prepareStatement("insert into main.users select * from aux.users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.execute(stat, nil); err == nil {
+		t.Fatal("insert select of an invalid email succeeded")
+	}
+	if got := execTest(t, s, "select * from main.users"); len(got) != 0 {
+		t.Errorf("failed insert select left rows %v", got)
+	}
+}
+
+func TestInsertSelectAcrossDatabases(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.attach(filepath.Join(dir, "aux.db"), "aux"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "insert into aux.users 2 bob bob@example.com")
+	execTest(t, s, "insert into aux.users 3 carol carol@example.com")
+
+	if n := execTestCount(t, s, "insert into users select * from aux.users"); n != 2 {
+		t.Errorf("insert select copied %d rows, want 2", n)
+	}
+	if n := execTestCount(t, s, "insert into aux.users select * from main.users"); n != 3 {
+		t.Errorf("copy back copied %d rows, want 3", n)
+	}
+	s.close()
+
+	// 复制的行在重新打开后仍然存在
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := execTest(t, s, "select * from users"); !slices.Equal(got, []uint32{1, 2, 3}) {
+		t.Errorf("main rows after reopen %v, want [1 2 3]", got)
+	}
+}
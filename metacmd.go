@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MetaCommand 是以点开头的命令，.help 根据注册表输出帮助
+type MetaCommand struct {
+	name string
+	// 参数格式，用于帮助和用法提示
+	args string
+	help string
+	run  func(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult
+}
+
+// 参数不正确时输出用法
+func (m *MetaCommand) usage() MetaCommandResult {
+	fmt.Println(strings.TrimSpace("Usage: " + m.name + " " + m.args))
+	return META_COMMAND_FAILED
+}
+
+// 按名称排序的元命令，在init中注册以便.help可以引用注册表
+var metaCommands []*MetaCommand
+
+// .help 中列出的语句格式
+var STATEMENT_FORMS = []struct{ form, help string }{
+	{"insert [into TABLE] ID USERNAME EMAIL", "insert a row"},
+	{"insert into TABLE select * from TABLE", "copy all rows from another table"},
+	{"select [* from TABLE] [where COLUMN = VALUE [collate NAME]]", "print the rows of a table"},
+	{"select COLUMN|FUNC(COLUMN), ... [from TABLE] [where ...]", "print only some columns, FUNC is upper, lower or length"},
+	{"select COLUMN [as] ALIAS, ... from TABLE [as] ALIAS", "rename output columns, qualify columns as ALIAS.COLUMN"},
+	{"select [* from TABLE] where COLUMN match 'TERM [PREFIX*] ...'", "search a fulltext index, best matches first"},
+	{"select [* from TABLE] as of 'TIME' [where ...]", "read the rows committed by TIME, see pragma history_retention"},
+	{"select [* from TABLE] indexed by COLUMN | not indexed where ...", "require or bypass the fulltext index on a column"},
+	{"truncate [table] TABLE", "delete all rows of a table at once"},
+	{"create fulltext index on TABLE(COLUMN)", "index the words of a text column"},
+	{"reindex [TABLE[(COLUMN)]]", "rebuild fulltext indexes from the table"},
+	{"create materialized view NAME as SELECT", "store the result of a select as a table"},
+	{"create temp[orary] table NAME [as SELECT]", "create a table that lasts until the session ends"},
+	{"refresh materialized view NAME", "recompute a materialized view"},
+	{"create sequence NAME [start N] [increment N]", "create a sequence"},
+	{"select nextval('NAME')", "take the next value of a sequence"},
+	{"create user NAME password PASSWORD [superuser]", "create a user"},
+	{"alter user NAME password PASSWORD", "change the password of a user"},
+	{"create role NAME", "create a role"},
+	{"grant PRIVILEGES on TABLE to NAME", "grant privileges to a user or role"},
+	{"revoke PRIVILEGES on TABLE from NAME", "revoke privileges from a user or role"},
+	{"grant ROLE to USER / revoke ROLE from USER", "add or remove a role member"},
+	{"begin / commit / rollback [transaction]", "control a transaction"},
+	{"begin [transaction] read only", "read a snapshot taken at begin, without locks"},
+	{"prepare transaction 'ID'", "end a transaction, keeping its rows for two-phase commit"},
+	{"commit prepared 'ID' / rollback prepared 'ID'", "finish a prepared transaction"},
+	{"prepare NAME as STATEMENT", "prepare a select or insert"},
+	{"execute NAME / deallocate NAME", "run or drop a prepared statement"},
+	{"pragma NAME [= VALUE]", "show or change a setting"},
+	{"analyze [TABLE]", "collect column histograms used by explain"},
+	{"explain [(format text|json[, analyze])] STATEMENT", "show the plan of a statement"},
+}
+
+func init() {
+	metaCommands = []*MetaCommand{
+		{name: ".attach", args: "FILENAME as NAME", help: "attach a database file under NAME", run: metaAttach},
+		{name: ".bench", args: "insert|select [N]", help: "measure insert or full scan throughput on a scratch table", run: metaBench},
+		{name: ".databases", help: "list attached databases", run: metaDatabases},
+		{name: ".dbinfo", args: "[DATABASE]", help: "show file-level details of a database", run: metaDBInfo},
+		{name: ".detach", args: "NAME", help: "detach a database", run: metaDetach},
+		{name: ".exit", help: "exit this program", run: func([]string, *Catalog, *ShellOptions) MetaCommandResult {
+			return META_COMMAND_EXIT
+		}},
+		{name: ".export", args: "[--format arrow|parquet] FILENAME [SELECT ...]", help: "write query results, by default the whole users table, to FILENAME", run: metaExport},
+		{name: ".headers", args: "on|off", help: "print column names in list and csv mode", run: metaHeaders},
+		{name: ".help", help: "show this message", run: metaHelp},
+		{name: ".import", args: "[--format parquet] FILENAME [TABLE] [COLUMN=SOURCE ...]", help: "insert the rows of FILENAME into TABLE in one transaction", run: metaImport},
+		{name: ".kv", args: "[--bucket NAME] get KEY | put KEY VALUE | delete KEY | scan [START [END]] | buckets | drop NAME", help: "read and write the key-value store and its buckets without SQL", run: metaKV},
+		{name: ".mode", args: strings.Join(OUTPUT_MODES, "|"), help: "set the output mode", run: metaMode},
+		{name: ".nullvalue", args: "STRING", help: "print STRING in place of NULL values", run: metaNullValue},
+		{name: ".output", args: "[FILENAME|stdout]", help: "send query results to a file or back to stdout", run: metaOutput},
+		{name: ".schema", args: "[TABLE]", help: "show CREATE TABLE statements", run: metaSchema},
+		{name: ".separator", args: "[STRING]", help: "set the column separator for list and csv mode", run: metaSeparator},
+		{name: ".stats", help: "show page cache, I/O and statement counters", run: metaStats},
+		{name: ".tables", help: "list tables", run: metaTables},
+		{name: ".timer", args: "on|off", help: "report the run time of each statement", run: metaTimer},
+		{name: ".width", args: "N", help: "truncate displayed values to N characters, 0 for no limit", run: metaWidth},
+	}
+}
+
+func findMetaCommand(name string) *MetaCommand {
+	i := slices.IndexFunc(metaCommands, func(m *MetaCommand) bool { return m.name == name })
+	if i < 0 {
+		return nil
+	}
+	return metaCommands[i]
+}
+
+// 所有元命令的名称，用于补全
+func metaCommandNames() []string {
+	names := make([]string, len(metaCommands))
+	for i, m := range metaCommands {
+		names[i] = m.name
+	}
+	return names
+}
+
+func doMetaCommand(input string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	parts := strings.Fields(input)
+	m := findMetaCommand(parts[0])
+	if m == nil {
+		return META_COMMAND_UNRECOGNIZED
+	}
+	return m.run(parts[1:], c, opts)
+}
+
+func metaHelp(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	width := 0
+	for _, m := range metaCommands {
+		width = max(width, len(m.name)+1+len(m.args))
+	}
+	for _, m := range metaCommands {
+		fmt.Printf("%-*s  %s\n", width, strings.TrimSpace(m.name+" "+m.args), m.help)
+	}
+	fmt.Println()
+	width = 0
+	for _, s := range STATEMENT_FORMS {
+		width = max(width, len(s.form))
+	}
+	for _, s := range STATEMENT_FORMS {
+		fmt.Printf("%-*s  %s\n", width, s.form, s.help)
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaAttach(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) != 3 || args[1] != "as" {
+		return findMetaCommand(".attach").usage()
+	}
+	if err := c.attach(args[0], args[2]); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaDetach(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) != 1 {
+		return findMetaCommand(".detach").usage()
+	}
+	if err := c.detach(args[0]); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaDatabases(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	for _, db := range c.list() {
+		filename := db.filename
+		if filename == "" {
+			filename = ":memory:"
+		}
+		fmt.Printf("%s: %s\n", db.name, filename)
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaTables(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	for _, name := range c.tables() {
+		fmt.Println(name)
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaSchema(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) > 1 {
+		return findMetaCommand(".schema").usage()
+	}
+	schemas, err := c.schema(strings.Join(args, ""))
+	if err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	for _, schema := range schemas {
+		fmt.Println(schema)
+	}
+	return META_COMMAND_SUCCESS
+}
+
+// 解析on|off参数
+func onOff(args []string) (bool, bool) {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return false, false
+	}
+	return args[0] == "on", true
+}
+
+func metaTimer(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	on, ok := onOff(args)
+	if !ok {
+		return findMetaCommand(".timer").usage()
+	}
+	opts.timer = on
+	return META_COMMAND_SUCCESS
+}
+
+func metaMode(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) == 0 {
+		fmt.Printf("current output mode: %s\n", opts.output.mode)
+		return META_COMMAND_SUCCESS
+	}
+	if len(args) != 1 || !slices.Contains(OUTPUT_MODES, args[0]) {
+		return findMetaCommand(".mode").usage()
+	}
+	opts.output.mode = args[0]
+	return META_COMMAND_SUCCESS
+}
+
+func metaHeaders(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	on, ok := onOff(args)
+	if !ok {
+		return findMetaCommand(".headers").usage()
+	}
+	opts.output.headers = on
+	return META_COMMAND_SUCCESS
+}
+
+func metaNullValue(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) > 1 {
+		return findMetaCommand(".nullvalue").usage()
+	}
+	opts.output.nullValue = strings.Join(args, "")
+	return META_COMMAND_SUCCESS
+}
+
+// 不带参数时恢复默认分隔符
+func metaSeparator(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) > 1 {
+		return findMetaCommand(".separator").usage()
+	}
+	opts.output.separator = strings.Join(args, "")
+	return META_COMMAND_SUCCESS
+}
+
+func metaWidth(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) != 1 {
+		return findMetaCommand(".width").usage()
+	}
+	width, err := strconv.Atoi(args[0])
+	if err != nil || width < 0 {
+		return findMetaCommand(".width").usage()
+	}
+	opts.output.maxWidth = width
+	return META_COMMAND_SUCCESS
+}
+
+func metaOutput(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) > 1 {
+		return findMetaCommand(".output").usage()
+	}
+	filename := "stdout"
+	if len(args) == 1 {
+		filename = args[0]
+	}
+	if err := opts.setOutput(filename); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaBench(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if len(args) == 0 || len(args) > 2 {
+		return findMetaCommand(".bench").usage()
+	}
+	n := BENCH_DEFAULT_INSERTS
+	if args[0] == "select" {
+		n = BENCH_DEFAULT_SCANS
+	}
+	if len(args) == 2 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+			return findMetaCommand(".bench").usage()
+		}
+	}
+	if err := runBench(args[0], n); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaStats(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	if err := printStats(c); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaExport(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	format := EXPORT_FORMATS[0]
+	if len(args) >= 2 && args[0] == "--format" {
+		format, args = args[1], args[2:]
+	}
+	if len(args) == 0 || !slices.Contains(EXPORT_FORMATS, format) {
+		return findMetaCommand(".export").usage()
+	}
+	query := "select * from " + USERS_TABLE
+	if len(args) > 1 {
+		query = strings.Join(args[1:], " ")
+	}
+	if err := exportFile(c, format, args[0], query); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
+
+func metaImport(args []string, c *Catalog, opts *ShellOptions) MetaCommandResult {
+	format := IMPORT_FORMATS[0]
+	if len(args) >= 2 && args[0] == "--format" {
+		format, args = args[1], args[2:]
+	}
+	if len(args) == 0 || !slices.Contains(IMPORT_FORMATS, format) {
+		return findMetaCommand(".import").usage()
+	}
+	table, mappings := USERS_TABLE, args[1:]
+	if len(mappings) > 0 && !strings.Contains(mappings[0], "=") {
+		table, mappings = mappings[0], mappings[1:]
+	}
+	if err := importFile(c, format, args[0], table, mappings); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return META_COMMAND_FAILED
+	}
+	return META_COMMAND_SUCCESS
+}
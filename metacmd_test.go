@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMetaCommandsSetOutputOptions(t *testing.T) {
+	c := openTestCatalog(t)
+	var opts ShellOptions
+	for _, tc := range []struct {
+		input string
+		want  MetaCommandResult
+	}{
+		{".mode csv", META_COMMAND_SUCCESS},
+		{".mode xml", META_COMMAND_FAILED},
+		{".headers on", META_COMMAND_SUCCESS},
+		{".headers yes", META_COMMAND_FAILED},
+		{".separator ;", META_COMMAND_SUCCESS},
+		{".nullvalue NULL", META_COMMAND_SUCCESS},
+		{".width 8", META_COMMAND_SUCCESS},
+		{".width -1", META_COMMAND_FAILED},
+		{".timer on", META_COMMAND_SUCCESS},
+		{".bogus", META_COMMAND_UNRECOGNIZED},
+	} {
+		if got := doMetaCommand(tc.input, c, &opts); got != tc.want {
+			t.Errorf("%s: result %d, want %d", tc.input, got, tc.want)
+		}
+	}
+	want := OutputOptions{mode: OUTPUT_MODE_CSV, headers: true, separator: ";", nullValue: "NULL", maxWidth: 8}
+	if opts.output != want || !opts.timer {
+		t.Errorf("options %+v, want %+v with the timer on", opts, want)
+	}
+	// 不带参数时恢复默认分隔符
+	doMetaCommand(".separator", c, &opts)
+	if opts.output.separator != "" {
+		t.Errorf("separator %q after reset", opts.output.separator)
+	}
+}
+
+func TestMetaAttachDetach(t *testing.T) {
+	c := openTestCatalog(t)
+	var opts ShellOptions
+	filename := filepath.Join(t.TempDir(), "aux.db")
+	if got := doMetaCommand(".attach "+filename+" as aux", c, &opts); got != META_COMMAND_SUCCESS {
+		t.Fatalf(".attach: result %d", got)
+	}
+	if got := doMetaCommand(".attach "+filename+" aux", c, &opts); got != META_COMMAND_FAILED {
+		t.Errorf(".attach without as: result %d", got)
+	}
+	if len(c.list()) != 2 {
+		t.Errorf("%d databases after attach, want 2", len(c.list()))
+	}
+	if got := doMetaCommand(".detach aux", c, &opts); got != META_COMMAND_SUCCESS {
+		t.Errorf(".detach: result %d", got)
+	}
+	if got := doMetaCommand(".detach aux", c, &opts); got != META_COMMAND_FAILED {
+		t.Errorf(".detach of a detached database: result %d", got)
+	}
+}
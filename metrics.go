@@ -0,0 +1,68 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// 引擎的计数器通过expvar发布，服务模式下可以用 --metrics 开启
+// /debug/vars (expvar JSON) 和 /metrics (Prometheus文本格式)
+var (
+	metricStatements         = expvar.NewMap("statements_executed")
+	metricPageCacheHits      = expvar.NewInt("page_cache_hits")
+	metricPageCacheMisses    = expvar.NewInt("page_cache_misses")
+	metricPagesRead          = expvar.NewInt("pages_read")
+	metricPagesWritten       = expvar.NewInt("pages_written")
+	metricActiveTransactions = expvar.NewInt("active_transactions")
+	metricActiveConnections  = expvar.NewInt("active_connections")
+	metricSyncedCommits      = expvar.NewInt("synced_commits")
+	metricCommitSyncs        = expvar.NewInt("commit_syncs")
+	metricResultCacheHits    = expvar.NewInt("result_cache_hits")
+	metricResultCacheMisses  = expvar.NewInt("result_cache_misses")
+)
+
+type prometheusMetric struct {
+	name string
+	typ  string
+	help string
+	v    *expvar.Int
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{"golitedb_page_cache_hits_total", "counter", "Page lookups served from the page cache.", metricPageCacheHits},
+	{"golitedb_page_cache_misses_total", "counter", "Page lookups that had to load the page.", metricPageCacheMisses},
+	{"golitedb_pages_read_total", "counter", "Pages read from database files.", metricPagesRead},
+	{"golitedb_pages_written_total", "counter", "Pages written to database files.", metricPagesWritten},
+	{"golitedb_active_transactions", "gauge", "Transactions currently open.", metricActiveTransactions},
+	{"golitedb_active_connections", "gauge", "Client connections currently open.", metricActiveConnections},
+	{"golitedb_synced_commits_total", "counter", "Commits made durable with synchronous=full.", metricSyncedCommits},
+	{"golitedb_commit_syncs_total", "counter", "File syncs issued to make commits durable.", metricCommitSyncs},
+	{"golitedb_result_cache_hits_total", "counter", "Selects answered from the result cache.", metricResultCacheHits},
+	{"golitedb_result_cache_misses_total", "counter", "Selects that found no valid cached result.", metricResultCacheMisses},
+}
+
+func metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writePrometheus(w)
+	})
+	return mux
+}
+
+func writePrometheus(w io.Writer) {
+	fmt.Fprintln(w, "# HELP golitedb_statements_total Statements executed by type.")
+	fmt.Fprintln(w, "# TYPE golitedb_statements_total counter")
+	metricStatements.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "golitedb_statements_total{type=%q} %s\n", kv.Key, kv.Value)
+	})
+
+	for _, m := range prometheusMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		fmt.Fprintf(w, "%s %d\n", m.name, m.v.Value())
+	}
+}
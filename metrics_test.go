@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "select * from users")
+
+	w := httptest.NewRecorder()
+	metricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics: status %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type %q, want text/plain", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE golitedb_statements_total counter\n",
+		`golitedb_statements_total{type="insert"} `,
+		`golitedb_statements_total{type="select"} `,
+		"# TYPE golitedb_active_transactions gauge\n",
+		"golitedb_pages_written_total ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output is missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 已执行的迁移保存在main数据库的 FILENAME-migrations 键值表中，
+// 键是版本号，值是 "文件名,执行时间"
+const MIGRATIONS_FILE_SUFFIX = "-migrations"
+
+func (db *Database) migrationsTable() (*KVTable, error) {
+	return db.sidecar(MIGRATIONS_FILE_SUFFIX)
+}
+
+func (c *Catalog) migrations() (*KVTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.databases[MAIN_DATABASE].migrationsTable()
+}
+
+// Migration 是目录中的一个迁移文件，文件名以版本号开头，例如 0003_add_admins.sql
+type Migration struct {
+	version  uint64
+	filename string
+}
+
+// 按版本号排序目录中的.sql文件，版本号重复时报错
+func readMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		digits := strings.TrimLeft(name, "0123456789")
+		version, err := strconv.ParseUint(name[:len(name)-len(digits)], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version number", name)
+		}
+		migrations = append(migrations, Migration{version: version, filename: name})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.version, b.version)
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version",
+				migrations[i-1].filename, migrations[i].filename)
+		}
+	}
+	return migrations, nil
+}
+
+// golitedb migrate DIR [FILENAME]
+// 按版本号依次执行还没有执行过的迁移，可以重复运行。
+// 一个迁移中的语句逐条自动提交，失败时停止，这个迁移不会记录为已执行
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("usage: golitedb migrate DIR [FILENAME]")
+	}
+	dir := fs.Arg(0)
+	migrations, err := readMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	c, err := NewCatalog(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	applied, err := c.migrations()
+	if err != nil {
+		return err
+	}
+
+	session := NewSession(c, "", "local")
+	defer session.close()
+	count := 0
+	for _, m := range migrations {
+		key := []byte(strconv.FormatUint(m.version, 10))
+		if _, ok, err := applied.Get(key); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		if err := runMigration(session, filepath.Join(dir, m.filename)); err != nil {
+			return fmt.Errorf("migration %s: %w", m.filename, err)
+		}
+		value := m.filename + "," + time.Now().UTC().Format(time.RFC3339)
+		if err := applied.Put(key, []byte(value)); err != nil {
+			return err
+		}
+		fmt.Printf("applied %s\n", m.filename)
+		count++
+	}
+	fmt.Printf("%d migrations applied, %d already applied\n", count, len(migrations)-count)
+	return nil
+}
+
+func runMigration(session *Session, filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	input, closed := stripComments(string(data))
+	if !closed {
+		return fmt.Errorf("unterminated block comment")
+	}
+	for i, text := range splitStatements(input) {
+		if text == "" {
+			continue
+		}
+		stat := &Statement{}
+		if err := stat.prepareStatement(text); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if _, err := session.execute(stat, func(*Row) error { return nil }); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	if session.inTransaction() {
+		return fmt.Errorf("transaction was not committed")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateAppliesEachMigrationOnce(t *testing.T) {
+	dir := t.TempDir()
+	migrations := filepath.Join(dir, "migrations")
+	if err := os.Mkdir(migrations, 0755); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "test.db")
+	writeTestFile(t, filepath.Join(migrations, "0001_users.sql"), "-- 初始用户\ninsert 1 alice alice@example.com;\ninsert 2 bob bob@example.com;\n")
+	writeTestFile(t, filepath.Join(migrations, "0002_broken.sql"), "insert 3 carol carol@example.com;\nselect * from nowhere.users;\n")
+
+	if err := runMigrate([]string{migrations, filename}); err == nil {
+		t.Fatal("broken migration succeeded")
+	}
+	// 修好后重新运行，只执行失败的迁移
+	writeTestFile(t, filepath.Join(migrations, "0002_broken.sql"), "insert 4 dave dave@example.com;\n")
+	if err := runMigrate([]string{migrations, filename}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runMigrate([]string{migrations, filename}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	s := NewSession(c, "", "test")
+	defer s.close()
+	// 失败的迁移中已经自动提交的语句不会撤销
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1, 2, 3, 4}) {
+		t.Errorf("ids after migrating %v, want [1 2 3 4]", got)
+	}
+	applied, err := c.migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied.Len() != 2 {
+		t.Errorf("%d migrations recorded, want 2", applied.Len())
+	}
+}
+
+func TestReadMigrationsRejectsDuplicateVersions(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1_a.sql"), "")
+	writeTestFile(t, filepath.Join(dir, "01_b.sql"), "")
+	if _, err := readMigrations(dir); err == nil {
+		t.Error("duplicate versions were accepted")
+	}
+	os.Remove(filepath.Join(dir, "01_b.sql"))
+	writeTestFile(t, filepath.Join(dir, "notes.txt"), "")
+	writeTestFile(t, filepath.Join(dir, "10_c.sql"), "")
+	writeTestFile(t, filepath.Join(dir, "2_b.sql"), "")
+	migrations, err := readMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.filename)
+	}
+	if want := []string{"1_a.sql", "2_b.sql", "10_c.sql"}; !slices.Equal(names, want) {
+		t.Errorf("migrations %v, want %v", names, want)
+	}
+	writeTestFile(t, filepath.Join(dir, "init.sql"), "")
+	if _, err := readMigrations(dir); err == nil {
+		t.Error("migration without a version was accepted")
+	}
+}
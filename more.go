@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ErrOutputAborted 表示用户在分页时按q放弃了剩余的查询结果
+var ErrOutputAborted = fmt.Errorf("output aborted")
+
+// moreWriter 像more一样分页输出，每输出一屏等待用户按键：
+// 空格显示下一屏，回车显示下一行，q放弃剩余的输出
+type moreWriter struct {
+	w      io.Writer
+	editor *LineEditor
+	// 每屏的行数，最后一行用于显示提示
+	height int
+	lines  int
+}
+
+func newMoreWriter(w io.Writer, editor *LineEditor, height int) *moreWriter {
+	return &moreWriter{w: w, editor: editor, height: height - 1}
+}
+
+func (mw *moreWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if mw.lines >= mw.height {
+			if err := mw.wait(); err != nil {
+				return written, err
+			}
+		}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+			mw.lines++
+		}
+		n, err := mw.w.Write(line)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(line):]
+	}
+	return written, nil
+}
+
+func (mw *moreWriter) wait() error {
+	fmt.Fprint(mw.w, "--More--")
+	for {
+		r, err := mw.editor.readKey()
+		fmt.Fprint(mw.w, "\r\x1b[K")
+		if err != nil {
+			return err
+		}
+		switch r {
+		case ' ':
+			mw.lines = 0
+			return nil
+		case keyEnter, keyNewline:
+			mw.lines--
+			return nil
+		case 'q', 'Q', keyCtrlC:
+			return ErrOutputAborted
+		}
+		fmt.Fprint(mw.w, "--More--")
+	}
+}
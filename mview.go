@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// 物化视图的定义保存在数据库的 FILENAME-mviews 键值表中，键是视图名，值是查询语句。
+// 视图的行保存在 FILENAME-mviews-NAME 中，格式与users表相同，只能通过refresh改变
+const MVIEW_FILE_SUFFIX = "-mviews"
+
+var (
+	ErrTableExists       = fmt.Errorf("table already exists")
+	ErrMaterializedWrite = fmt.Errorf("cannot modify materialized view")
+)
+
+type MaterializedView struct {
+	query string
+	table *Table
+}
+
+// create materialized view NAME as select ...
+func (stat *Statement) prepareCreateMaterializedView(input string, parts []Token) error {
+	if len(parts) < 3 || !parts[2].is("view") {
+		return stat.syntaxError(parts, 2, "")
+	}
+	if len(parts) < 5 || !parts[4].is("as") {
+		return stat.syntaxError(parts, min(len(parts), 4), "")
+	}
+	if len(parts) < 6 {
+		return stat.syntaxError(parts, 5, "")
+	}
+	if msg := checkViewName(parts[3].Text); msg != "" {
+		return stat.syntaxError(parts, 3, msg)
+	}
+	query := &Statement{}
+	if err := query.prepareStatement(input[parts[5].Pos:]); err != nil {
+		// 错误位置相对于整条语句
+		var e *Error
+		if errors.As(err, &e) && e.Pos > 0 {
+			e.Pos += utf8.RuneCountInString(input[:parts[5].Pos])
+		}
+		return err
+	}
+	if query.Typ != StatementTypeSelect {
+		return stat.syntaxError(parts, 5, "a materialized view must be defined by a select")
+	}
+	if query.Columns != nil {
+		return stat.syntaxError(parts, 6, "a materialized view must select all columns")
+	}
+	stat.Typ = StatementTypeCreateMaterializedView
+	stat.TableName = strings.ToLower(parts[3].Text)
+	stat.Prepared = query
+	return nil
+}
+
+// refresh materialized view NAME
+func (stat *Statement) prepareRefreshMaterializedView(parts []Token) error {
+	if len(parts) < 2 || !parts[1].is("materialized") {
+		return stat.syntaxError(parts, 1, "")
+	}
+	if len(parts) < 3 || !parts[2].is("view") {
+		return stat.syntaxError(parts, 2, "")
+	}
+	if len(parts) != 4 {
+		return stat.syntaxError(parts, min(len(parts), 4), "")
+	}
+	stat.Typ = StatementTypeRefreshMaterializedView
+	stat.TableName = strings.ToLower(parts[3].Text)
+	return nil
+}
+
+// 视图名可以带数据库名，只能包含字母、数字和下划线
+func checkViewName(qualified string) string {
+	_, name, ok := strings.Cut(qualified, ".")
+	if !ok {
+		name = qualified
+	}
+	if name == "" || strings.EqualFold(name, USERS_TABLE) {
+		return "invalid view name"
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "invalid view name"
+		}
+	}
+	return ""
+}
+
+// 视图所在的数据库和不带数据库名的视图名
+func (c *Catalog) viewDatabase(qualified string) (*Database, string, error) {
+	dbName, name, ok := strings.Cut(qualified, ".")
+	if !ok {
+		dbName, name = MAIN_DATABASE, qualified
+	}
+	db, ok := c.databases[strings.ToLower(dbName)]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownDatabase, dbName)
+	}
+	return db, strings.ToLower(name), nil
+}
+
+// 打开视图保存行的文件，视图的页缓存和同步设置与数据库相同
+func (c *Catalog) openViewTable(db *Database, name string) (*Table, error) {
+	t, err := dbOpen(sidecarFilename(db.filename, MVIEW_FILE_SUFFIX+"-"+name))
+	if err != nil {
+		return nil, err
+	}
+	t.pager.cacheSize = c.pragmas.cacheSize
+	t.pager.synchronous = c.pragmas.synchronous
+	t.materialized = true
+	if err := t.setBloomFilter(c.pragmas.bloomFilter); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// 附加数据库时打开已有的视图，没有定义过视图时不创建定义文件
+func (c *Catalog) loadViews(db *Database) error {
+	if db.filename == "" {
+		return nil
+	}
+	if _, err := os.Stat(sidecarFilename(db.filename, MVIEW_FILE_SUFFIX)); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	defs, err := db.sidecar(MVIEW_FILE_SUFFIX)
+	if err != nil {
+		return err
+	}
+	for _, name := range defs.Keys("") {
+		query, _, err := defs.Get([]byte(name))
+		if err != nil {
+			return err
+		}
+		t, err := c.openViewTable(db, name)
+		if err != nil {
+			return err
+		}
+		if db.views == nil {
+			db.views = map[string]*MaterializedView{}
+		}
+		db.views[name] = &MaterializedView{query: string(query), table: t}
+	}
+	return nil
+}
+
+// 执行视图的查询，把结果写入视图
+func (c *Catalog) fillView(t *Table, query string) (int, error) {
+	stat := &Statement{}
+	if err := stat.prepareStatement(query); err != nil {
+		return 0, err
+	}
+	source, err := c.resolve(stat.TableName)
+	if err != nil {
+		return 0, err
+	}
+	if source == t {
+		return 0, fmt.Errorf("a materialized view cannot select from itself")
+	}
+	// 查询结果先全部读出，源表和视图的页互不干扰
+	var rows []Row
+	err = c.selectRows(stat, source, func(row *Row) error {
+		rows = append(rows, *row)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i := range rows {
+		if err := t.insertRow(&rows[i]); err != nil {
+			t.rewind(0)
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
+
+func (c *Catalog) executeCreateMaterializedView(stat *Statement) (int, error) {
+	db, name, err := c.viewDatabase(stat.TableName)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := db.views[name]; ok {
+		return 0, fmt.Errorf("%w: %s", ErrTableExists, stat.TableName)
+	}
+	defs, err := db.sidecar(MVIEW_FILE_SUFFIX)
+	if err != nil {
+		return 0, err
+	}
+	// 之前创建失败时可能留下了行文件
+	if filename := sidecarFilename(db.filename, MVIEW_FILE_SUFFIX+"-"+name); filename != "" {
+		if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, ioError(err)
+		}
+	}
+	t, err := c.openViewTable(db, name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.fillView(t, stat.Prepared.Text)
+	if err == nil {
+		err = defs.Put([]byte(name), []byte(stat.Prepared.Text))
+	}
+	if err != nil {
+		t.close()
+		if filename := sidecarFilename(db.filename, MVIEW_FILE_SUFFIX+"-"+name); filename != "" {
+			os.Remove(filename)
+		}
+		return 0, err
+	}
+	if db.views == nil {
+		db.views = map[string]*MaterializedView{}
+	}
+	db.views[name] = &MaterializedView{query: stat.Prepared.Text, table: t}
+	return n, nil
+}
+
+// 清空视图并重新执行查询
+func (c *Catalog) executeRefreshMaterializedView(stat *Statement) (int, error) {
+	db, name, err := c.viewDatabase(stat.TableName)
+	if err != nil {
+		return 0, err
+	}
+	view, ok := db.views[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownTable, stat.TableName)
+	}
+	if _, err := view.table.executeTruncate(); err != nil {
+		return 0, err
+	}
+	return c.fillView(view.table, view.query)
+}
+
+// 解析要写入的表，物化视图不能直接写入
+func (c *Catalog) resolveWritable(name string) (*Table, error) {
+	t, err := c.resolve(name)
+	if err == nil && t.materialized {
+		return nil, fmt.Errorf("%w %s, use refresh materialized view to recompute it", ErrMaterializedWrite, name)
+	}
+	return t, err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMaterializedViewRefresh(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "insert 2 bob bob@other.org")
+	if n := execTestCount(t, s, "create materialized view alices as select * from users where username = alice"); n != 1 {
+		t.Errorf("create materialized view copied %d rows, want 1", n)
+	}
+	if err := execTestErr(t, s, "create materialized view alices as select * from users"); !errors.Is(err, ErrTableExists) {
+		t.Errorf("duplicate view: got %v, want ErrTableExists", err)
+	}
+	if err := execTestErr(t, s, "insert into alices 3 alice alice3@example.com"); !errors.Is(err, ErrMaterializedWrite) {
+		t.Errorf("insert into view: got %v, want ErrMaterializedWrite", err)
+	}
+
+	// 源表的写入在refresh之后才出现在视图中
+	execTest(t, s, "insert 3 alice alice3@example.com")
+	if got := execTest(t, s, "select * from alices"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("view before refresh has ids %v, want [1]", got)
+	}
+	if n := execTestCount(t, s, "refresh materialized view alices"); n != 2 {
+		t.Errorf("refresh copied %d rows, want 2", n)
+	}
+	s.close()
+
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := execTest(t, s, "select * from alices"); !slices.Equal(got, []uint32{1, 3}) {
+		t.Errorf("view after reopen has ids %v, want [1 3]", got)
+	}
+}
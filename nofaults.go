@@ -0,0 +1,14 @@
+//go:build !faultinject
+
+package main
+
+// 没有用 -tags faultinject 构建时不注入故障，见faults.go
+const FAULT_INJECTION = false
+
+func faultWrite(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func faultSync() error {
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// .mode 支持的查询结果输出格式
+const (
+	OUTPUT_MODE_LIST  = "list"
+	OUTPUT_MODE_TABLE = "table"
+	OUTPUT_MODE_CSV   = "csv"
+	OUTPUT_MODE_JSON  = "json"
+	OUTPUT_MODE_LINE  = "line"
+
+	// table模式先缓存这么多行用于计算列宽，之后的行按已确定的列宽截断
+	TABLE_SAMPLE_ROWS = 1000
+	// list模式默认的列分隔符
+	LIST_SEPARATOR = ", "
+)
+
+var OUTPUT_MODES = []string{OUTPUT_MODE_LIST, OUTPUT_MODE_TABLE, OUTPUT_MODE_CSV, OUTPUT_MODE_JSON, OUTPUT_MODE_LINE}
+
+// 列的值，id为数字，其余为去掉填充的字符串
+func rowValues(row *Row) []any {
+	return []any{
+		row.ID,
+		row.username(),
+		row.email(),
+	}
+}
+
+// OutputOptions 控制查询结果的输出格式
+type OutputOptions struct {
+	mode string
+	// list和csv模式下在第一行输出列名
+	headers bool
+	// NULL显示为的字符串
+	nullValue string
+	// list和csv模式的列分隔符，为空时使用各模式默认的分隔符，csv只能使用单个字符
+	separator string
+	// 每列最多显示的字符数，为0时不截断
+	maxWidth int
+}
+
+// 按输出设置把列的值转换为显示的字符串
+func (o OutputOptions) display(v any) string {
+	if v == nil {
+		return o.nullValue
+	}
+	s := fmt.Sprint(v)
+	if o.maxWidth > 0 && utf8.RuneCountInString(s) > o.maxWidth {
+		s = string([]rune(s)[:o.maxWidth])
+	}
+	return s
+}
+
+func (o OutputOptions) displayAll(values []any) []string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = o.display(v)
+	}
+	return parts
+}
+
+// ResultWriter 按某种格式输出查询结果，查询结束后调用finish
+type ResultWriter interface {
+	writeRow(values []any) error
+	finish() error
+}
+
+func newResultWriter(w io.Writer, opts OutputOptions, columns []string) ResultWriter {
+	switch opts.mode {
+	case OUTPUT_MODE_TABLE:
+		return &tableWriter{w: w, columns: columns, opts: opts}
+	case OUTPUT_MODE_CSV:
+		cw := &csvWriter{w: csv.NewWriter(w), opts: opts}
+		if r := []rune(opts.separator); len(r) == 1 {
+			cw.w.Comma = r[0]
+		}
+		if opts.headers {
+			cw.header = columns
+		}
+		return cw
+	case OUTPUT_MODE_JSON:
+		return &jsonWriter{w: w, columns: columns}
+	case OUTPUT_MODE_LINE:
+		return &lineWriter{w: w, columns: columns, opts: opts}
+	}
+	lw := &listWriter{w: w, separator: LIST_SEPARATOR, opts: opts}
+	if opts.separator != "" {
+		lw.separator = opts.separator
+	}
+	if opts.headers {
+		lw.header = columns
+	}
+	return lw
+}
+
+// (1, name, email)
+type listWriter struct {
+	w         io.Writer
+	header    []string
+	separator string
+	opts      OutputOptions
+}
+
+func (lw *listWriter) writeRow(values []any) error {
+	if err := lw.writeHeader(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(lw.w, "(%s)\n", strings.Join(lw.opts.displayAll(values), lw.separator))
+	return err
+}
+
+// 只在第一行之前输出一次列名
+func (lw *listWriter) writeHeader() error {
+	if lw.header == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(lw.w, "(%s)\n", strings.Join(lw.header, lw.separator))
+	lw.header = nil
+	return err
+}
+
+func (lw *listWriter) finish() error {
+	return lw.writeHeader()
+}
+
+// 带边框的表格，按缓存的行计算每列的宽度
+//
+//	+----+----------+
+//	| id | username |
+//	+----+----------+
+//	| 1  | alice    |
+//	+----+----------+
+type tableWriter struct {
+	w       io.Writer
+	columns []string
+	opts    OutputOptions
+	// 确定列宽之前缓存的行
+	rows   [][]string
+	widths []int
+}
+
+func (tw *tableWriter) writeRow(values []any) error {
+	row := tw.opts.displayAll(values)
+	if tw.widths != nil {
+		return tw.line(row)
+	}
+	tw.rows = append(tw.rows, row)
+	if len(tw.rows) < TABLE_SAMPLE_ROWS {
+		return nil
+	}
+	return tw.flush()
+}
+
+// 计算列宽并输出表头和缓存的行
+func (tw *tableWriter) flush() error {
+	tw.widths = make([]int, len(tw.columns))
+	for i, c := range tw.columns {
+		tw.widths[i] = utf8.RuneCountInString(c)
+		for _, row := range tw.rows {
+			tw.widths[i] = max(tw.widths[i], utf8.RuneCountInString(row[i]))
+		}
+	}
+	if err := tw.border(); err != nil {
+		return err
+	}
+	if err := tw.line(tw.columns); err != nil {
+		return err
+	}
+	if err := tw.border(); err != nil {
+		return err
+	}
+	for _, row := range tw.rows {
+		if err := tw.line(row); err != nil {
+			return err
+		}
+	}
+	tw.rows = nil
+	return nil
+}
+
+func (tw *tableWriter) border() error {
+	var b strings.Builder
+	for _, w := range tw.widths {
+		b.WriteString("+")
+		b.WriteString(strings.Repeat("-", w+2))
+	}
+	b.WriteString("+\n")
+	_, err := io.WriteString(tw.w, b.String())
+	return err
+}
+
+func (tw *tableWriter) line(values []string) error {
+	var b strings.Builder
+	for i, v := range values {
+		if r := []rune(v); len(r) > tw.widths[i] {
+			v = string(r[:tw.widths[i]])
+		}
+		fmt.Fprintf(&b, "| %-*s ", tw.widths[i], v)
+	}
+	b.WriteString("|\n")
+	_, err := io.WriteString(tw.w, b.String())
+	return err
+}
+
+func (tw *tableWriter) finish() error {
+	if tw.widths == nil {
+		if err := tw.flush(); err != nil {
+			return err
+		}
+	}
+	return tw.border()
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header []string
+	opts   OutputOptions
+}
+
+func (cw *csvWriter) writeHeader() error {
+	if cw.header == nil {
+		return nil
+	}
+	err := cw.w.Write(cw.header)
+	cw.header = nil
+	return err
+}
+
+func (cw *csvWriter) writeRow(values []any) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	return cw.w.Write(cw.opts.displayAll(values))
+}
+
+func (cw *csvWriter) finish() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// 输出一个JSON数组，每行一个对象
+type jsonWriter struct {
+	w       io.Writer
+	columns []string
+	rows    int
+}
+
+func (jw *jsonWriter) writeRow(values []any) error {
+	var b strings.Builder
+	if jw.rows == 0 {
+		b.WriteString("[")
+	} else {
+		b.WriteString(",")
+	}
+	b.WriteString("\n  {")
+	for i, v := range values {
+		key, _ := json.Marshal(jw.columns[i])
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: %s", key, value)
+	}
+	b.WriteString("}")
+	jw.rows++
+	_, err := io.WriteString(jw.w, b.String())
+	return err
+}
+
+func (jw *jsonWriter) finish() error {
+	if jw.rows == 0 {
+		_, err := fmt.Fprintln(jw.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(jw.w, "\n]")
+	return err
+}
+
+// 每列一行，行之间用空行分隔
+type lineWriter struct {
+	w       io.Writer
+	columns []string
+	opts    OutputOptions
+	rows    int
+}
+
+func (lw *lineWriter) writeRow(values []any) error {
+	width := 0
+	for _, c := range lw.columns {
+		width = max(width, len(c))
+	}
+	if lw.rows > 0 {
+		if _, err := fmt.Fprintln(lw.w); err != nil {
+			return err
+		}
+	}
+	lw.rows++
+	for i, v := range values {
+		if _, err := fmt.Fprintf(lw.w, "%*s = %s\n", width, lw.columns[i], lw.opts.display(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lw *lineWriter) finish() error {
+	return nil
+}
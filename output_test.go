@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 按输出设置输出两行结果
+func outputTest(t *testing.T, opts OutputOptions) string {
+	t.Helper()
+	var b strings.Builder
+	rw := newResultWriter(&b, opts, []string{"id", "username", "note"})
+	for _, values := range [][]any{
+		{uint32(1), "alice", nil},
+		{uint32(22), "bob, jr", "hi"},
+	} {
+		if err := rw.writeRow(values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.finish(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestOutputModes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts OutputOptions
+		want string
+	}{
+		{"list", OutputOptions{}, "(1, alice, )\n(22, bob, jr, hi)\n"},
+		{"list with headers", OutputOptions{headers: true, separator: "|", nullValue: "NULL"},
+			"(id|username|note)\n(1|alice|NULL)\n(22|bob, jr|hi)\n"},
+		{"table", OutputOptions{mode: OUTPUT_MODE_TABLE},
+			"+----+----------+------+\n" +
+				"| id | username | note |\n" +
+				"+----+----------+------+\n" +
+				"| 1  | alice    |      |\n" +
+				"| 22 | bob, jr  | hi   |\n" +
+				"+----+----------+------+\n"},
+		{"csv", OutputOptions{mode: OUTPUT_MODE_CSV, headers: true},
+			"id,username,note\n1,alice,\n22,\"bob, jr\",hi\n"},
+		{"csv with separator", OutputOptions{mode: OUTPUT_MODE_CSV, separator: ";"},
+			"1;alice;\n22;bob, jr;hi\n"},
+		{"json", OutputOptions{mode: OUTPUT_MODE_JSON},
+			"[\n  {\"id\": 1, \"username\": \"alice\", \"note\": null},\n  {\"id\": 22, \"username\": \"bob, jr\", \"note\": \"hi\"}\n]\n"},
+		{"line", OutputOptions{mode: OUTPUT_MODE_LINE, maxWidth: 3},
+			"      id = 1\nusername = ali\n    note = \n\n      id = 22\nusername = bob\n    note = hi\n"},
+	} {
+		if got := outputTest(t, tc.opts); got != tc.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOutputEmptyResult(t *testing.T) {
+	for mode, want := range map[string]string{
+		OUTPUT_MODE_LIST: "(id)\n",
+		OUTPUT_MODE_CSV:  "id\n",
+		OUTPUT_MODE_JSON: "[]\n",
+		OUTPUT_MODE_LINE: "",
+	} {
+		var b strings.Builder
+		rw := newResultWriter(&b, OutputOptions{mode: mode, headers: true}, []string{"id"})
+		if err := rw.finish(); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != want {
+			t.Errorf("%s: got %q, want %q", mode, b.String(), want)
+		}
+	}
+}
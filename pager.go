@@ -0,0 +1,197 @@
+package main
+
+import (
+	"container/list"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+)
+
+// 不是任何页的页号
+const NO_PAGE = math.MaxUint32
+
+// Pager 负责页的缓存与读写；file为nil时为纯内存数据库
+type Pager struct {
+	file       *os.File
+	fileLength int64
+	// 按页号索引，用到更后面的页时增长
+	pages []*[PAGE_SIZE]byte
+	// 缓存中的页号按最近使用的顺序排列，最后一个是最近使用的，
+	// 长度就是缓存的页数
+	recent *list.List
+	lru    map[uint32]*list.Element
+	// 最多缓存的页数，0表示不限制
+	cacheSize   int
+	synchronous string
+}
+
+func openPager(filename string) (*Pager, error) {
+	p := &Pager{
+		synchronous: SYNCHRONOUS_NORMAL,
+		recent:      list.New(),
+		lru:         make(map[uint32]*list.Element),
+	}
+	if filename == "" {
+		return p, nil
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ioError(err)
+	}
+	p.file = file
+	p.fileLength = info.Size()
+
+	return p, nil
+}
+
+func (p *Pager) getPage(pageNum uint32) (*[PAGE_SIZE]byte, error) {
+	if pageNum >= uint32(len(p.pages)) {
+		p.pages = slices.Grow(p.pages, int(pageNum)+1-len(p.pages))[:pageNum+1]
+	}
+
+	page := p.pages[pageNum]
+	if page != nil {
+		p.touch(pageNum)
+		metricPageCacheHits.Add(1)
+		return page, nil
+	}
+	metricPageCacheMisses.Add(1)
+
+	page = new([PAGE_SIZE]byte)
+	if p.file != nil {
+		// 文件末尾可能是不完整的页
+		numPages := uint32(p.fileLength / PAGE_SIZE)
+		if p.fileLength%PAGE_SIZE != 0 {
+			numPages++
+		}
+		if pageNum < numPages {
+			_, err := p.file.ReadAt(page[:], int64(pageNum)*PAGE_SIZE)
+			if err != nil && err != io.EOF {
+				return nil, ioError(err)
+			}
+			metricPagesRead.Add(1)
+			slog.Debug("page read", "file", p.file.Name(), "page", pageNum)
+		}
+	}
+	p.pages[pageNum] = page
+	p.touch(pageNum)
+
+	return page, nil
+}
+
+// 将页的前size个字节写回文件
+func (p *Pager) flush(pageNum uint32, size uint32) error {
+	if p.file == nil {
+		return nil
+	}
+	if pageNum >= uint32(len(p.pages)) || p.pages[pageNum] == nil {
+		return nil
+	}
+	page := p.pages[pageNum]
+	data, fault := faultWrite(page[:size])
+	_, err := p.file.WriteAt(data, int64(pageNum)*PAGE_SIZE)
+	if err == nil {
+		err = fault
+	}
+	if err != nil {
+		slog.Error("page flush failed", "file", p.file.Name(), "page", pageNum, "error", err)
+		return ioError(err)
+	}
+	metricPagesWritten.Add(1)
+	slog.Debug("page flushed", "file", p.file.Name(), "page", pageNum, "bytes", size)
+	// 换出后再次读取时需要知道这一页已经在文件中
+	p.fileLength = max(p.fileLength, int64(pageNum)*PAGE_SIZE+int64(size))
+	return nil
+}
+
+// 把页移到最近使用的位置
+func (p *Pager) touch(pageNum uint32) {
+	if e, ok := p.lru[pageNum]; ok {
+		p.recent.MoveToBack(e)
+		return
+	}
+	p.lru[pageNum] = p.recent.PushBack(pageNum)
+}
+
+// 除keep之外最久未使用的页
+func (p *Pager) leastRecentlyUsed(keep uint32) (uint32, bool) {
+	for e := p.recent.Front(); e != nil; e = e.Next() {
+		if pageNum := e.Value.(uint32); pageNum != keep {
+			return pageNum, true
+		}
+	}
+	return 0, false
+}
+
+// 从缓存中丢弃一页，调用前需要先写回文件
+func (p *Pager) evict(pageNum uint32) {
+	p.pages[pageNum] = nil
+	if e, ok := p.lru[pageNum]; ok {
+		p.recent.Remove(e)
+		delete(p.lru, pageNum)
+	}
+}
+
+// 从最久未使用到最近使用的页号
+func (p *Pager) recentPages() []uint32 {
+	pages := make([]uint32, 0, p.recent.Len())
+	for e := p.recent.Front(); e != nil; e = e.Next() {
+		pages = append(pages, e.Value.(uint32))
+	}
+	return pages
+}
+
+// 截断文件末尾多余的数据
+func (p *Pager) truncate(length int64) error {
+	if p.file == nil || p.fileLength <= length {
+		return nil
+	}
+	if err := p.file.Truncate(length); err != nil {
+		return ioError(err)
+	}
+	p.fileLength = length
+	return nil
+}
+
+// 把写入的数据同步到磁盘
+func (p *Pager) sync() error {
+	if p.file == nil {
+		return nil
+	}
+	if err := faultSync(); err != nil {
+		return ioError(err)
+	}
+	return ioError(p.file.Sync())
+}
+
+// 当前缓存中的页数
+func (p *Pager) cachedPages() int {
+	return p.recent.Len()
+}
+
+// 磁盘上的文件大小，内存数据库为0
+func (p *Pager) fileSize() (int64, error) {
+	if p.file == nil {
+		return 0, nil
+	}
+	info, err := p.file.Stat()
+	if err != nil {
+		return 0, ioError(err)
+	}
+	return info.Size(), nil
+}
+
+func (p *Pager) close() error {
+	if p.file == nil {
+		return nil
+	}
+	return ioError(p.file.Close())
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPagerRecentPagesAndReload(t *testing.T) {
+	p, err := openPager(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+
+	for _, pageNum := range []uint32{0, 1, 2, 0} {
+		page, err := p.getPage(pageNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page[0] = byte(pageNum + 1)
+	}
+	if got := p.recentPages(); !slices.Equal(got, []uint32{1, 2, 0}) {
+		t.Errorf("recent pages %v, want [1 2 0]", got)
+	}
+	if pageNum, ok := p.leastRecentlyUsed(1); !ok || pageNum != 2 {
+		t.Errorf("least recently used except 1: %d, %v, want 2", pageNum, ok)
+	}
+
+	// 写回并换出的页再次读取时从文件加载
+	if err := p.flush(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	p.evict(1)
+	if p.cachedPages() != 2 {
+		t.Errorf("%d cached pages after evict, want 2", p.cachedPages())
+	}
+	page, err := p.getPage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page[0] != 2 {
+		t.Errorf("reloaded page starts with %d, want 2", page[0])
+	}
+	// 文件之外的页是空页
+	page, err = p.getPage(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page[0] != 0 {
+		t.Errorf("new page starts with %d, want 0", page[0])
+	}
+}
+
+func TestCacheSizeLimitsCachedPages(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "pragma cache_size = 2")
+
+	n := uint32(4 * ROWS_PER_PAGE)
+	for i := uint32(1); i <= n; i++ {
+		execTest(t, s, fmt.Sprintf("insert %d user%d user%d@example.com", i, i, i))
+	}
+	if got := execTest(t, s, "select * from users"); uint32(len(got)) != n || got[n-1] != n {
+		t.Errorf("select returned %d rows, want %d", len(got), n)
+	}
+	if cached := c.bufferPool()[0].Pages; len(cached) > 2 {
+		t.Errorf("%d pages cached with cache_size 2: %v", len(cached), cached)
+	}
+}
@@ -0,0 +1,896 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parquet文件格式：
+//
+//	"PAR1" | 列块... | FileMetaData | 元数据长度 "PAR1"
+//
+// 元数据和页头用thrift compact协议编码。导出时每列写成一个不压缩的PLAIN数据页，
+// 导入时支持PLAIN和字典编码、可选列、v1和v2数据页以及snappy和gzip压缩
+const (
+	PARQUET_MAGIC = "PAR1"
+	// 每个行组最多包含的行数
+	PARQUET_ROW_GROUP_ROWS = 1024
+
+	parquetTypeInt32     = 1
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetConvertedUTF8   = 0
+	parquetConvertedUint32 = 13
+
+	parquetEncodingPlain           = 0
+	parquetEncodingPlainDictionary = 2
+	parquetEncodingRLEDictionary   = 8
+
+	parquetCodecUncompressed = 0
+	parquetCodecSnappy       = 1
+	parquetCodecGzip         = 2
+
+	parquetPageData       = 0
+	parquetPageDictionary = 2
+	parquetPageDataV2     = 3
+)
+
+var ErrBadParquet = fmt.Errorf("malformed parquet file")
+
+// thrift compact协议中的类型
+const (
+	thriftTypeTrue   = 1
+	thriftTypeFalse  = 2
+	thriftTypeByte   = 3
+	thriftTypeI16    = 4
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeDouble = 7
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeSet    = 10
+	thriftTypeMap    = 11
+	thriftTypeStruct = 12
+)
+
+// thriftField 是thrift结构体中的一个字段，value为int32、int64、string、
+// thriftFields，或者[]int32、[]string、[]thriftFields表示的列表。字段按id递增排列
+type thriftField struct {
+	id    int16
+	value any
+}
+
+type thriftFields []thriftField
+
+func thriftType(v any) byte {
+	switch v.(type) {
+	case int32:
+		return thriftTypeI32
+	case int64:
+		return thriftTypeI64
+	case string:
+		return thriftTypeBinary
+	case thriftFields:
+		return thriftTypeStruct
+	}
+	return thriftTypeList
+}
+
+func appendThriftInt(b []byte, v int64) []byte {
+	return binary.AppendUvarint(b, uint64(v<<1^v>>63))
+}
+
+func appendThriftStruct(b []byte, s thriftFields) []byte {
+	last := int16(0)
+	for _, f := range s {
+		typ := thriftType(f.value)
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			b = append(b, byte(delta)<<4|typ)
+		} else {
+			b = appendThriftInt(append(b, typ), int64(f.id))
+		}
+		last = f.id
+		b = appendThriftValue(b, f.value)
+	}
+	return append(b, 0)
+}
+
+func appendThriftValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case int32:
+		return appendThriftInt(b, int64(v))
+	case int64:
+		return appendThriftInt(b, v)
+	case string:
+		return append(binary.AppendUvarint(b, uint64(len(v))), v...)
+	case thriftFields:
+		return appendThriftStruct(b, v)
+	case []int32:
+		b = appendThriftListHeader(b, len(v), thriftTypeI32)
+		for _, e := range v {
+			b = appendThriftInt(b, int64(e))
+		}
+	case []string:
+		b = appendThriftListHeader(b, len(v), thriftTypeBinary)
+		for _, e := range v {
+			b = appendThriftValue(b, e)
+		}
+	case []thriftFields:
+		b = appendThriftListHeader(b, len(v), thriftTypeStruct)
+		for _, e := range v {
+			b = appendThriftStruct(b, e)
+		}
+	}
+	return b
+}
+
+func appendThriftListHeader(b []byte, size int, elemType byte) []byte {
+	if size < 15 {
+		return append(b, byte(size)<<4|elemType)
+	}
+	return binary.AppendUvarint(append(b, 0xF0|elemType), uint64(size))
+}
+
+// thriftReader 把compact协议编码的结构体解码成按字段id索引的map，
+// 整数为int64，字符串为[]byte，列表为[]any，不认识的字段也一并解码
+type thriftReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+// 嵌套超过这个深度的结构体视为损坏
+const thriftMaxDepth = 32
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.err = ErrBadParquet
+		return 0
+	}
+	r.pos++
+	return r.buf[r.pos-1]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[min(r.pos, len(r.buf)):])
+	if n <= 0 {
+		r.err = ErrBadParquet
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) int() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) readStruct(depth int) map[int16]any {
+	fields := map[int16]any{}
+	if depth > thriftMaxDepth {
+		r.err = ErrBadParquet
+		return fields
+	}
+	id := int16(0)
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(r.int())
+		}
+		typ := header & 0x0F
+		switch typ {
+		case thriftTypeTrue, thriftTypeFalse:
+			// 结构体中布尔值的取值编码在类型里
+			fields[id] = typ == thriftTypeTrue
+		default:
+			fields[id] = r.readValue(typ, depth)
+		}
+	}
+	return fields
+}
+
+func (r *thriftReader) readValue(typ byte, depth int) any {
+	switch typ {
+	case thriftTypeTrue, thriftTypeFalse:
+		return r.byte() == thriftTypeTrue
+	case thriftTypeByte:
+		return int64(int8(r.byte()))
+	case thriftTypeI16, thriftTypeI32, thriftTypeI64:
+		return r.int()
+	case thriftTypeDouble:
+		if r.pos+8 > len(r.buf) {
+			r.err = ErrBadParquet
+			return nil
+		}
+		r.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos-8:]))
+	case thriftTypeBinary:
+		n := r.uvarint()
+		if r.err != nil || n > uint64(len(r.buf)-r.pos) {
+			r.err = ErrBadParquet
+			return nil
+		}
+		r.pos += int(n)
+		return r.buf[r.pos-int(n) : r.pos]
+	case thriftTypeList, thriftTypeSet:
+		header := r.byte()
+		size, elemType := uint64(header>>4), header&0x0F
+		if size == 15 {
+			size = r.uvarint()
+		}
+		var list []any
+		for i := uint64(0); i < size && r.err == nil; i++ {
+			list = append(list, r.readValue(elemType, depth+1))
+		}
+		return list
+	case thriftTypeMap:
+		size := r.uvarint()
+		if size == 0 {
+			return nil
+		}
+		types := r.byte()
+		for i := uint64(0); i < size && r.err == nil; i++ {
+			r.readValue(types>>4, depth+1)
+			r.readValue(types&0x0F, depth+1)
+		}
+		return nil
+	case thriftTypeStruct:
+		return r.readStruct(depth + 1)
+	}
+	r.err = ErrBadParquet
+	return nil
+}
+
+func thriftInt(m map[int16]any, id int16) int64 {
+	v, _ := m[id].(int64)
+	return v
+}
+
+func thriftStructField(m map[int16]any, id int16) map[int16]any {
+	v, _ := m[id].(map[int16]any)
+	return v
+}
+
+func thriftList(m map[int16]any, id int16) []any {
+	v, _ := m[id].([]any)
+	return v
+}
+
+// parquetColumn 描述导出的一列，plain追加一行中该列的PLAIN编码
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32
+	plain     func(b []byte, row *Row) []byte
+}
+
+func appendPlainString(b []byte, s string) []byte {
+	return append(binary.LittleEndian.AppendUint32(b, uint32(len(s))), s...)
+}
+
+var parquetColumns = []parquetColumn{
+	{"id", parquetTypeInt32, parquetConvertedUint32, func(b []byte, row *Row) []byte {
+		return binary.LittleEndian.AppendUint32(b, row.ID)
+	}},
+	{"username", parquetTypeByteArray, parquetConvertedUTF8, func(b []byte, row *Row) []byte {
+		return appendPlainString(b, row.username())
+	}},
+	{"email", parquetTypeByteArray, parquetConvertedUTF8, func(b []byte, row *Row) []byte {
+		return appendPlainString(b, row.email())
+	}},
+}
+
+func parquetSchema() []thriftFields {
+	schema := []thriftFields{{
+		{4, "schema"},
+		{5, int32(len(parquetColumns))},
+	}}
+	for _, col := range parquetColumns {
+		schema = append(schema, thriftFields{
+			{1, col.typ},
+			{3, int32(parquetRequired)},
+			{4, col.name},
+			{6, col.converted},
+		})
+	}
+	return schema
+}
+
+// ParquetWriter 把行按行组写成Parquet文件
+type ParquetWriter struct {
+	w         io.Writer
+	written   int64
+	rowGroups []thriftFields
+	numRows   int64
+	rows      []Row
+	err       error
+}
+
+func newParquetWriter(w io.Writer) (*ParquetWriter, error) {
+	pw := &ParquetWriter{w: w}
+	pw.write([]byte(PARQUET_MAGIC))
+	return pw, pw.err
+}
+
+func (pw *ParquetWriter) write(p []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	pw.err = err
+}
+
+func (pw *ParquetWriter) add(row *Row) error {
+	pw.rows = append(pw.rows, *row)
+	if len(pw.rows) == PARQUET_ROW_GROUP_ROWS {
+		pw.flushRowGroup()
+	}
+	return pw.err
+}
+
+// 把缓存的行写成一个行组，每列一个不压缩的PLAIN数据页
+func (pw *ParquetWriter) flushRowGroup() {
+	if len(pw.rows) == 0 {
+		return
+	}
+	n := int64(len(pw.rows))
+	var chunks []thriftFields
+	var groupSize int64
+	for _, col := range parquetColumns {
+		var data []byte
+		for i := range pw.rows {
+			data = col.plain(data, &pw.rows[i])
+		}
+		header := appendThriftStruct(nil, thriftFields{
+			{1, int32(parquetPageData)},
+			{2, int32(len(data))},
+			{3, int32(len(data))},
+			{5, thriftFields{
+				{1, int32(n)},
+				{2, int32(parquetEncodingPlain)},
+				{3, int32(parquetEncodingPlain)},
+				{4, int32(parquetEncodingPlain)},
+			}},
+		})
+		offset := pw.written
+		pw.write(header)
+		pw.write(data)
+		size := int64(len(header) + len(data))
+		groupSize += size
+		chunks = append(chunks, thriftFields{
+			{2, offset},
+			{3, thriftFields{
+				{1, col.typ},
+				{2, []int32{parquetEncodingPlain}},
+				{3, []string{col.name}},
+				{4, int32(parquetCodecUncompressed)},
+				{5, n},
+				{6, size},
+				{7, size},
+				{9, offset},
+			}},
+		})
+	}
+	pw.rowGroups = append(pw.rowGroups, thriftFields{
+		{1, chunks},
+		{2, groupSize},
+		{3, n},
+	})
+	pw.numRows += n
+	pw.rows = pw.rows[:0]
+}
+
+// 写入剩余的行和文件元数据
+func (pw *ParquetWriter) finish() error {
+	pw.flushRowGroup()
+	metadata := appendThriftStruct(nil, thriftFields{
+		{1, int32(1)},
+		{2, parquetSchema()},
+		{3, pw.numRows},
+		{4, pw.rowGroups},
+		{6, "golitedb"},
+	})
+	pw.write(metadata)
+	pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(metadata))))
+	pw.write([]byte(PARQUET_MAGIC))
+	return pw.err
+}
+
+// 执行查询并把结果写成Parquet文件，返回写入的行数
+func (c *Catalog) exportParquet(w io.Writer, query string) (int, error) {
+	stat := &Statement{}
+	if err := stat.prepareStatement(query); err != nil {
+		return 0, err
+	}
+	if stat.Typ != StatementTypeSelect {
+		return 0, fmt.Errorf("only select statements can be exported")
+	}
+	if stat.Columns != nil {
+		return 0, fmt.Errorf("exported queries must select all columns")
+	}
+	pw, err := newParquetWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	rows := 0
+	if _, err := NewSession(c, "", "local").execute(stat, func(row *Row) error {
+		rows++
+		return pw.add(row)
+	}); err != nil {
+		return 0, err
+	}
+	return rows, pw.finish()
+}
+
+// 把Parquet文件中的行导入表，在一个事务中插入，任何一行出错时都不导入。
+// mapping把表的列名映射到文件中的列名，没有映射的列使用同名的列，文件中的列名不区分大小写
+func (c *Catalog) importParquet(data []byte, table string, mapping map[string]string) (int, error) {
+	if len(data) < 12 || string(data[:4]) != PARQUET_MAGIC || string(data[len(data)-4:]) != PARQUET_MAGIC {
+		return 0, fmt.Errorf("%w: missing %s magic", ErrBadParquet, PARQUET_MAGIC)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footerLen > len(data)-12 {
+		return 0, fmt.Errorf("%w: bad footer length", ErrBadParquet)
+	}
+	r := &thriftReader{buf: data[len(data)-8-footerLen : len(data)-8]}
+	metadata := r.readStruct(0)
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// 找出每一列在文件中的位置，只支持没有嵌套的schema
+	schema := thriftList(metadata, 2)
+	sources := map[string]int{}
+	var elements []map[int16]any
+	for i, e := range schema {
+		element, _ := e.(map[int16]any)
+		if element == nil {
+			return 0, ErrBadParquet
+		}
+		if i == 0 {
+			continue
+		}
+		if thriftInt(element, 5) > 0 {
+			return 0, fmt.Errorf("nested parquet schemas are not supported")
+		}
+		name, _ := element[4].([]byte)
+		sources[strings.ToLower(string(name))] = len(elements)
+		elements = append(elements, element)
+	}
+	for column := range mapping {
+		if !slices.Contains(COLUMN_NAMES, column) {
+			return 0, fmt.Errorf("no such column: %s", column)
+		}
+	}
+	columns := make([]int, len(COLUMN_NAMES))
+	for i, column := range COLUMN_NAMES {
+		source := column
+		if v, ok := mapping[column]; ok {
+			source = v
+		}
+		idx, ok := sources[strings.ToLower(source)]
+		if !ok {
+			return 0, fmt.Errorf("parquet file has no column %s for %s", source, column)
+		}
+		columns[i] = idx
+	}
+
+	var rows []Row
+	for _, g := range thriftList(metadata, 4) {
+		group, _ := g.(map[int16]any)
+		chunks := thriftList(group, 1)
+		numRows := int(thriftInt(group, 3))
+		values := make([][]any, len(columns))
+		for i, idx := range columns {
+			if idx >= len(chunks) {
+				return 0, fmt.Errorf("%w: row group has %d columns", ErrBadParquet, len(chunks))
+			}
+			chunk, _ := chunks[idx].(map[int16]any)
+			var err error
+			if values[i], err = readParquetColumn(data, thriftStructField(chunk, 3), elements[idx]); err != nil {
+				return 0, fmt.Errorf("column %s: %w", COLUMN_NAMES[i], err)
+			}
+			if len(values[i]) != numRows {
+				return 0, fmt.Errorf("%w: column %s has %d values in a row group of %d rows",
+					ErrBadParquet, COLUMN_NAMES[i], len(values[i]), numRows)
+			}
+		}
+		for n := 0; n < numRows; n++ {
+			row, err := parquetRow(values[0][n], values[1][n], values[2][n])
+			if err != nil {
+				return 0, fmt.Errorf("row %d: %w", len(rows)+1, err)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	session := NewSession(c, "", "local")
+	if _, err := session.execute(&Statement{Typ: StatementTypeBegin}, nil); err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		stat := &Statement{Typ: StatementTypeInsert, TableName: table, RowToInsert: row}
+		if _, err := session.execute(stat, nil); err != nil {
+			session.close()
+			return 0, err
+		}
+	}
+	if _, err := session.execute(&Statement{Typ: StatementTypeCommit}, nil); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// 把文件中的值转换成一行，整数可以导入文本列，数字字符串可以导入id
+func parquetRow(id, username, email any) (Row, error) {
+	var row Row
+	switch v := id.(type) {
+	case int64:
+		if v < 0 || v > math.MaxUint32 {
+			return row, fmt.Errorf("id %d out of range", v)
+		}
+		row.ID = uint32(v)
+	case []byte:
+		n, err := strconv.ParseUint(string(v), 10, 32)
+		if err != nil {
+			return row, fmt.Errorf("invalid id '%s'", v)
+		}
+		row.ID = uint32(n)
+	default:
+		return row, fmt.Errorf("id is NULL")
+	}
+	texts := []struct {
+		column string
+		value  any
+		dst    []byte
+	}{
+		{"username", username, row.Username[:]},
+		{"email", email, row.Email[:]},
+	}
+	for _, t := range texts {
+		var s string
+		switch v := t.value.(type) {
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case []byte:
+			s = string(v)
+		default:
+			return row, fmt.Errorf("%s is NULL", t.column)
+		}
+		if msg := checkText(t.column, s, len(t.dst)); msg != "" {
+			return row, fmt.Errorf("%s", msg)
+		}
+		copy(t.dst, s)
+	}
+	return row, nil
+}
+
+// 读取一个列块中的所有值，NULL为nil
+func readParquetColumn(data []byte, meta, element map[int16]any) ([]any, error) {
+	if meta == nil {
+		return nil, ErrBadParquet
+	}
+	typ := thriftInt(meta, 1)
+	codec := thriftInt(meta, 4)
+	numValues := int(thriftInt(meta, 5))
+	switch thriftInt(element, 3) {
+	case parquetRequired, parquetOptional:
+	default:
+		return nil, fmt.Errorf("repeated parquet columns are not supported")
+	}
+	optional := thriftInt(element, 3) == parquetOptional
+
+	pos := thriftInt(meta, 9)
+	if dict := thriftInt(meta, 11); dict > 0 && dict < pos {
+		pos = dict
+	}
+	var dictionary, values []any
+	for len(values) < numValues {
+		if pos < 0 || pos >= int64(len(data)) {
+			return nil, fmt.Errorf("%w: page offset %d out of range", ErrBadParquet, pos)
+		}
+		r := &thriftReader{buf: data[pos:]}
+		header := r.readStruct(0)
+		if r.err != nil {
+			return nil, r.err
+		}
+		size := int(thriftInt(header, 3))
+		if size < 0 || size > len(r.buf)-r.pos {
+			return nil, fmt.Errorf("%w: page extends past the end of the file", ErrBadParquet)
+		}
+		body := r.buf[r.pos : r.pos+size]
+		pos += int64(r.pos + size)
+		uncompressed := int(thriftInt(header, 2))
+
+		switch thriftInt(header, 1) {
+		case parquetPageDictionary:
+			page, err := parquetDecompress(codec, body, uncompressed)
+			if err != nil {
+				return nil, err
+			}
+			dh := thriftStructField(header, 7)
+			if dictionary, err = decodeParquetPlain(typ, page, int(thriftInt(dh, 1))); err != nil {
+				return nil, err
+			}
+		case parquetPageData:
+			page, err := parquetDecompress(codec, body, uncompressed)
+			if err != nil {
+				return nil, err
+			}
+			dh := thriftStructField(header, 5)
+			count := int(thriftInt(dh, 1))
+			var levels []uint32
+			if optional {
+				if len(page) < 4 {
+					return nil, ErrBadParquet
+				}
+				n := int(binary.LittleEndian.Uint32(page))
+				if n > len(page)-4 {
+					return nil, ErrBadParquet
+				}
+				if levels, err = decodeParquetHybrid(page[4:4+n], 1, count); err != nil {
+					return nil, err
+				}
+				page = page[4+n:]
+			}
+			if values, err = appendParquetValues(values, typ, thriftInt(dh, 2), page, count, levels, dictionary); err != nil {
+				return nil, err
+			}
+		case parquetPageDataV2:
+			dh := thriftStructField(header, 8)
+			count := int(thriftInt(dh, 1))
+			defLen, repLen := int(thriftInt(dh, 5)), int(thriftInt(dh, 6))
+			if defLen < 0 || repLen != 0 || defLen > len(body) {
+				return nil, ErrBadParquet
+			}
+			var levels []uint32
+			var err error
+			if optional {
+				if levels, err = decodeParquetHybrid(body[:defLen], 1, count); err != nil {
+					return nil, err
+				}
+			}
+			page := body[defLen:]
+			if compressed, ok := dh[7].(bool); !ok || compressed {
+				if page, err = parquetDecompress(codec, page, uncompressed-defLen); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = appendParquetValues(values, typ, thriftInt(dh, 4), page, count, levels, dictionary); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// 解码一个数据页中的值，levels为定义级别，0表示NULL
+func appendParquetValues(values []any, typ, encoding int64, page []byte, count int, levels []uint32, dictionary []any) ([]any, error) {
+	present := count
+	if levels != nil {
+		present = 0
+		for _, l := range levels {
+			present += int(l)
+		}
+	}
+	var decoded []any
+	switch encoding {
+	case parquetEncodingPlain:
+		var err error
+		if decoded, err = decodeParquetPlain(typ, page, present); err != nil {
+			return nil, err
+		}
+	case parquetEncodingPlainDictionary, parquetEncodingRLEDictionary:
+		if len(page) == 0 {
+			return nil, ErrBadParquet
+		}
+		indexes, err := decodeParquetHybrid(page[1:], int(page[0]), present)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range indexes {
+			if int(i) >= len(dictionary) {
+				return nil, fmt.Errorf("%w: dictionary index %d out of range", ErrBadParquet, i)
+			}
+			decoded = append(decoded, dictionary[i])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported parquet encoding %d", encoding)
+	}
+	if levels == nil {
+		return append(values, decoded...), nil
+	}
+	for _, l := range levels {
+		if l == 0 {
+			values = append(values, nil)
+		} else {
+			values = append(values, decoded[0])
+			decoded = decoded[1:]
+		}
+	}
+	return values, nil
+}
+
+func decodeParquetPlain(typ int64, page []byte, count int) ([]any, error) {
+	values := make([]any, 0, count)
+	for len(values) < count {
+		switch typ {
+		case parquetTypeInt32:
+			if len(page) < 4 {
+				return nil, ErrBadParquet
+			}
+			values = append(values, int64(int32(binary.LittleEndian.Uint32(page))))
+			page = page[4:]
+		case parquetTypeInt64:
+			if len(page) < 8 {
+				return nil, ErrBadParquet
+			}
+			values = append(values, int64(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		case parquetTypeByteArray:
+			if len(page) < 4 {
+				return nil, ErrBadParquet
+			}
+			n := binary.LittleEndian.Uint32(page)
+			if uint64(n) > uint64(len(page)-4) {
+				return nil, ErrBadParquet
+			}
+			values = append(values, page[4:4+n])
+			page = page[4+n:]
+		default:
+			return nil, fmt.Errorf("unsupported parquet type %d", typ)
+		}
+	}
+	return values, nil
+}
+
+// 解码RLE和位打包混合编码的count个值
+func decodeParquetHybrid(buf []byte, bitWidth, count int) ([]uint32, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("%w: bit width %d", ErrBadParquet, bitWidth)
+	}
+	values := make([]uint32, 0, count)
+	for len(values) < count {
+		header, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, ErrBadParquet
+		}
+		buf = buf[n:]
+		if header&1 == 0 {
+			// 重复的值占用向上取整的字节数
+			width := (bitWidth + 7) / 8
+			if len(buf) < width {
+				return nil, ErrBadParquet
+			}
+			var v uint32
+			for i := 0; i < width; i++ {
+				v |= uint32(buf[i]) << (8 * i)
+			}
+			buf = buf[width:]
+			for run := header >> 1; run > 0 && len(values) < count; run-- {
+				values = append(values, v)
+			}
+			continue
+		}
+		groups := header >> 1
+		if groups > uint64(len(buf)) || int(groups)*bitWidth > len(buf) {
+			return nil, ErrBadParquet
+		}
+		packed := buf[:int(groups)*bitWidth]
+		buf = buf[len(packed):]
+		for i := 0; i < int(groups)*8 && len(values) < count; i++ {
+			var v uint32
+			for b := 0; b < bitWidth; b++ {
+				bit := i*bitWidth + b
+				if packed[bit/8]>>(bit%8)&1 != 0 {
+					v |= 1 << b
+				}
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+func parquetDecompress(codec int64, body []byte, size int) ([]byte, error) {
+	switch codec {
+	case parquetCodecUncompressed:
+		return body, nil
+	case parquetCodecSnappy:
+		return snappyDecode(body)
+	case parquetCodecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(zr, int64(size)))
+	}
+	return nil, fmt.Errorf("unsupported parquet compression codec %d", codec)
+}
+
+// 解码snappy块格式
+func snappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > 1<<30 {
+		return nil, fmt.Errorf("%w: bad snappy header", ErrBadParquet)
+	}
+	dst := make([]byte, 0, size)
+	for i := n; i < len(src); {
+		tag := src[i]
+		length, offset := 0, 0
+		switch tag & 3 {
+		case 0:
+			// 字面量，长度大于60时另外用1到4个字节表示
+			length = int(tag >> 2)
+			i++
+			if length >= 60 {
+				extra := length - 59
+				if i+extra > len(src) {
+					return nil, ErrBadParquet
+				}
+				length = 0
+				for j := 0; j < extra; j++ {
+					length |= int(src[i+j]) << (8 * j)
+				}
+				i += extra
+			}
+			length++
+			if length > len(src)-i || uint64(len(dst)+length) > size {
+				return nil, ErrBadParquet
+			}
+			dst = append(dst, src[i:i+length]...)
+			i += length
+			continue
+		case 1:
+			if i+2 > len(src) {
+				return nil, ErrBadParquet
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag>>5)<<8 | int(src[i+1])
+			i += 2
+		case 2:
+			if i+3 > len(src) {
+				return nil, ErrBadParquet
+			}
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(src[i+1:]))
+			i += 3
+		case 3:
+			if i+5 > len(src) {
+				return nil, ErrBadParquet
+			}
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(src[i+1:]))
+			i += 5
+		}
+		// 复制之前输出的内容，源和目标可以重叠
+		if offset == 0 || offset > len(dst) || uint64(len(dst)+length) > size {
+			return nil, ErrBadParquet
+		}
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, fmt.Errorf("%w: snappy data is truncated", ErrBadParquet)
+	}
+	return dst, nil
+}
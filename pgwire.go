@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// PostgreSQL v3 协议，只实现启动流程和简单查询
+const (
+	PG_PROTOCOL_VERSION = 196608
+	PG_SSL_REQUEST      = 80877103
+	PG_CANCEL_REQUEST   = 80877102
+	PG_GSSENC_REQUEST   = 80877104
+
+	PG_MAX_STARTUP_LENGTH = 10000
+	PG_MAX_MESSAGE_LENGTH = 1 << 24
+
+	PG_AUTH_OK                 = 0
+	PG_AUTH_CLEARTEXT_PASSWORD = 3
+
+	PG_TYPE_INT8 = 20
+	PG_TYPE_TEXT = 25
+
+	PG_SQLSTATE_SYNTAX_ERROR           = "42601"
+	PG_SQLSTATE_UNDEFINED              = "42P01"
+	PG_SQLSTATE_FEATURE                = "0A000"
+	PG_SQLSTATE_INTERNAL_ERROR         = "XX000"
+	PG_SQLSTATE_INVALID_AUTH           = "28P01"
+	PG_SQLSTATE_AUTH_SPEC              = "28000"
+	PG_SQLSTATE_INSUFFICIENT_PRIVILEGE = "42501"
+	PG_SQLSTATE_TRANSACTION_STATE      = "25000"
+	PG_SQLSTATE_IN_FAILED_TRANSACTION  = "25P02"
+	PG_SQLSTATE_UNDEFINED_PREPARED     = "26000"
+	PG_SQLSTATE_DUPLICATE_PREPARED     = "42P05"
+	PG_SQLSTATE_CHECK_VIOLATION        = "23514"
+	PG_SQLSTATE_LOCK_NOT_AVAILABLE     = "55P03"
+	PG_SQLSTATE_DEADLOCK_DETECTED      = "40P01"
+	PG_SQLSTATE_INVALID_CATALOG        = "3D000"
+	PG_SQLSTATE_DISK_FULL              = "53100"
+	PG_SQLSTATE_READ_ONLY_TRANSACTION  = "25006"
+	PG_SQLSTATE_OBJECT_IN_USE          = "55006"
+)
+
+var ErrPgProtocol = fmt.Errorf("postgres protocol violation")
+
+type pgConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	params  map[string]string
+	user    string
+	session *Session
+	// 事务中的语句出错后为true，直到rollback或commit结束事务
+	failed bool
+}
+
+func (s *Server) handlePgConn(conn net.Conn) {
+	defer conn.Close()
+
+	pc := &pgConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+	if err := pc.startup(s.tlsConfig); err != nil {
+		return
+	}
+	// 启动参数database选择 --data-dir 中的数据库
+	c := s.catalog
+	var err error
+	if name := pc.params["database"]; name != "" && s.tenants != nil {
+		c, err = s.tenant(name)
+	}
+	if err == nil {
+		err = s.pgAuthenticate(pc, c)
+	}
+	if err != nil {
+		pc.errorResponse(pgSQLState(err), err.Error())
+		pc.writer.Flush()
+		return
+	}
+	if err := pc.startupComplete(); err != nil {
+		return
+	}
+	pc.session = NewSession(c, pc.user, conn.RemoteAddr().String())
+	defer pc.session.close()
+
+	for {
+		typ, body, err := pc.readMessage()
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case 'Q':
+			query := strings.TrimRight(string(body), "\x00")
+			s.pgSimpleQuery(pc, query)
+			pc.readyForQuery()
+		case 'S':
+			pc.readyForQuery()
+		case 'X':
+			return
+		default:
+			// 扩展查询协议等暂不支持，等待客户端发送Sync
+			pc.errorResponse(PG_SQLSTATE_FEATURE, fmt.Sprintf("unsupported message type '%c'", typ))
+		}
+
+		if err := pc.writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// 一个Query消息可以包含多条以分号分隔的语句，出错时不再执行后面的语句
+func (s *Server) pgSimpleQuery(pc *pgConn, query string) {
+	query, _ = stripComments(query)
+	empty := true
+	for _, stmt := range splitStatements(query) {
+		if stmt == "" {
+			continue
+		}
+		empty = false
+		if !s.pgStatement(pc, stmt) {
+			return
+		}
+	}
+	if empty {
+		pc.writeMessage('I', nil)
+	}
+}
+
+func (s *Server) pgStatement(pc *pgConn, query string) bool {
+	stat, err := prepareNetworkStatement(query)
+	if err == nil {
+		err = pc.session.catalog.authorize(pc.user, stat)
+	}
+	if err != nil {
+		pc.statementError(err)
+		return false
+	}
+
+	// execute按预处理的语句返回结果
+	target := pc.session.resolve(stat)
+
+	// 出错的事务只能回滚，commit和postgres一样回滚事务
+	if pc.failed && target.Typ == StatementTypeCommit {
+		pc.session.endTransaction()
+		pc.commandComplete("ROLLBACK")
+		return true
+	}
+	if pc.failed && target.Typ != StatementTypeRollback {
+		pc.errorResponse(PG_SQLSTATE_IN_FAILED_TRANSACTION, "current transaction is aborted, commands ignored until end of transaction block")
+		return false
+	}
+
+	numRows := 0
+	if target.Typ == StatementTypeSelect {
+		pc.rowDescription(target)
+	}
+	rows, err := s.executeStatement(pc.session, stat, func(row *Row) error {
+		numRows++
+		pc.dataRow(target.project(row))
+		return nil
+	})
+	if err != nil {
+		pc.statementError(err)
+		return false
+	}
+
+	switch target.Typ {
+	case StatementTypeSelect:
+		pc.commandComplete(fmt.Sprintf("SELECT %d", numRows))
+	case StatementTypeBegin:
+		pc.commandComplete("BEGIN")
+	case StatementTypeCommit:
+		pc.commandComplete("COMMIT")
+	case StatementTypeRollback:
+		pc.commandComplete("ROLLBACK")
+	case StatementTypePrepare:
+		pc.commandComplete("PREPARE")
+	case StatementTypePrepareTransaction:
+		pc.commandComplete("PREPARE TRANSACTION")
+	case StatementTypeCommitPrepared:
+		pc.commandComplete("COMMIT PREPARED")
+	case StatementTypeRollbackPrepared:
+		pc.commandComplete("ROLLBACK PREPARED")
+	case StatementTypeDeallocate:
+		pc.commandComplete("DEALLOCATE")
+	case StatementTypePragma:
+		pc.settingResult(target.Name, target.Result)
+		pc.commandComplete("SHOW")
+	case StatementTypeNextval:
+		pc.settingResult("nextval", target.Result)
+		pc.commandComplete("SELECT 1")
+	case StatementTypeExplain:
+		pc.settingResult("QUERY PLAN", target.Result)
+		pc.commandComplete("EXPLAIN")
+	case StatementTypeCreateSequence:
+		pc.commandComplete("CREATE SEQUENCE")
+	case StatementTypeCreateTempTable:
+		if target.Prepared != nil {
+			pc.commandComplete(fmt.Sprintf("SELECT %d", rows))
+		} else {
+			pc.commandComplete("CREATE TABLE")
+		}
+	case StatementTypeReindex:
+		pc.commandComplete("REINDEX")
+	case StatementTypeAnalyze:
+		pc.commandComplete("ANALYZE")
+	case StatementTypeCreateFulltextIndex:
+		pc.commandComplete("CREATE INDEX")
+	case StatementTypeTruncate:
+		pc.commandComplete("TRUNCATE TABLE")
+	case StatementTypeCreateMaterializedView:
+		pc.commandComplete(fmt.Sprintf("SELECT %d", rows))
+	case StatementTypeRefreshMaterializedView:
+		pc.commandComplete("REFRESH MATERIALIZED VIEW")
+	case StatementTypeInsert, StatementTypeInsertSelect:
+		pc.commandComplete(fmt.Sprintf("INSERT 0 %d", rows))
+	case StatementTypeCreateUser, StatementTypeCreateRole:
+		pc.commandComplete("CREATE ROLE")
+	case StatementTypeAlterUser:
+		pc.commandComplete("ALTER ROLE")
+	case StatementTypeGrant, StatementTypeGrantRole:
+		pc.commandComplete("GRANT")
+	case StatementTypeRevoke, StatementTypeRevokeRole:
+		pc.commandComplete("REVOKE")
+	default:
+		pc.commandComplete(strings.ToUpper(strings.ReplaceAll(target.Typ.String(), "_", " ")))
+	}
+	return true
+}
+
+// 返回错误，事务中出错时事务进入失败状态
+func (pc *pgConn) statementError(err error) {
+	pc.errorResponse(pgSQLState(err), err.Error())
+	if pc.session.inTransaction() {
+		pc.failed = true
+	}
+}
+
+func pgSQLState(err error) string {
+	switch {
+	case errors.Is(err, ErrPrepareSyntax), errors.Is(err, ErrPrepareUnRecognized):
+		return PG_SQLSTATE_SYNTAX_ERROR
+	case errors.Is(err, ErrUnknownTable), errors.Is(err, ErrUnknownDatabase):
+		return PG_SQLSTATE_UNDEFINED
+	case errors.Is(err, ErrUnknownTenant):
+		return PG_SQLSTATE_INVALID_CATALOG
+	case errors.Is(err, ErrAuthFailed), errors.Is(err, ErrAuthRequired):
+		return PG_SQLSTATE_INVALID_AUTH
+	case errors.Is(err, ErrPermissionDenied):
+		return PG_SQLSTATE_INSUFFICIENT_PRIVILEGE
+	case errors.Is(err, ErrTransactionActive), errors.Is(err, ErrNoTransaction), errors.Is(err, ErrNotAllowedInTx):
+		return PG_SQLSTATE_TRANSACTION_STATE
+	case errors.Is(err, ErrUnknownPreparedStmt), errors.Is(err, ErrUnknownPreparedTx):
+		return PG_SQLSTATE_UNDEFINED_PREPARED
+	case errors.Is(err, ErrPreparedStatementExist), errors.Is(err, ErrPreparedTxExists):
+		return PG_SQLSTATE_DUPLICATE_PREPARED
+	case errors.Is(err, ErrConstraint):
+		return PG_SQLSTATE_CHECK_VIOLATION
+	case errors.Is(err, ErrLockTimeout):
+		return PG_SQLSTATE_LOCK_NOT_AVAILABLE
+	case errors.Is(err, ErrDeadlock):
+		return PG_SQLSTATE_DEADLOCK_DETECTED
+	case errors.Is(err, ErrFull):
+		return PG_SQLSTATE_DISK_FULL
+	case errors.Is(err, ErrReadOnlyTransaction):
+		return PG_SQLSTATE_READ_ONLY_TRANSACTION
+	case errors.Is(err, ErrInUseBySnapshot), errors.Is(err, ErrPreparedTxCommit):
+		return PG_SQLSTATE_OBJECT_IN_USE
+	}
+	return PG_SQLSTATE_INTERNAL_ERROR
+}
+
+// 配置了TLS时，客户端必须先通过SSLRequest升级连接
+func (pc *pgConn) startup(tlsConfig *tls.Config) error {
+	encrypted := false
+	for {
+		length, err := pc.readInt32()
+		if err != nil {
+			return err
+		}
+		if length < 8 || length > PG_MAX_STARTUP_LENGTH {
+			return ErrPgProtocol
+		}
+		body := make([]byte, length-4)
+		if _, err := io.ReadFull(pc.reader, body); err != nil {
+			return err
+		}
+
+		code := binary.BigEndian.Uint32(body[:4])
+		switch code {
+		case PG_SSL_REQUEST:
+			if tlsConfig == nil || encrypted {
+				if _, err := pc.conn.Write([]byte{'N'}); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := pc.conn.Write([]byte{'S'}); err != nil {
+				return err
+			}
+			tlsConn := tls.Server(pc.conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			pc.conn = tlsConn
+			pc.reader = bufio.NewReader(tlsConn)
+			pc.writer = bufio.NewWriter(tlsConn)
+			encrypted = true
+			continue
+		case PG_GSSENC_REQUEST:
+			// 不支持GSSAPI加密，客户端会继续发送启动包
+			if _, err := pc.conn.Write([]byte{'N'}); err != nil {
+				return err
+			}
+			continue
+		case PG_CANCEL_REQUEST:
+			return ErrPgProtocol
+		case PG_PROTOCOL_VERSION:
+		default:
+			pc.errorResponse(PG_SQLSTATE_FEATURE, fmt.Sprintf("unsupported protocol version %d", code))
+			pc.writer.Flush()
+			return ErrPgProtocol
+		}
+
+		if tlsConfig != nil && !encrypted {
+			pc.errorResponse(PG_SQLSTATE_AUTH_SPEC, "TLS is required")
+			pc.writer.Flush()
+			return ErrPgProtocol
+		}
+		pc.params = parsePgParams(body[4:])
+		return nil
+	}
+}
+
+// 需要认证时要求客户端发送明文密码
+func (s *Server) pgAuthenticate(pc *pgConn, c *Catalog) error {
+	required, err := c.authRequired()
+	if err != nil || !required {
+		return err
+	}
+
+	pc.writeMessage('R', pgInt32(PG_AUTH_CLEARTEXT_PASSWORD))
+	if err := pc.writer.Flush(); err != nil {
+		return err
+	}
+	typ, body, err := pc.readMessage()
+	if err != nil {
+		return err
+	}
+	if typ != 'p' {
+		return ErrPgProtocol
+	}
+	password := strings.TrimRight(string(body), "\x00")
+	if err := c.authenticate(pc.params["user"], password); err != nil {
+		return err
+	}
+	pc.user = pc.params["user"]
+	return nil
+}
+
+func (pc *pgConn) startupComplete() error {
+	pc.writeMessage('R', pgInt32(PG_AUTH_OK))
+	pc.parameterStatus("server_version", "14.0")
+	pc.parameterStatus("server_encoding", "UTF8")
+	pc.parameterStatus("client_encoding", "UTF8")
+	pc.parameterStatus("DateStyle", "ISO, MDY")
+	pc.parameterStatus("integer_datetimes", "on")
+	pc.readyForQuery()
+	return pc.writer.Flush()
+}
+
+// 启动包的参数是一串以\0结尾的键值对，最后以一个\0结束
+func parsePgParams(b []byte) map[string]string {
+	params := make(map[string]string)
+	fields := strings.Split(string(b), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "" {
+			break
+		}
+		params[fields[i]] = fields[i+1]
+	}
+	return params
+}
+
+func (pc *pgConn) readInt32() (int, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(pc.reader, buf[:]); err != nil {
+		return 0, err
+	}
+	return int(int32(binary.BigEndian.Uint32(buf[:]))), nil
+}
+
+func (pc *pgConn) readMessage() (byte, []byte, error) {
+	typ, err := pc.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := pc.readInt32()
+	if err != nil {
+		return 0, nil, err
+	}
+	if length < 4 || length > PG_MAX_MESSAGE_LENGTH {
+		return 0, nil, ErrPgProtocol
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(pc.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+func (pc *pgConn) writeMessage(typ byte, body []byte) {
+	pc.writer.WriteByte(typ)
+	pc.writer.Write(pgInt32(len(body) + 4))
+	pc.writer.Write(body)
+}
+
+func (pc *pgConn) parameterStatus(name, value string) {
+	var body bytes.Buffer
+	body.WriteString(name)
+	body.WriteByte(0)
+	body.WriteString(value)
+	body.WriteByte(0)
+	pc.writeMessage('S', body.Bytes())
+}
+
+// 事务中返回'T'，事务出错后返回'E'，否则返回'I'
+func (pc *pgConn) readyForQuery() {
+	status := byte('I')
+	switch {
+	case pc.session == nil || !pc.session.inTransaction():
+		pc.failed = false
+	case pc.failed:
+		status = 'E'
+	default:
+		status = 'T'
+	}
+	pc.writeMessage('Z', []byte{status})
+}
+
+func (pc *pgConn) commandComplete(tag string) {
+	pc.writeMessage('C', append([]byte(tag), 0))
+}
+
+func (pc *pgConn) errorResponse(code, message string) {
+	var body bytes.Buffer
+	for _, field := range []struct {
+		typ   byte
+		value string
+	}{
+		{'S', "ERROR"},
+		{'V', "ERROR"},
+		{'C', code},
+		{'M', message},
+	} {
+		body.WriteByte(field.typ)
+		body.WriteString(field.value)
+		body.WriteByte(0)
+	}
+	body.WriteByte(0)
+	pc.writeMessage('E', body.Bytes())
+}
+
+func (pc *pgConn) rowDescription(stat *Statement) {
+	columns := stat.Columns
+	if columns == nil {
+		for _, name := range COLUMN_NAMES {
+			columns = append(columns, Projection{Column: name})
+		}
+	}
+
+	var body bytes.Buffer
+	body.Write(pgInt16(len(columns)))
+	for _, col := range columns {
+		typeID, size := PG_TYPE_TEXT, -1
+		if col.numeric() {
+			// id是uint32，超出int4的范围
+			typeID, size = PG_TYPE_INT8, 8
+		}
+		body.WriteString(col.name())
+		body.WriteByte(0)
+		body.Write(pgInt32(0))      // table oid
+		body.Write(pgInt16(0))      // column attribute number
+		body.Write(pgInt32(typeID)) // type oid
+		body.Write(pgInt16(size))   // type size
+		body.Write(pgInt32(-1))     // type modifier
+		body.Write(pgInt16(0))      // text format
+	}
+	pc.writeMessage('T', body.Bytes())
+}
+
+// pragma的结果作为只有一列一行的结果集返回
+func (pc *pgConn) settingResult(name, value string) {
+	var body bytes.Buffer
+	body.Write(pgInt16(1))
+	body.WriteString(name)
+	body.WriteByte(0)
+	body.Write(pgInt32(0))
+	body.Write(pgInt16(0))
+	body.Write(pgInt32(PG_TYPE_TEXT))
+	body.Write(pgInt16(-1))
+	body.Write(pgInt32(-1))
+	body.Write(pgInt16(0))
+	pc.writeMessage('T', body.Bytes())
+
+	body.Reset()
+	body.Write(pgInt16(1))
+	body.Write(pgInt32(len(value)))
+	body.WriteString(value)
+	pc.writeMessage('D', body.Bytes())
+}
+
+func (pc *pgConn) dataRow(values []any) {
+	var body bytes.Buffer
+	body.Write(pgInt16(len(values)))
+	for _, v := range values {
+		s := fmt.Sprint(v)
+		body.Write(pgInt32(len(s)))
+		body.WriteString(s)
+	}
+	pc.writeMessage('D', body.Bytes())
+}
+
+func pgInt32(v int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(v)))
+	return b
+}
+
+func pgInt16(v int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(int16(v)))
+	return b
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type pgTestMessage struct {
+	typ  byte
+	body []byte
+}
+
+func newTestPgConn(t *testing.T) (*Server, *pgConn, *bytes.Buffer) {
+	t.Helper()
+	s := newTestServer(t)
+	out := &bytes.Buffer{}
+	pc := &pgConn{writer: bufio.NewWriter(out)}
+	pc.session = NewSession(s.catalog, "", "test")
+	t.Cleanup(pc.session.close)
+	return s, pc, out
+}
+
+// 执行一个Query消息，返回服务端发送的消息，最后一条是ReadyForQuery
+func pgTestQuery(t *testing.T, s *Server, pc *pgConn, out *bytes.Buffer, query string) []pgTestMessage {
+	t.Helper()
+	s.pgSimpleQuery(pc, query)
+	pc.readyForQuery()
+	if err := pc.writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []pgTestMessage
+	b := out.Bytes()
+	for len(b) > 0 {
+		n := int(binary.BigEndian.Uint32(b[1:5]))
+		msgs = append(msgs, pgTestMessage{b[0], b[5 : 1+n]})
+		b = b[1+n:]
+	}
+	out.Reset()
+	return msgs
+}
+
+func TestPgRowDescriptionIdIsInt8(t *testing.T) {
+	s, pc, out := newTestPgConn(t)
+	msgs := pgTestQuery(t, s, pc, out, "select")
+	if msgs[0].typ != 'T' {
+		t.Fatalf("first message %c, want T", msgs[0].typ)
+	}
+	// 列数之后是第一列：名称、表oid、列号、类型oid、类型长度
+	body := msgs[0].body[2:]
+	name, rest, _ := bytes.Cut(body, []byte{0})
+	typeID := binary.BigEndian.Uint32(rest[6:10])
+	size := int16(binary.BigEndian.Uint16(rest[10:12]))
+	if string(name) != "id" || typeID != PG_TYPE_INT8 || size != 8 {
+		t.Errorf("column %s type %d size %d, want id type %d size 8", name, typeID, size, PG_TYPE_INT8)
+	}
+}
+
+func pgTestStatus(t *testing.T, msgs []pgTestMessage) byte {
+	t.Helper()
+	last := msgs[len(msgs)-1]
+	if last.typ != 'Z' {
+		t.Fatalf("last message %c, want Z", last.typ)
+	}
+	return last.body[0]
+}
+
+func pgTestTag(msgs []pgTestMessage) string {
+	for _, m := range msgs {
+		if m.typ == 'C' {
+			return string(bytes.TrimSuffix(m.body, []byte{0}))
+		}
+	}
+	return ""
+}
+
+func TestPgFailedTransactionStatus(t *testing.T) {
+	s, pc, out := newTestPgConn(t)
+	if status := pgTestStatus(t, pgTestQuery(t, s, pc, out, "begin")); status != 'T' {
+		t.Fatalf("status after begin %c, want T", status)
+	}
+	if status := pgTestStatus(t, pgTestQuery(t, s, pc, out, "select * from nope")); status != 'E' {
+		t.Fatalf("status after error %c, want E", status)
+	}
+	msgs := pgTestQuery(t, s, pc, out, "insert 1 alice alice@example.com")
+	if msgs[0].typ != 'E' || pgTestStatus(t, msgs) != 'E' {
+		t.Fatalf("statement in a failed transaction was not rejected")
+	}
+	msgs = pgTestQuery(t, s, pc, out, "commit")
+	if tag := pgTestTag(msgs); tag != "ROLLBACK" {
+		t.Errorf("commit of a failed transaction tag %q, want ROLLBACK", tag)
+	}
+	if status := pgTestStatus(t, msgs); status != 'I' {
+		t.Errorf("status after commit %c, want I", status)
+	}
+	if got := execTest(t, pc.session, "select"); len(got) != 0 {
+		t.Errorf("failed transaction wrote rows %v", got)
+	}
+}
+
+func TestPgCommandTags(t *testing.T) {
+	s, pc, out := newTestPgConn(t)
+	for _, tc := range []struct{ query, tag string }{
+		{"create user alice password secret", "CREATE ROLE"},
+		{"grant select on users to alice", "GRANT"},
+		{"revoke select on users from alice", "REVOKE"},
+		{"insert 1 bob bob@example.com", "INSERT 0 1"},
+	} {
+		if tag := pgTestTag(pgTestQuery(t, s, pc, out, tc.query)); tag != tc.tag {
+			t.Errorf("%s: tag %q, want %q", tc.query, tag, tc.tag)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// synchronous 的取值：off不调用fsync，normal在关闭数据库时调用，
+// full在每次提交和写页后调用，并发的提交共用一次fsync
+const (
+	SYNCHRONOUS_OFF    = "off"
+	SYNCHRONOUS_NORMAL = "normal"
+	SYNCHRONOUS_FULL   = "full"
+)
+
+var SYNCHRONOUS_MODES = []string{SYNCHRONOUS_OFF, SYNCHRONOUS_NORMAL, SYNCHRONOUS_FULL}
+
+// commit_mode 的取值：sync在提交返回前fsync，async由后台定期fsync。
+// 只在synchronous为full时有区别
+const (
+	COMMIT_MODE_SYNC  = "sync"
+	COMMIT_MODE_ASYNC = "async"
+)
+
+var COMMIT_MODES = []string{COMMIT_MODE_SYNC, COMMIT_MODE_ASYNC}
+
+var (
+	ErrUnknownPragma      = fmt.Errorf("no such pragma")
+	ErrReadOnlyPragma     = fmt.Errorf("pragma is read-only")
+	ErrInvalidPragmaValue = fmt.Errorf("invalid pragma value")
+	ErrQueryTimeout       = fmt.Errorf("query timeout exceeded")
+)
+
+// Pragmas 是可以用pragma语句查看和修改的设置，对目录中所有数据库生效
+type Pragmas struct {
+	// 每张表最多缓存的页数，0表示不限制
+	cacheSize    int
+	synchronous  string
+	foreignKeys  bool
+	queryTimeout time.Duration
+	checkEmail   bool
+	commitMode   string
+	lockTimeout  time.Duration
+	// 单个查询最多返回的行数，0表示不限制
+	maxResultRows int
+	bulkLoad      bool
+	// 查询结果缓存最多保存的行数，0表示不缓存
+	resultCacheRows int
+	bloomFilter     bool
+	// select ... as of 可以读取多久以前的行，0表示不记录历史
+	historyRetention time.Duration
+}
+
+func defaultPragmas() Pragmas {
+	return Pragmas{synchronous: SYNCHRONOUS_NORMAL, commitMode: COMMIT_MODE_SYNC, lockTimeout: DEFAULT_LOCK_TIMEOUT}
+}
+
+// Pragma 是一个可调参数，set为nil时只读。调用时持有目录的锁
+type Pragma struct {
+	name string
+	help string
+	get  func(c *Catalog) string
+	set  func(c *Catalog, value string) error
+}
+
+var PRAGMAS = []*Pragma{
+	{
+		name: "cache_size",
+		help: "maximum pages cached per table of a file database, 0 for no limit",
+		get:  func(c *Catalog) string { return strconv.Itoa(c.pragmas.cacheSize) },
+		set: func(c *Catalog, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%w: cache_size must be a non-negative number", ErrInvalidPragmaValue)
+			}
+			c.pragmas.cacheSize = n
+			return c.applyPragmas()
+		},
+	},
+	{
+		name: "synchronous",
+		help: "when data is synced to disk: off, normal or full",
+		get:  func(c *Catalog) string { return c.pragmas.synchronous },
+		set: func(c *Catalog, value string) error {
+			value = strings.ToLower(value)
+			if !slices.Contains(SYNCHRONOUS_MODES, value) {
+				return fmt.Errorf("%w: synchronous must be one of %s", ErrInvalidPragmaValue, strings.Join(SYNCHRONOUS_MODES, ", "))
+			}
+			c.pragmas.synchronous = value
+			return c.applyPragmas()
+		},
+	},
+	{
+		name: "commit_mode",
+		help: "whether a commit waits for its fsync (sync) or leaves it to a background goroutine (async)",
+		get:  func(c *Catalog) string { return c.pragmas.commitMode },
+		set: func(c *Catalog, value string) error {
+			value = strings.ToLower(value)
+			if !slices.Contains(COMMIT_MODES, value) {
+				return fmt.Errorf("%w: commit_mode must be one of %s", ErrInvalidPragmaValue, strings.Join(COMMIT_MODES, ", "))
+			}
+			c.pragmas.commitMode = value
+			return nil
+		},
+	},
+	{
+		name: "prepared_transactions",
+		help: "ids of transactions prepared for two-phase commit and not yet committed or rolled back",
+		get:  func(c *Catalog) string { return strings.Join(c.preparedTransactions(), ", ") },
+	},
+	{
+		name: "page_size",
+		help: "size of a database page in bytes",
+		get:  func(c *Catalog) string { return strconv.Itoa(PAGE_SIZE) },
+	},
+	{
+		name: "foreign_keys",
+		help: "enforce foreign key constraints (no table declares any yet)",
+		get:  func(c *Catalog) string { return formatBool(c.pragmas.foreignKeys) },
+		set: func(c *Catalog, value string) error {
+			on, err := parseBool(value)
+			if err != nil {
+				return err
+			}
+			c.pragmas.foreignKeys = on
+			return nil
+		},
+	},
+	{
+		name: "check_email",
+		help: "reject inserted rows whose email is not a valid address",
+		get:  func(c *Catalog) string { return formatBool(c.pragmas.checkEmail) },
+		set: func(c *Catalog, value string) error {
+			on, err := parseBool(value)
+			if err != nil {
+				return err
+			}
+			c.pragmas.checkEmail = on
+			return c.applyPragmas()
+		},
+	},
+	{
+		name: "result_cache_rows",
+		help: "rows of select results kept for repeated identical queries, 0 to disable the cache",
+		get:  func(c *Catalog) string { return strconv.Itoa(c.pragmas.resultCacheRows) },
+		set: func(c *Catalog, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%w: result_cache_rows must be a non-negative number", ErrInvalidPragmaValue)
+			}
+			c.pragmas.resultCacheRows = n
+			c.resultCache.resize(n)
+			return nil
+		},
+	},
+	{
+		name: "bloom_filter",
+		help: "keep a bloom filter of ids so selects by an absent id skip the table scan",
+		get:  func(c *Catalog) string { return formatBool(c.pragmas.bloomFilter) },
+		set: func(c *Catalog, value string) error {
+			on, err := parseBool(value)
+			if err != nil {
+				return err
+			}
+			c.pragmas.bloomFilter = on
+			return c.applyPragmas()
+		},
+	},
+	{
+		name: "history_retention",
+		help: "seconds of commit history kept for select ... as of, 0 to disable",
+		get:  func(c *Catalog) string { return strconv.FormatInt(int64(c.pragmas.historyRetention/time.Second), 10) },
+		set: func(c *Catalog, value string) error {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds < 0 {
+				return fmt.Errorf("%w: history_retention must be a non-negative number of seconds", ErrInvalidPragmaValue)
+			}
+			c.pragmas.historyRetention = time.Duration(seconds) * time.Second
+			return c.applyPragmas()
+		},
+	},
+	{
+		name: "bulk_load",
+		help: "skip fulltext indexing and check_email on insert until turned off, then check and index all loaded rows at once",
+		get:  func(c *Catalog) string { return formatBool(c.pragmas.bulkLoad) },
+		set: func(c *Catalog, value string) error {
+			on, err := parseBool(value)
+			if err != nil {
+				return err
+			}
+			c.pragmas.bulkLoad = on
+			if !on {
+				return c.endBulkLoad()
+			}
+			for _, db := range c.databases {
+				db.table.beginBulkLoad()
+			}
+			return nil
+		},
+	},
+	{
+		name: "query_timeout",
+		help: "abort selects running longer than this many milliseconds, 0 for no limit",
+		get:  func(c *Catalog) string { return strconv.FormatInt(c.pragmas.queryTimeout.Milliseconds(), 10) },
+		set: func(c *Catalog, value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				return fmt.Errorf("%w: query_timeout must be a non-negative number of milliseconds", ErrInvalidPragmaValue)
+			}
+			c.pragmas.queryTimeout = time.Duration(ms) * time.Millisecond
+			return nil
+		},
+	},
+	{
+		name: "lock_timeout",
+		help: "give up waiting for a table lock after this many milliseconds, 0 to wait forever",
+		get:  func(c *Catalog) string { return strconv.FormatInt(c.pragmas.lockTimeout.Milliseconds(), 10) },
+		set: func(c *Catalog, value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				return fmt.Errorf("%w: lock_timeout must be a non-negative number of milliseconds", ErrInvalidPragmaValue)
+			}
+			c.pragmas.lockTimeout = time.Duration(ms) * time.Millisecond
+			return nil
+		},
+	},
+	{
+		name: "max_result_rows",
+		help: "fail a select that returns more than this many rows, 0 for no limit",
+		get:  func(c *Catalog) string { return strconv.Itoa(c.pragmas.maxResultRows) },
+		set: func(c *Catalog, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%w: max_result_rows must be a non-negative number", ErrInvalidPragmaValue)
+			}
+			c.pragmas.maxResultRows = n
+			return nil
+		},
+	},
+}
+
+func findPragma(name string) *Pragma {
+	i := slices.IndexFunc(PRAGMAS, func(p *Pragma) bool { return p.name == strings.ToLower(name) })
+	if i < 0 {
+		return nil
+	}
+	return PRAGMAS[i]
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "1":
+		return true, nil
+	case "off", "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: expected on or off", ErrInvalidPragmaValue)
+}
+
+// pragma NAME [= VALUE]，等号两边可以没有空格
+func (stat *Statement) preparePragma(parts []Token) error {
+	if len(parts) < 2 {
+		return stat.syntaxError(parts, 1, "")
+	}
+	name, value, assign := strings.Cut(parts[1].Text, "=")
+	switch {
+	case assign && len(parts) == 2 && value != "":
+	case assign && value == "" && len(parts) == 3:
+		value = parts[2].Text
+	case !assign && len(parts) == 2:
+	case !assign && len(parts) == 3 && strings.HasPrefix(parts[2].Text, "=") && len(parts[2].Text) > 1:
+		value = parts[2].Text[1:]
+	case !assign && len(parts) == 4 && parts[2].is("="):
+		value = parts[3].Text
+	default:
+		return stat.syntaxError(parts, min(len(parts), 2), "")
+	}
+	if findPragma(name) == nil {
+		return stat.syntaxError(parts, 1, ErrUnknownPragma.Error())
+	}
+	stat.Typ = StatementTypePragma
+	stat.Name = strings.ToLower(name)
+	stat.Value = value
+	return nil
+}
+
+// 设置或读取pragma，结果保存在stat.Result中
+func (c *Catalog) executePragma(stat *Statement) error {
+	p := findPragma(stat.Name)
+	if p == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownPragma, stat.Name)
+	}
+	if stat.Value != "" {
+		if p.set == nil {
+			return fmt.Errorf("%w: %s", ErrReadOnlyPragma, p.name)
+		}
+		if err := p.set(c, stat.Value); err != nil {
+			return err
+		}
+	}
+	stat.Result = p.get(c)
+	return nil
+}
+
+// 把页缓存、同步和约束设置应用到所有表，新附加的数据库在attach时应用，
+// 新建的临时表在创建时应用
+func (c *Catalog) applyPragmas() error {
+	for t := range c.temp {
+		if err := c.applyTempPragmas(t); err != nil {
+			return err
+		}
+	}
+	for _, db := range c.databases {
+		db.table.pager.cacheSize = c.pragmas.cacheSize
+		db.table.pager.synchronous = c.pragmas.synchronous
+		db.table.checkEmail = c.pragmas.checkEmail
+		if err := db.table.setBloomFilter(c.pragmas.bloomFilter); err != nil {
+			return err
+		}
+		db.table.setHistoryRetention(c.pragmas.historyRetention)
+		// 立即换出超出的页
+		if err := db.table.evictPages(NO_PAGE); err != nil {
+			return err
+		}
+		for _, kv := range db.sidecars {
+			kv.setSynchronous(c.pragmas.synchronous)
+		}
+		for _, view := range db.views {
+			view.table.pager.cacheSize = c.pragmas.cacheSize
+			view.table.pager.synchronous = c.pragmas.synchronous
+			if err := view.table.setBloomFilter(c.pragmas.bloomFilter); err != nil {
+				return err
+			}
+			if err := view.table.evictPages(NO_PAGE); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) maxResultRows() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.pragmas.maxResultRows
+}
+
+// 超过query_timeout时停止扫描
+func (c *Catalog) withTimeout(handle RowHandler) RowHandler {
+	if c.pragmas.queryTimeout == 0 {
+		return handle
+	}
+	deadline := time.Now().Add(c.pragmas.queryTimeout)
+	return func(row *Row) error {
+		if time.Now().After(deadline) {
+			return ErrQueryTimeout
+		}
+		return handle(row)
+	}
+}
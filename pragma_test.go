@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// 执行一条pragma语句，返回它的值
+func pragmaTest(t *testing.T, s *Session, text string) string {
+	t.Helper()
+	stat := &Statement{}
+	if err := stat.prepareStatement(text); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	if _, err := s.execute(stat, nil); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	return stat.Result
+}
+
+func TestPragmaSetAndGet(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	for _, tc := range []struct{ text, want string }{
+		{"pragma cache_size = 10", "10"},
+		{"pragma cache_size", "10"},
+		{"pragma synchronous=FULL", SYNCHRONOUS_FULL},
+		{"pragma synchronous =off", SYNCHRONOUS_OFF},
+		{"pragma page_size", "4096"},
+	} {
+		if got := pragmaTest(t, s, tc.text); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.text, got, tc.want)
+		}
+	}
+	if err := execTestErr(t, s, "pragma cache_size = -1"); !errors.Is(err, ErrInvalidPragmaValue) {
+		t.Errorf("negative cache_size: got %v, want ErrInvalidPragmaValue", err)
+	}
+	if err := execTestErr(t, s, "pragma page_size = 1024"); !errors.Is(err, ErrReadOnlyPragma) {
+		t.Errorf("setting page_size: got %v, want ErrReadOnlyPragma", err)
+	}
+	if err := execTestErr(t, s, "pragma no_such_thing"); !errors.Is(err, ErrPrepareSyntax) {
+		t.Errorf("unknown pragma: got %v, want a syntax error", err)
+	}
+}
+
+func TestPragmaCheckEmail(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert 1 alice not-an-email")
+	execTest(t, s, "pragma check_email = on")
+	if err := execTestErr(t, s, "insert 2 bob not-an-email"); !errors.Is(err, ErrConstraint) {
+		t.Errorf("invalid email: got %v, want ErrConstraint", err)
+	}
+	execTest(t, s, "insert 3 carol carol@example.com")
+	if got := execTest(t, s, "select"); len(got) != 2 {
+		t.Errorf("table has ids %v, want [1 3]", got)
+	}
+}
+
+func TestPragmaMaxResultRows(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	execTest(t, s, "pragma max_result_rows = 2")
+	execTest(t, s, "select")
+	execTest(t, s, "insert 3 carol carol@example.com")
+	if err := execTestErr(t, s, "select"); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("select over the limit: got %v, want ErrTooManyRows", err)
+	}
+	if got := execTest(t, s, "select * from users where id = 3"); len(got) != 1 {
+		t.Errorf("filtered select returned ids %v, want [3]", got)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 权限保存在main数据库的 FILENAME-grants 键值表中：
+//
+//	super:USER          超级用户
+//	role:ROLE           角色
+//	member:USER:ROLE    用户属于角色
+//	priv:NAME:TABLE     用户或角色在表上的权限，以逗号分隔
+const (
+	GRANTS_FILE_SUFFIX = "-grants"
+
+	PRIVILEGE_SELECT = "select"
+	PRIVILEGE_INSERT = "insert"
+	PRIVILEGE_UPDATE = "update"
+	PRIVILEGE_DELETE = "delete"
+	PRIVILEGE_ALL    = "all"
+
+	// RESP键值表在权限系统中的表名
+	KV_TABLE_NAME = "kv"
+
+	GRANT_SUPER_PREFIX  = "super:"
+	GRANT_ROLE_PREFIX   = "role:"
+	GRANT_MEMBER_PREFIX = "member:"
+	GRANT_PRIV_PREFIX   = "priv:"
+)
+
+var ALL_PRIVILEGES = []string{PRIVILEGE_SELECT, PRIVILEGE_INSERT, PRIVILEGE_UPDATE, PRIVILEGE_DELETE}
+
+var (
+	ErrPermissionDenied = fmt.Errorf("permission denied")
+	ErrUnknownRole      = fmt.Errorf("no such role")
+	ErrRoleExists       = fmt.Errorf("role already exists")
+	ErrUnknownGrantee   = fmt.Errorf("no such user or role")
+)
+
+// 解析以逗号分隔的权限列表，all展开为全部权限
+func parsePrivileges(list string) ([]string, bool) {
+	var privileges []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == PRIVILEGE_ALL:
+			privileges = append(privileges, ALL_PRIVILEGES...)
+		case slices.Contains(ALL_PRIVILEGES, p):
+			privileges = append(privileges, p)
+		default:
+			return nil, false
+		}
+	}
+	slices.Sort(privileges)
+	return slices.Compact(privileges), true
+}
+
+func (c *Catalog) executeCreateRole(stat *Statement) error {
+	grants, err := c.databases[MAIN_DATABASE].grantsTable()
+	if err != nil {
+		return err
+	}
+	if _, ok, err := grants.Get([]byte(GRANT_ROLE_PREFIX + stat.RoleName)); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%w: %s", ErrRoleExists, stat.RoleName)
+	}
+	return grants.Put([]byte(GRANT_ROLE_PREFIX+stat.RoleName), []byte("1"))
+}
+
+func (c *Catalog) executeGrant(stat *Statement) error {
+	grants, table, err := c.prepareGrant(stat)
+	if err != nil {
+		return err
+	}
+	key := []byte(GRANT_PRIV_PREFIX + stat.Grantee + ":" + table)
+	current, _, err := grants.Get(key)
+	if err != nil {
+		return err
+	}
+
+	privileges := stat.Privileges
+	if len(current) > 0 {
+		privileges = append(strings.Split(string(current), ","), privileges...)
+	}
+	slices.Sort(privileges)
+	privileges = slices.Compact(privileges)
+	return grants.Put(key, []byte(strings.Join(privileges, ",")))
+}
+
+func (c *Catalog) executeRevoke(stat *Statement) error {
+	grants, table, err := c.prepareGrant(stat)
+	if err != nil {
+		return err
+	}
+	key := []byte(GRANT_PRIV_PREFIX + stat.Grantee + ":" + table)
+	current, ok, err := grants.Get(key)
+	if err != nil || !ok {
+		return err
+	}
+
+	privileges := slices.DeleteFunc(strings.Split(string(current), ","), func(p string) bool {
+		return slices.Contains(stat.Privileges, p)
+	})
+	if len(privileges) == 0 {
+		_, err := grants.Delete(key)
+		return err
+	}
+	return grants.Put(key, []byte(strings.Join(privileges, ",")))
+}
+
+// 检查被授权者和表是否存在，返回规范化后的表名
+func (c *Catalog) prepareGrant(stat *Statement) (*KVTable, string, error) {
+	grants, err := c.databases[MAIN_DATABASE].grantsTable()
+	if err != nil {
+		return nil, "", err
+	}
+
+	table := qualifyTableName(stat.TableName)
+	if table != qualifyTableName(KV_TABLE_NAME) {
+		if _, err := c.resolve(stat.TableName); err != nil {
+			return nil, "", err
+		}
+	}
+
+	isUser, err := c.userExists(stat.Grantee)
+	if err != nil {
+		return nil, "", err
+	}
+	_, isRole, err := grants.Get([]byte(GRANT_ROLE_PREFIX + stat.Grantee))
+	if err != nil {
+		return nil, "", err
+	}
+	if !isUser && !isRole {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownGrantee, stat.Grantee)
+	}
+	return grants, table, nil
+}
+
+func (c *Catalog) executeGrantRole(stat *Statement, grant bool) error {
+	grants, err := c.databases[MAIN_DATABASE].grantsTable()
+	if err != nil {
+		return err
+	}
+	if _, ok, err := grants.Get([]byte(GRANT_ROLE_PREFIX + stat.RoleName)); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRole, stat.RoleName)
+	}
+	if ok, err := c.userExists(stat.UserName); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownUser, stat.UserName)
+	}
+
+	key := []byte(GRANT_MEMBER_PREFIX + stat.UserName + ":" + stat.RoleName)
+	if !grant {
+		_, err := grants.Delete(key)
+		return err
+	}
+	return grants.Put(key, []byte("1"))
+}
+
+func (c *Catalog) userExists(name string) (bool, error) {
+	accounts, err := c.databases[MAIN_DATABASE].accountsTable()
+	if err != nil {
+		return false, err
+	}
+	_, ok, err := accounts.Get([]byte(name))
+	return ok, err
+}
+
+func (c *Catalog) setSuperuser(name string) error {
+	grants, err := c.databases[MAIN_DATABASE].grantsTable()
+	if err != nil {
+		return err
+	}
+	return grants.Put([]byte(GRANT_SUPER_PREFIX+name), []byte("1"))
+}
+
+// 在执行语句前检查权限，user为空表示本地会话或未启用认证
+func (c *Catalog) authorize(user string, stat *Statement) error {
+	grants, ok, err := c.unrestricted(user)
+	if err != nil || ok {
+		return err
+	}
+
+	switch stat.Typ {
+	case StatementTypeSelect:
+		return checkPrivilege(grants, user, stat.TableName, PRIVILEGE_SELECT)
+	case StatementTypeInsert:
+		return checkPrivilege(grants, user, stat.TableName, PRIVILEGE_INSERT)
+	case StatementTypeTruncate:
+		return checkPrivilege(grants, user, stat.TableName, PRIVILEGE_DELETE)
+	case StatementTypeInsertSelect:
+		if err := checkPrivilege(grants, user, stat.SourceTable, PRIVILEGE_SELECT); err != nil {
+			return err
+		}
+		return checkPrivilege(grants, user, stat.TableName, PRIVILEGE_INSERT)
+	case StatementTypeBegin, StatementTypeCommit, StatementTypeRollback,
+		StatementTypePrepareTransaction, StatementTypeCommitPrepared, StatementTypeRollbackPrepared,
+		StatementTypeExecute, StatementTypeDeallocate:
+		// 预处理语句在执行时检查权限
+		return nil
+	case StatementTypePrepare, StatementTypeExplain:
+		return c.authorize(user, stat.Prepared)
+	case StatementTypeCreateTempTable:
+		// 所有用户都可以创建临时表，填充时需要读取查询的表
+		if stat.Prepared == nil {
+			return nil
+		}
+		return c.authorize(user, stat.Prepared)
+	case StatementTypePragma:
+		// 所有用户都可以读取设置，修改设置需要超级用户
+		if stat.Value == "" {
+			return nil
+		}
+	case StatementTypeNextval:
+		// 序列用于分配ID，所有用户都可以取值
+		return nil
+	}
+	// 用户、角色和权限管理只允许超级用户执行
+	return ErrPermissionDenied
+}
+
+// 检查用户对RESP键值表的权限
+func (c *Catalog) authorizeKV(user, privilege string) error {
+	grants, ok, err := c.unrestricted(user)
+	if err != nil || ok {
+		return err
+	}
+	return checkPrivilege(grants, user, KV_TABLE_NAME, privilege)
+}
+
+// 本地会话和超级用户不受权限限制
+func (c *Catalog) unrestricted(user string) (*KVTable, bool, error) {
+	if user == "" {
+		return nil, true, nil
+	}
+	grants, err := c.grants()
+	if err != nil {
+		return nil, false, err
+	}
+	_, ok, err := grants.Get([]byte(GRANT_SUPER_PREFIX + user))
+	return grants, ok, err
+}
+
+// 用户直接获得的权限和通过角色获得的权限都有效
+func checkPrivilege(grants *KVTable, user, table, privilege string) error {
+	// 会话可以读写自己的临时表
+	if isTempTable(table) {
+		return nil
+	}
+	table = qualifyTableName(table)
+	grantees := []string{user}
+	memberPrefix := GRANT_MEMBER_PREFIX + user + ":"
+	for _, key := range grants.Keys(memberPrefix) {
+		grantees = append(grantees, strings.TrimPrefix(key, memberPrefix))
+	}
+
+	for _, grantee := range grantees {
+		privileges, _, err := grants.Get([]byte(GRANT_PRIV_PREFIX + grantee + ":" + table))
+		if err != nil {
+			return err
+		}
+		if slices.Contains(strings.Split(string(privileges), ","), privilege) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s on %s", ErrPermissionDenied, privilege, table)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGrantAndRevokePrivileges(t *testing.T) {
+	c := openTestCatalog(t)
+	root := NewSession(c, "", "test")
+	defer root.close()
+	// 第一个用户自动成为超级用户
+	execTest(t, root, "create user root password root")
+	execTest(t, root, "create user alice password alice")
+	alice := NewSession(c, "alice", "test")
+	defer alice.close()
+
+	if err := execTestErr(t, alice, "select"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("select without a grant: got %v, want ErrPermissionDenied", err)
+	}
+	execTest(t, root, "grant select on users to alice")
+	execTest(t, alice, "select")
+	if err := execTestErr(t, alice, "insert 1 alice alice@example.com"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("insert with only select: got %v, want ErrPermissionDenied", err)
+	}
+
+	// 通过角色获得权限
+	execTest(t, root, "create role writers")
+	execTest(t, root, "grant insert on users to writers")
+	execTest(t, root, "grant writers to alice")
+	execTest(t, alice, "insert 1 alice alice@example.com")
+	execTest(t, root, "revoke writers from alice")
+	if err := execTestErr(t, alice, "insert 2 alice alice@example.com"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("insert after revoking the role: got %v, want ErrPermissionDenied", err)
+	}
+
+	execTest(t, root, "revoke select on users from alice")
+	if err := execTestErr(t, alice, "select"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("select after revoke: got %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestOnlySuperusersManageAccess(t *testing.T) {
+	c := openTestCatalog(t)
+	root := NewSession(c, "", "test")
+	defer root.close()
+	execTest(t, root, "create user root password root")
+	execTest(t, root, "create user alice password alice")
+	alice := NewSession(c, "alice", "test")
+	defer alice.close()
+
+	for _, text := range []string{
+		"create user bob password bob",
+		"grant select on users to alice",
+		"create role readers",
+		"pragma cache_size = 1",
+	} {
+		if err := execTestErr(t, alice, text); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s: got %v, want ErrPermissionDenied", text, err)
+		}
+	}
+	// 所有用户都可以读取设置
+	execTest(t, alice, "pragma cache_size")
+
+	rootUser := NewSession(c, "root", "test")
+	defer rootUser.close()
+	execTest(t, rootUser, "create role readers")
+	if err := execTestErr(t, rootUser, "grant select on users to nobody"); !errors.Is(err, ErrUnknownGrantee) {
+		t.Errorf("grant to unknown user: got %v, want ErrUnknownGrantee", err)
+	}
+}
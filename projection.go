@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// select列表中可以使用的函数，参数是列的值转换成的字符串
+var PROJECTION_FUNCS = map[string]func(string) any{
+	"length": func(s string) any { return utf8.RuneCountInString(s) },
+	"lower":  func(s string) any { return strings.ToLower(s) },
+	"upper":  func(s string) any { return strings.ToUpper(s) },
+}
+
+// Projection 是select输出的一列：COLUMN 或 FUNC(COLUMN)，可以有别名
+type Projection struct {
+	Column string
+	Func   string
+	Alias  string
+}
+
+// 结果中的列名
+func (p Projection) name() string {
+	if p.Alias != "" {
+		return p.Alias
+	}
+	if p.Func == "" {
+		return p.Column
+	}
+	return p.Func + "(" + p.Column + ")"
+}
+
+func (p Projection) value(row *Row) any {
+	v := rowValues(row)[slices.Index(COLUMN_NAMES, p.Column)]
+	if p.Func == "" {
+		return v
+	}
+	return PROJECTION_FUNCS[p.Func](fmt.Sprint(v))
+}
+
+// 值是否为整数
+func (p Projection) numeric() bool {
+	return p.Func == "length" || p.Func == "" && p.Column == "id"
+}
+
+// select [* | COLUMN [[as] ALIAS], ... [from TABLE [[as] ALIAS]]]，从第1个单词到end之前
+func (stat *Statement) prepareSelectList(parts []Token, end int) error {
+	stat.TableName = USERS_TABLE
+	from := slices.IndexFunc(parts[:end], func(t Token) bool { return t.is("from") })
+	if from < 0 {
+		return stat.prepareProjection(parts, end)
+	}
+	// from之后的单词数
+	n := end - from - 1
+	switch {
+	case from == 1:
+		return stat.syntaxError(parts, 1, "")
+	case n == 0:
+		return stat.syntaxError(parts, from+1, "")
+	case n == 2 && parts[from+2].is("as"):
+		return stat.syntaxError(parts, from+3, "")
+	case n == 3 && !parts[from+2].is("as"):
+		return stat.syntaxError(parts, from+3, "")
+	case n > 3:
+		return stat.syntaxError(parts, from+4, "")
+	}
+	stat.TableName = parts[from+1].Text
+	if n > 1 {
+		if msg := checkAlias(parts[end-1]); msg != "" {
+			return stat.syntaxError(parts, end-1, msg)
+		}
+		stat.TableAlias = strings.ToLower(parts[end-1].Text)
+	}
+	return stat.prepareProjection(parts, from)
+}
+
+// 从第1个单词到end之前的输出列，逗号前后可以有空格。没有列或只有 * 时输出所有列
+func (stat *Statement) prepareProjection(parts []Token, end int) error {
+	if end == 1 || end == 2 && parts[1].Text == "*" {
+		return nil
+	}
+	// 把逗号拆成单独的单词，列表之后的单词保留用于报告错误位置
+	words := append(splitCommas(parts[1:end]), parts[end:]...)
+	listEnd := len(words) - (len(parts) - end)
+	var columns []Projection
+	for start := 0; start <= listEnd; {
+		stop := start
+		for stop < listEnd && !words[stop].is(",") {
+			stop++
+		}
+		p, bad, msg := stat.prepareSelectItem(words, start, stop)
+		if bad >= 0 {
+			return stat.syntaxError(words, bad, msg)
+		}
+		columns = append(columns, p)
+		start = stop + 1
+	}
+	stat.Columns = columns
+	return nil
+}
+
+// 一个输出列：EXPR、EXPR ALIAS 或 EXPR as ALIAS，出错时返回出错的单词
+func (stat *Statement) prepareSelectItem(words []Token, start, stop int) (Projection, int, string) {
+	var p Projection
+	switch n := stop - start; {
+	case n == 0 || words[start].Quoted:
+		return p, start, ""
+	case n == 2 && words[start+1].is("as"):
+		return p, stop, ""
+	case n == 3 && !words[start+1].is("as"):
+		return p, start + 2, "expected a comma"
+	case n > 3:
+		return p, start + 3, "expected a comma"
+	}
+	p, msg := stat.parseProjection(words[start].Text)
+	if msg != "" {
+		return p, start, msg
+	}
+	if stop-start > 1 {
+		if msg := checkAlias(words[stop-1]); msg != "" {
+			return p, stop - 1, msg
+		}
+		p.Alias = words[stop-1].Text
+	}
+	return p, -1, ""
+}
+
+// 把单词中的逗号拆成单独的单词，位置仍然对应原来的输入
+func splitCommas(parts []Token) []Token {
+	var words []Token
+	for _, t := range parts {
+		if t.Quoted {
+			words = append(words, t)
+			continue
+		}
+		start := 0
+		for i := 0; i <= len(t.Text); i++ {
+			if i < len(t.Text) && t.Text[i] != ',' {
+				continue
+			}
+			if i > start {
+				words = append(words, Token{Text: t.Text[start:i], Pos: t.Pos + start, End: t.Pos + i})
+			}
+			if i < len(t.Text) {
+				words = append(words, Token{Text: ",", Pos: t.Pos + i, End: t.Pos + i + 1})
+			}
+			start = i + 1
+		}
+	}
+	return words
+}
+
+// 别名只能包含字母、数字和下划线，不能是关键字
+func checkAlias(t Token) string {
+	if t.Quoted || t.Text == "" || t.Text[0] >= '0' && t.Text[0] <= '9' || slices.Contains(SQL_KEYWORDS, strings.ToLower(t.Text)) {
+		return "invalid alias"
+	}
+	for _, r := range t.Text {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "invalid alias"
+		}
+	}
+	return ""
+}
+
+func (stat *Statement) parseProjection(item string) (Projection, string) {
+	var p Projection
+	if open := strings.IndexByte(item, '('); open >= 0 {
+		if !strings.HasSuffix(item, ")") {
+			return p, "syntax error"
+		}
+		p.Func = strings.ToLower(item[:open])
+		if _, ok := PROJECTION_FUNCS[p.Func]; !ok {
+			return p, "no such function: " + p.Func
+		}
+		item = item[open+1 : len(item)-1]
+	}
+	column, ok := stat.columnRef(item)
+	if !ok {
+		return p, "no such column: " + item
+	}
+	p.Column = column
+	return p, ""
+}
+
+// 列名可以用表名或from中的别名限定，例如 u.id，返回不带限定的列名
+func (stat *Statement) columnRef(ref string) (string, bool) {
+	ref = strings.ToLower(ref)
+	if i := strings.LastIndexByte(ref, '.'); i >= 0 {
+		if ref[:i] != stat.qualifier() {
+			return "", false
+		}
+		ref = ref[i+1:]
+	}
+	return ref, slices.Contains(COLUMN_NAMES, ref)
+}
+
+// 限定列名时使用的名字：表的别名，没有别名时是不带数据库名的表名
+func (stat *Statement) qualifier() string {
+	if stat.TableAlias != "" {
+		return stat.TableAlias
+	}
+	name := strings.ToLower(stat.TableName)
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// 查询结果的列名
+func (stat *Statement) columnNames() []string {
+	if stat.Columns == nil {
+		return COLUMN_NAMES
+	}
+	names := make([]string, len(stat.Columns))
+	for i, p := range stat.Columns {
+		names[i] = p.name()
+	}
+	return names
+}
+
+// 一行中select输出的列的值
+func (stat *Statement) project(row *Row) []any {
+	if stat.Columns == nil {
+		return rowValues(row)
+	}
+	values := make([]any, len(stat.Columns))
+	for i, p := range stat.Columns {
+		values[i] = p.value(row)
+	}
+	return values
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestProjectionColumnsAndAliases(t *testing.T) {
+	stat := &Statement{}
+	if err := stat.prepareStatement("select u.id, upper(username) as name, length(u.email) len from users as u where u.id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stat.columnNames(), []string{"id", "name", "len"}; !slices.Equal(got, want) {
+		t.Errorf("column names %v, want %v", got, want)
+	}
+	row := Row{ID: 1}
+	copy(row.Username[:], "alice")
+	copy(row.Email[:], "alice@example.com")
+	if got, want := fmt.Sprint(stat.project(&row)), "[1 ALICE 17]"; got != want {
+		t.Errorf("projected row %s, want %s", got, want)
+	}
+	if stat.Where == nil || stat.Where.Column != "id" {
+		t.Errorf("where on the aliased table: %+v", stat.Where)
+	}
+
+	// 没有列表时输出所有列
+	stat = &Statement{}
+	if err := stat.prepareStatement("select * from users"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stat.columnNames(), COLUMN_NAMES) {
+		t.Errorf("select * columns %v", stat.columnNames())
+	}
+}
+
+func TestProjectionErrors(t *testing.T) {
+	for _, text := range []string{
+		"select nope from users",
+		"select reverse(username) from users",
+		"select users.id from users u",
+		"select id as select from users",
+		"select id username email from users",
+	} {
+		stat := &Statement{}
+		if err := stat.prepareStatement(text); !errors.Is(err, ErrPrepareSyntax) {
+			t.Errorf("%s: got %v, want a syntax error", text, err)
+		}
+	}
+}
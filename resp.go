@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RESP协议的键值接口，命令作用于连接选择的数据库中main数据库的键值表。
+// serve --data-dir 时用 SELECT NAME 选择数据库，和 use NAME 一样需要重新认证，
+// SELECT 0 和 SELECT main 选择默认数据库
+const (
+	RESP_MAX_BULK_LENGTH = 1 << 20
+	RESP_MAX_ARGS        = 1024
+	RESP_SCAN_COUNT      = 10
+	RESP_DEFAULT_USER    = "default"
+)
+
+var ErrRespProtocol = fmt.Errorf("protocol error")
+
+// 键值命令需要的表权限
+var RESP_COMMAND_PRIVILEGES = map[string]string{
+	"GET":  PRIVILEGE_SELECT,
+	"SCAN": PRIVILEGE_SELECT,
+	"SET":  PRIVILEGE_INSERT,
+	"DEL":  PRIVILEGE_DELETE,
+}
+
+func (s *Server) handleRespConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	user, authenticated := "", false
+	c := s.catalog
+	// MULTI之后排队的命令，为nil表示不在MULTI中；aborted表示排队时出过错，EXEC时放弃
+	var queued [][]string
+	aborted := false
+	for {
+		args, err := readRespCommand(reader)
+		if err != nil {
+			if err != io.EOF {
+				writeRespError(w, err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "QUIT":
+			writeRespSimple(w, "OK")
+			w.Flush()
+			return
+		case cmd == "AUTH":
+			// AUTH password 或 AUTH username password
+			if name, err := respAuth(c, args[1:]); err != nil {
+				writeRespError(w, err.Error())
+			} else {
+				user, authenticated = name, true
+				writeRespSimple(w, "OK")
+			}
+		case cmd == "SELECT" && queued == nil:
+			// SELECT NAME，用户属于各自的数据库，切换后需要重新认证。
+			// 客户端默认发送的 SELECT 0 选择默认数据库
+			if len(args) != 2 {
+				writeRespError(w, "wrong number of arguments for 'select' command")
+			} else if selected, err := s.tenant(respDatabase(args[1])); err != nil {
+				writeRespError(w, err.Error())
+			} else {
+				if selected != c {
+					c, user, authenticated = selected, "", false
+				}
+				writeRespSimple(w, "OK")
+			}
+		case checkAuth(c, authenticated) != nil:
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+		case s.rates.allow(conn.RemoteAddr().String()) != nil:
+			writeRespError(w, ErrRateLimited.Error())
+		case cmd == "MULTI":
+			if queued != nil {
+				writeRespError(w, "MULTI calls can not be nested")
+				break
+			}
+			queued, aborted = [][]string{}, false
+			writeRespSimple(w, "OK")
+		case (cmd == "EXEC" || cmd == "DISCARD") && queued == nil:
+			writeRespError(w, cmd+" without MULTI")
+		case cmd == "EXEC" && aborted:
+			queued = nil
+			fmt.Fprint(w, "-EXECABORT Transaction discarded because of previous errors.\r\n")
+		case cmd == "EXEC":
+			respExec(w, c, queued)
+			queued = nil
+		case cmd == "DISCARD":
+			queued = nil
+			writeRespSimple(w, "OK")
+		case queued != nil:
+			if err := respQueue(c, args, user); err != nil {
+				aborted = true
+				writeRespError(w, err.Error())
+				break
+			}
+			queued = append(queued, args)
+			writeRespSimple(w, "QUEUED")
+		default:
+			s.respCommand(w, c, args, user)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) respCommand(w *bufio.Writer, c *Catalog, args []string, user string) {
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		writeRespError(w, err.Error())
+		return
+	}
+
+	cmd := strings.ToUpper(args[0])
+	if privilege, ok := RESP_COMMAND_PRIVILEGES[cmd]; ok {
+		if err := c.authorizeKV(user, privilege); err != nil {
+			writeRespError(w, err.Error())
+			return
+		}
+	}
+
+	switch {
+	case cmd == "PING" && len(args) == 1:
+		writeRespSimple(w, "PONG")
+	case cmd == "PING" && len(args) == 2:
+		writeRespBulk(w, []byte(args[1]))
+	case cmd == "COMMAND":
+		// redis-cli连接时会发送COMMAND DOCS
+		fmt.Fprint(w, "*0\r\n")
+	case cmd == "GET" && len(args) == 2:
+		value, ok, err := kv.Get([]byte(args[1]))
+		switch {
+		case err != nil:
+			writeRespError(w, err.Error())
+		case !ok:
+			fmt.Fprint(w, "$-1\r\n")
+		default:
+			writeRespBulk(w, value)
+		}
+	case cmd == "SET" && len(args) == 3:
+		if err := kv.Put([]byte(args[1]), []byte(args[2])); err != nil {
+			writeRespError(w, err.Error())
+			return
+		}
+		writeRespSimple(w, "OK")
+	case cmd == "DEL" && len(args) >= 2:
+		deleted := 0
+		for _, key := range args[1:] {
+			ok, err := kv.Delete([]byte(key))
+			if err != nil {
+				writeRespError(w, err.Error())
+				return
+			}
+			if ok {
+				deleted++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case cmd == "SCAN" && len(args) >= 2:
+		s.respScan(w, kv, args[1:])
+	case cmd == "PING" || cmd == "GET" || cmd == "SET" || cmd == "DEL" || cmd == "SCAN":
+		writeRespError(w, fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	default:
+		writeRespError(w, fmt.Sprintf("unknown command '%s'", args[0]))
+	}
+}
+
+// MULTI中只能排队SET和DEL，排队时检查参数和权限
+func respQueue(c *Catalog, args []string, user string) error {
+	cmd := strings.ToUpper(args[0])
+	switch {
+	case cmd != "SET" && cmd != "DEL":
+		return fmt.Errorf("only SET and DEL can be used inside MULTI")
+	case cmd == "SET" && len(args) != 3, cmd == "DEL" && len(args) < 2:
+		return fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(cmd))
+	case cmd == "SET":
+		if err := checkKV([]byte(args[1]), []byte(args[2])); err != nil {
+			return err
+		}
+	}
+	return c.authorizeKV(user, RESP_COMMAND_PRIVILEGES[cmd])
+}
+
+// EXEC把排队的命令作为一个WriteBatch提交，返回每条命令的结果
+func respExec(w *bufio.Writer, c *Catalog, queued [][]string) {
+	kv, err := c.kvTable(MAIN_DATABASE)
+	if err != nil {
+		writeRespError(w, err.Error())
+		return
+	}
+	var batch WriteBatch
+	for _, args := range queued {
+		if strings.EqualFold(args[0], "SET") {
+			batch.Put(kv, []byte(args[1]), []byte(args[2]))
+			continue
+		}
+		for _, key := range args[1:] {
+			batch.Delete(kv, []byte(key))
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		writeRespError(w, err.Error())
+		return
+	}
+
+	fmt.Fprintf(w, "*%d\r\n", len(queued))
+	ops := batch.ops
+	for _, args := range queued {
+		if strings.EqualFold(args[0], "SET") {
+			ops = ops[1:]
+			writeRespSimple(w, "OK")
+			continue
+		}
+		deleted := 0
+		for _, op := range ops[:len(args)-1] {
+			if op.found {
+				deleted++
+			}
+		}
+		ops = ops[len(args)-1:]
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	}
+}
+
+func respAuth(c *Catalog, args []string) (string, error) {
+	var user, password string
+	switch len(args) {
+	case 1:
+		user, password = RESP_DEFAULT_USER, args[0]
+	case 2:
+		user, password = args[0], args[1]
+	default:
+		return "", fmt.Errorf("wrong number of arguments for 'auth' command")
+	}
+	if err := c.authenticate(user, password); err != nil {
+		return "", err
+	}
+	return user, nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count]
+func (s *Server) respScan(w *bufio.Writer, kv *KVTable, args []string) {
+	cursor, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		writeRespError(w, "invalid cursor")
+		return
+	}
+
+	pattern, count := "", RESP_SCAN_COUNT
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			writeRespError(w, "syntax error")
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				writeRespError(w, "value is not an integer or out of range")
+				return
+			}
+		default:
+			writeRespError(w, "syntax error")
+			return
+		}
+	}
+
+	keys, next, err := kv.Scan(uint32(cursor), pattern, count)
+	if err != nil {
+		writeRespError(w, err.Error())
+		return
+	}
+	fmt.Fprint(w, "*2\r\n")
+	writeRespBulk(w, []byte(strconv.FormatUint(uint64(next), 10)))
+	fmt.Fprintf(w, "*%d\r\n", len(keys))
+	for _, key := range keys {
+		writeRespBulk(w, key)
+	}
+}
+
+// SELECT的参数，redis的0号数据库对应默认数据库
+func respDatabase(name string) string {
+	if name == "0" {
+		return DEFAULT_TENANT
+	}
+	return name
+}
+
+// 读取一条命令，支持RESP数组格式和telnet风格的内联命令
+func readRespCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRespLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > RESP_MAX_ARGS {
+		return nil, ErrRespProtocol
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readRespLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, ErrRespProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > RESP_MAX_BULK_LENGTH {
+			return nil, ErrRespProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readRespLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeRespSimple(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+func writeRespError(w *bufio.Writer, message string) {
+	fmt.Fprintf(w, "-ERR %s\r\n", message)
+}
+
+func writeRespBulk(w *bufio.Writer, b []byte) {
+	fmt.Fprintf(w, "$%d\r\n", len(b))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
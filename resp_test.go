@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type respTestCase struct{ cmd, want string }
+
+// 读取一个完整的响应，块字符串和数组的各部分以空格连接
+func readRespTestReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	n, _ := strconv.Atoi(line[1:])
+	switch {
+	case line[0] == '$' && n >= 0:
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return "", err
+		}
+		return line + " " + string(value[:n]), nil
+	case line[0] == '*':
+		parts := []string{line}
+		for range n {
+			part, err := readRespTestReply(r)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, " "), nil
+	}
+	return line, nil
+}
+
+// 在一个RESP连接上依次发送内联命令，检查每条命令的响应
+func respTestCommands(t *testing.T, s *Server, cases []respTestCase) {
+	t.Helper()
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.handleRespConn(server)
+	r := bufio.NewReader(client)
+
+	for _, tc := range cases {
+		if _, err := client.Write([]byte(tc.cmd + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readRespTestReply(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+}
+
+func TestRespSelectDefaultDatabase(t *testing.T) {
+	respTestCommands(t, newTestServer(t), []respTestCase{
+		{"SELECT 0", "+OK"},
+		{"SELECT main", "+OK"},
+		{"SELECT other", "-ERR selecting a database requires serve --data-dir"},
+		{"SET k v", "+OK"},
+	})
+}
+
+func TestRespSelectDefaultKeepsAuth(t *testing.T) {
+	s := newTestServer(t)
+	admin := NewSession(s.catalog, "", "test")
+	defer admin.close()
+	execTest(t, admin, "create user alice password secret superuser")
+
+	// 客户端认证之后发送 SELECT 0，不应要求重新认证
+	respTestCommands(t, s, []respTestCase{
+		{"AUTH alice secret", "+OK"},
+		{"SELECT 0", "+OK"},
+		{"SET k v", "+OK"},
+	})
+}
+
+func TestRespKeyValueCommands(t *testing.T) {
+	respTestCommands(t, newTestServer(t), []respTestCase{
+		{"PING", "+PONG"},
+		{"PING hello", "$5 hello"},
+		{"GET a", "$-1"},
+		{"SET a 1", "+OK"},
+		{"SET b 22", "+OK"},
+		{"SET other 3", "+OK"},
+		{"GET b", "$2 22"},
+		{"SCAN 0 MATCH ? COUNT 10", "*2 $1 0 *2 $1 a $1 b"},
+		{"DEL a other missing", ":2"},
+		{"GET a", "$-1"},
+		{"SET a", "-ERR wrong number of arguments for 'set' command"},
+		{"SCAN x", "-ERR invalid cursor"},
+		{"FLUSHALL", "-ERR unknown command 'FLUSHALL'"},
+	})
+}
+
+func TestRespMultiExec(t *testing.T) {
+	s := newTestServer(t)
+	respTestCommands(t, s, []respTestCase{
+		{"EXEC", "-ERR EXEC without MULTI"},
+		{"SET a 1", "+OK"},
+		{"MULTI", "+OK"},
+		{"SET b 2", "+QUEUED"},
+		{"DEL a missing", "+QUEUED"},
+		// 排队的命令在EXEC之前不可见
+		{"EXEC", "*2 +OK :1"},
+		{"GET a", "$-1"},
+		{"GET b", "$1 2"},
+
+		// 排队时出错的事务整个放弃
+		{"MULTI", "+OK"},
+		{"SET c 3", "+QUEUED"},
+		{"GET b", "-ERR only SET and DEL can be used inside MULTI"},
+		{"EXEC", "-EXECABORT Transaction discarded because of previous errors."},
+		{"GET c", "$-1"},
+
+		{"MULTI", "+OK"},
+		{"SET c 3", "+QUEUED"},
+		{"DISCARD", "+OK"},
+		{"GET c", "$-1"},
+	})
+}
+
+func TestRespRequiresAuth(t *testing.T) {
+	s := newTestServer(t)
+	admin := NewSession(s.catalog, "", "test")
+	defer admin.close()
+	execTest(t, admin, "create user alice password secret superuser")
+	execTest(t, admin, "create user default password pw")
+
+	respTestCommands(t, s, []respTestCase{
+		{"GET k", "-NOAUTH Authentication required."},
+		{"AUTH alice wrong", "-ERR " + ErrAuthFailed.Error()},
+		{"AUTH pw", "+OK"},
+		{"SET k v", "-ERR " + ErrPermissionDenied.Error() + ": insert on main.kv"},
+		{"AUTH alice secret", "+OK"},
+		{"SET k v", "+OK"},
+	})
+}
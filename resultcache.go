@@ -0,0 +1,141 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// ResultCache 按语句文本缓存查询结果。每个结果记下查询时表的版本，
+// 表有写入后版本增加，旧的结果不再使用。总行数超过上限时丢弃最久未使用的结果，
+// 上限由pragma result_cache_rows设置，0表示不缓存
+type ResultCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResult
+	// 最后一个是最近使用的
+	recent  []string
+	rows    int
+	maxRows int
+}
+
+type cachedResult struct {
+	table   *Table
+	version uint64
+	rows    []Row
+}
+
+// 查找仍然有效的结果，表已经改变时丢弃旧的结果
+func (rc *ResultCache) get(text string, t *Table) ([]Row, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[text]
+	if !ok {
+		metricResultCacheMisses.Add(1)
+		return nil, false
+	}
+	if entry.table != t || entry.version != t.version {
+		rc.remove(text)
+		metricResultCacheMisses.Add(1)
+		return nil, false
+	}
+	rc.touch(text)
+	metricResultCacheHits.Add(1)
+	return entry.rows, true
+}
+
+func (rc *ResultCache) put(text string, t *Table, version uint64, rows []Row) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if len(rows) > rc.maxRows {
+		return
+	}
+	if _, ok := rc.entries[text]; ok {
+		rc.remove(text)
+	}
+	if rc.entries == nil {
+		rc.entries = map[string]*cachedResult{}
+	}
+	rc.entries[text] = &cachedResult{table: t, version: version, rows: rows}
+	rc.rows += len(rows)
+	rc.touch(text)
+	rc.shrink()
+}
+
+func (rc *ResultCache) touch(text string) {
+	if i := slices.Index(rc.recent, text); i >= 0 {
+		rc.recent = slices.Delete(rc.recent, i, i+1)
+	}
+	rc.recent = append(rc.recent, text)
+}
+
+func (rc *ResultCache) remove(text string) {
+	rc.rows -= len(rc.entries[text].rows)
+	delete(rc.entries, text)
+	if i := slices.Index(rc.recent, text); i >= 0 {
+		rc.recent = slices.Delete(rc.recent, i, i+1)
+	}
+}
+
+// 丢弃最久未使用的结果直到总行数不超过上限
+func (rc *ResultCache) shrink() {
+	for rc.rows > rc.maxRows && len(rc.recent) > 0 {
+		rc.remove(rc.recent[0])
+	}
+	// 上限为0时空结果也不保留
+	if rc.maxRows == 0 {
+		clear(rc.entries)
+		rc.recent = nil
+	}
+}
+
+func (rc *ResultCache) resize(maxRows int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.maxRows = maxRows
+	rc.shrink()
+}
+
+func (rc *ResultCache) enabled() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.maxRows > 0
+}
+
+// 缓存的结果数和行数
+func (rc *ResultCache) size() (int, int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return len(rc.entries), rc.rows
+}
+
+// 执行查询，可以时使用或保存缓存的结果。只缓存完整读完的结果，
+// 事务中的查询没有语句文本，不使用缓存
+func (c *Catalog) cachedSelect(stat *Statement, t *Table, handle RowHandler, run func(RowHandler) error) error {
+	if stat.Text == "" || stat.Snapshot != nil || !c.resultCache.enabled() {
+		return run(handle)
+	}
+	if rows, ok := c.resultCache.get(stat.Text, t); ok {
+		handle = c.withTimeout(withContext(stat.Ctx, handle))
+		for i := range rows {
+			row := rows[i]
+			if err := handle(&row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	version := t.version
+	var rows []Row
+	err := run(func(row *Row) error {
+		rows = append(rows, *row)
+		return handle(row)
+	})
+	if err == nil {
+		c.resultCache.put(stat.Text, t, version, rows)
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResultCacheInvalidatedByWrites(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "pragma result_cache_rows = 10")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "select")
+	hits := metricResultCacheHits.Value()
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("cached select returned %v", got)
+	}
+	if metricResultCacheHits.Value() != hits+1 {
+		t.Error("repeated select did not use the cache")
+	}
+
+	execTest(t, s, "insert 2 bob bob@example.com")
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("select after insert returned %v, want [1 2]", got)
+	}
+
+	execTest(t, s, "pragma result_cache_rows = 0")
+	if results, rows := c.resultCache.size(); results != 0 || rows != 0 {
+		t.Errorf("disabled cache holds %d results with %d rows", results, rows)
+	}
+}
+
+func TestResultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var rc ResultCache
+	rc.resize(3)
+	tbl := &Table{}
+	rc.put("a", tbl, 0, make([]Row, 2))
+	rc.put("b", tbl, 0, make([]Row, 1))
+	rc.get("a", tbl)
+	// 超过上限时丢弃最久未使用的b
+	rc.put("c", tbl, 0, make([]Row, 1))
+	if _, ok := rc.get("b", tbl); ok {
+		t.Error("least recently used result was kept")
+	}
+	if _, ok := rc.get("a", tbl); !ok {
+		t.Error("recently used result was dropped")
+	}
+	// 超过上限的结果不缓存
+	rc.put("d", tbl, 0, make([]Row, 4))
+	if _, ok := rc.get("d", tbl); ok {
+		t.Error("result larger than the cache was kept")
+	}
+}
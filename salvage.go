@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// 从损坏的数据库文件中逐页读取能解码的行，写入新的数据库文件。
+// 文件中没有校验和，无法读取的页整页跳过，内容不像合法行的槽位逐行跳过。
+// 只恢复users表，账户、权限、键值和序列等附属文件不处理
+func runSalvage(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: golitedb salvage BROKEN_FILENAME OUTPUT_FILENAME")
+	}
+	src, err := os.Open(args[0])
+	if err != nil {
+		return ioError(err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return ioError(err)
+	}
+	// 不覆盖已有的文件，以免把恢复结果追加到其他数据库
+	if _, err := os.Stat(args[1]); err == nil {
+		return fmt.Errorf("%s already exists", args[1])
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return ioError(err)
+	}
+
+	dst, err := dbOpen(args[1])
+	if err != nil {
+		return err
+	}
+
+	var salvaged, skippedRows, skippedPages int
+	page := make([]byte, PAGE_SIZE)
+	var row Row
+	for offset := int64(0); offset < info.Size(); offset += PAGE_SIZE {
+		n, err := src.ReadAt(page, offset)
+		if n == 0 && err != nil {
+			skippedPages++
+			continue
+		}
+		for slot := 0; slot+ROW_SIZE <= n && slot/ROW_SIZE < ROWS_PER_PAGE; slot += ROW_SIZE {
+			if !validRow(page[slot : slot+ROW_SIZE]) {
+				skippedRows++
+				continue
+			}
+			deserializeRow(page[slot:slot+ROW_SIZE], &row)
+			if err := dst.insertRow(&row); err != nil {
+				dst.close()
+				return err
+			}
+			salvaged++
+		}
+	}
+	if err := dst.close(); err != nil {
+		return err
+	}
+	fmt.Printf("salvaged %d rows, skipped %d damaged rows and %d unreadable pages\n",
+		salvaged, skippedRows, skippedPages)
+	return nil
+}
+
+// id之后的填充必须为0，文本列必须是合法的UTF-8，第一个NUL之后只能是填充的NUL
+func validRow(slot []byte) bool {
+	if len(bytes.TrimLeft(slot[ID_OFFSET+4:ID_SIZE], "\x00")) > 0 {
+		return false
+	}
+	for _, column := range [][]byte{
+		slot[USERNAME_OFFSET : USERNAME_OFFSET+COLUMN_USERNAME_SIZE],
+		slot[EMAIL_OFFSET : EMAIL_OFFSET+COLUMN_EMAIL_SIZE],
+	} {
+		text, padding, _ := bytes.Cut(column, []byte{0})
+		if !utf8.Valid(text) || len(bytes.TrimLeft(padding, "\x00")) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSalvageSkipsDamagedRows(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.db")
+	c, err := NewCatalog(broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	for _, text := range []string{
+		"insert 1 alice alice@example.com",
+		"insert 2 bob bob@example.com",
+		"insert 3 carol carol@example.com",
+	} {
+		execTest(t, s, text)
+	}
+	s.close()
+	if err := c.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二行的用户名改成不合法的UTF-8
+	f, err := os.OpenFile(broken, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff, 0xfe}, ROW_SIZE+USERNAME_OFFSET); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	salvaged := filepath.Join(dir, "salvaged.db")
+	if err := runSalvage([]string{broken, salvaged}); err != nil {
+		t.Fatal(err)
+	}
+	// 不覆盖已有的文件
+	if err := runSalvage([]string{broken, salvaged}); err == nil {
+		t.Error("salvage overwrote an existing file")
+	}
+
+	c, err = NewCatalog(salvaged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1, 3}) {
+		t.Errorf("salvaged ids %v, want [1 3]", got)
+	}
+}
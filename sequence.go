@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 序列保存在main数据库的 FILENAME-seq 键值表中，键是序列名，
+// 值是 "下一个值,增量"
+const SEQUENCE_FILE_SUFFIX = "-seq"
+
+var (
+	ErrUnknownSequence   = fmt.Errorf("no such sequence")
+	ErrSequenceExists    = fmt.Errorf("sequence already exists")
+	ErrSequenceExhausted = fmt.Errorf("sequence reached its limit")
+)
+
+func (db *Database) sequenceTable() (*KVTable, error) {
+	return db.sidecar(SEQUENCE_FILE_SUFFIX)
+}
+
+// create sequence NAME [start [with] N] [increment [by] N]
+func (stat *Statement) prepareCreateSequence(parts []Token) error {
+	if len(parts) < 3 {
+		return stat.syntaxError(parts, 2, "")
+	}
+	stat.Typ = StatementTypeCreateSequence
+	stat.Name = strings.ToLower(parts[2].Text)
+	stat.Start, stat.Increment = 1, 1
+	for i := 3; i < len(parts); i++ {
+		option := parts[i].keyword()
+		if option != "start" && option != "increment" {
+			return stat.syntaxError(parts, i, "")
+		}
+		if i+1 < len(parts) && (option == "start" && parts[i+1].is("with") || option == "increment" && parts[i+1].is("by")) {
+			i++
+		}
+		if i+1 >= len(parts) {
+			return stat.syntaxError(parts, i+1, "")
+		}
+		i++
+		n, err := strconv.ParseInt(parts[i].Text, 10, 64)
+		if err != nil {
+			return stat.syntaxError(parts, i, "invalid number")
+		}
+		if option == "start" {
+			stat.Start = n
+		} else if n == 0 {
+			return stat.syntaxError(parts, i, "increment must not be zero")
+		} else {
+			stat.Increment = n
+		}
+	}
+	return nil
+}
+
+// select nextval('NAME')
+func (stat *Statement) prepareNextval(parts []Token) error {
+	var call strings.Builder
+	for _, p := range parts[1:] {
+		call.WriteString(p.Text)
+	}
+	name, ok := strings.CutPrefix(strings.ToLower(call.String()), "nextval(")
+	name, closed := strings.CutSuffix(name, ")")
+	if !ok || !closed || name == "" {
+		return stat.syntaxError(parts, 1, "")
+	}
+	stat.Typ = StatementTypeNextval
+	stat.Name = name
+	return nil
+}
+
+func (c *Catalog) executeCreateSequence(stat *Statement) error {
+	seqs, err := c.databases[MAIN_DATABASE].sequenceTable()
+	if err != nil {
+		return err
+	}
+	if _, ok, err := seqs.Get([]byte(stat.Name)); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%w: %s", ErrSequenceExists, stat.Name)
+	}
+	return seqs.Put([]byte(stat.Name), []byte(fmt.Sprintf("%d,%d", stat.Start, stat.Increment)))
+}
+
+// 返回序列的下一个值并立即写回，事务回滚时不会撤销
+func (c *Catalog) executeNextval(stat *Statement) error {
+	seqs, err := c.databases[MAIN_DATABASE].sequenceTable()
+	if err != nil {
+		return err
+	}
+	value, ok, err := seqs.Get([]byte(stat.Name))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSequence, stat.Name)
+	}
+	nextText, incText, _ := strings.Cut(string(value), ",")
+	next, err := strconv.ParseInt(nextText, 10, 64)
+	if err != nil {
+		return fmt.Errorf("corrupt sequence %s: %w", stat.Name, err)
+	}
+	inc, err := strconv.ParseInt(incText, 10, 64)
+	if err != nil {
+		return fmt.Errorf("corrupt sequence %s: %w", stat.Name, err)
+	}
+	following := next + inc
+	if inc > 0 && following < next || inc < 0 && following > next {
+		return fmt.Errorf("%w: %s", ErrSequenceExhausted, stat.Name)
+	}
+	if err := seqs.Put([]byte(stat.Name), []byte(fmt.Sprintf("%d,%d", following, inc))); err != nil {
+		return err
+	}
+	stat.Result = strconv.FormatInt(next, 10)
+	return nil
+}
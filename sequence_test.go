@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSequenceNextval(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "create sequence ids start with 10 increment by 5")
+	if err := execTestErr(t, s, "create sequence IDS"); !errors.Is(err, ErrSequenceExists) {
+		t.Errorf("duplicate sequence: got %v, want ErrSequenceExists", err)
+	}
+	for _, want := range []string{"10", "15"} {
+		if got := pragmaTest(t, s, "select nextval('ids')"); got != want {
+			t.Errorf("nextval = %s, want %s", got, want)
+		}
+	}
+	// 回滚不撤销已经取出的值
+	execTest(t, s, "begin")
+	pragmaTest(t, s, "select nextval('ids')")
+	execTest(t, s, "rollback")
+	s.close()
+
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := pragmaTest(t, s, "select nextval(ids)"); got != "25" {
+		t.Errorf("nextval after reopen = %s, want 25", got)
+	}
+	if err := execTestErr(t, s, "select nextval('missing')"); !errors.Is(err, ErrUnknownSequence) {
+		t.Errorf("unknown sequence: got %v, want ErrUnknownSequence", err)
+	}
+}
+
+func TestSequenceExhausted(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "create sequence small start 9223372036854775806")
+	if got := pragmaTest(t, s, "select nextval('small')"); got != "9223372036854775806" {
+		t.Errorf("nextval = %s", got)
+	}
+	if err := execTestErr(t, s, "select nextval('small')"); !errors.Is(err, ErrSequenceExhausted) {
+		t.Errorf("overflowing sequence: got %v, want ErrSequenceExhausted", err)
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// 服务模式的文本协议：
+// 客户端每行发送一条语句，服务端先返回结果行，
+// 最后以一行 "OK" 或 "ERR <message>" 结束本次响应。
+const (
+	RESPONSE_OK  = "OK"
+	RESPONSE_ERR = "ERR"
+)
+
+// 关闭服务时等待正在执行的请求结束的最长时间
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+type Server struct {
+	catalog   *Catalog
+	tlsConfig *tls.Config
+	audit     *AuditLog
+	slowLog   *SlowQueryLog
+	limits    ServerLimits
+	rates     *clientLimiters
+	conns     atomic.Int64
+	// 所有监听器打开后为true，开始关闭时恢复为false
+	ready atomic.Bool
+	// --data-dir 时连接可以选择的数据库，否则为nil，只有catalog一个数据库
+	tenants *Tenants
+
+	mu     sync.Mutex
+	active map[net.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", ":4040", "address to listen on")
+	pgListen := fs.String("pg", "", "address for the PostgreSQL wire protocol listener")
+	httpListen := fs.String("http", "", "address for the HTTP JSON API listener")
+	respListen := fs.String("resp", "", "address for the Redis protocol key-value listener")
+	metricsListen := fs.String("metrics", "", "address serving /metrics (Prometheus) and /debug/vars (expvar)")
+	adminListen := fs.String("admin", "", "address serving /healthz, /readyz, /debug/pprof and /debug/db (page cache, transactions, locks)")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file, enables TLS on all listeners")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	tlsClientCA := fs.String("tls-client-ca", "", "CA file used to require and verify client certificates")
+	auditLog := fs.String("audit-log", "", "append a record of every write statement to this file")
+	slowQueryLog := fs.String("slow-query-log", "", "record statements slower than --slow-query-threshold in this file")
+	slowQueryThreshold := fs.Duration("slow-query-threshold", 100*time.Millisecond, "minimum duration of statements written to the slow query log")
+	logLevel := fs.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", LOG_FORMAT_TEXT, "log output format: text or json")
+	dataDir := fs.String("data-dir", "", "serve every NAME.db file in this directory, selected per connection with use NAME, ?database=NAME or SELECT NAME")
+	var limits ServerLimits
+	fs.IntVar(&limits.maxConnections, "max-connections", 0, "maximum concurrent connections across all listeners (0 = unlimited)")
+	fs.Float64Var(&limits.statementsPerSecond, "max-statements-per-second", 0, "maximum statements per second per client (0 = unlimited)")
+	fs.IntVar(&limits.maxResultRows, "max-result-rows", 0, "maximum rows returned by a single query (0 = unlimited)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || *dataDir != "" && fs.NArg() > 0 {
+		return fmt.Errorf("usage: golitedb serve [--listen ADDR] [FILENAME | --data-dir DIR]")
+	}
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	var tenants *Tenants
+	var c *Catalog
+	if *dataDir != "" {
+		if tenants, err = newTenants(*dataDir); err != nil {
+			return err
+		}
+		defer tenants.close()
+		// 默认数据库不存在时创建
+		if c, err = tenants.open(DEFAULT_TENANT, true); err != nil {
+			return err
+		}
+	} else {
+		if c, err = NewCatalog(fs.Arg(0)); err != nil {
+			return err
+		}
+		defer c.close()
+	}
+
+	if required, err := c.authRequired(); err != nil {
+		return err
+	} else if !required {
+		slog.Warn("no users defined, network connections are not authenticated")
+	}
+
+	s := &Server{
+		catalog: c,
+		tenants: tenants,
+		limits:  limits,
+		rates:   newClientLimiters(limits.statementsPerSecond),
+		active:  make(map[net.Conn]struct{}),
+	}
+	s.tlsConfig, err = loadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		return err
+	}
+	if *auditLog != "" {
+		s.audit, err = openAuditLog(*auditLog)
+		if err != nil {
+			return err
+		}
+		defer s.audit.close()
+	}
+	if *slowQueryLog != "" {
+		s.slowLog, err = openSlowQueryLog(*slowQueryLog, *slowQueryThreshold)
+		if err != nil {
+			return err
+		}
+		defer s.slowLog.close()
+	}
+
+	httpServer := &http.Server{
+		Handler:  s.httpHandler(),
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	metricsServer := &http.Server{
+		Handler:  metricsHandler(),
+		ErrorLog: httpServer.ErrorLog,
+	}
+
+	adminServer := &http.Server{
+		Handler:  s.adminHandler(),
+		ErrorLog: httpServer.ErrorLog,
+	}
+
+	// postgres协议在连接建立后通过SSLRequest协商TLS，不直接包装监听器
+	listeners := []struct {
+		name  string
+		addr  string
+		tls   bool
+		serve func(net.Listener) error
+	}{
+		{"text protocol", *listen, true, func(l net.Listener) error { return s.serve(l, s.handleConn) }},
+		{"postgres protocol", *pgListen, false, func(l net.Listener) error { return s.serve(l, s.handlePgConn) }},
+		{"http api", *httpListen, true, func(l net.Listener) error { return httpServer.Serve(l) }},
+		{"resp", *respListen, true, func(l net.Listener) error { return s.serve(l, s.handleRespConn) }},
+		{"metrics", *metricsListen, true, func(l net.Listener) error { return metricsServer.Serve(l) }},
+		{"admin", *adminListen, true, func(l net.Listener) error { return adminServer.Serve(l) }},
+	}
+
+	var opened []net.Listener
+	defer func() {
+		for _, l := range opened {
+			l.Close()
+		}
+	}()
+
+	errCh := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		if ln.addr == "" {
+			continue
+		}
+		l, err := net.Listen("tcp", ln.addr)
+		if err != nil {
+			return err
+		}
+		opened = append(opened, l)
+		if s.limits.maxConnections > 0 {
+			l = &limitListener{Listener: l, active: &s.conns, max: int64(s.limits.maxConnections)}
+		}
+		if ln.tls && s.tlsConfig != nil {
+			l = tls.NewListener(l, s.tlsConfig)
+		}
+		slog.Info("listening", "listener", ln.name, "addr", l.Addr().String())
+		go func() { errCh <- ln.serve(l) }()
+	}
+
+	s.ready.Store(true)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	}
+	s.ready.Store(false)
+
+	// 先停止接受新连接，再关闭现有连接，未提交的事务随会话一起丢弃，
+	// 最后由defer关闭审计日志和数据库文件
+	for _, l := range opened {
+		l.Close()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	metricsServer.Shutdown(shutdownCtx)
+	adminServer.Shutdown(shutdownCtx)
+	s.closeConns(shutdownCtx)
+	return err
+}
+
+func loadTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func (s *Server) serve(l net.Listener, handle func(net.Conn)) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		s.track(conn, true)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.track(conn, false)
+			metricActiveConnections.Add(1)
+			defer metricActiveConnections.Add(-1)
+			slog.Debug("connection opened", "client", conn.RemoteAddr().String())
+			handle(conn)
+			slog.Debug("connection closed", "client", conn.RemoteAddr().String())
+		}()
+	}
+}
+
+func (s *Server) track(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		s.active[conn] = struct{}{}
+	} else {
+		delete(s.active, conn)
+	}
+}
+
+// 关闭所有连接并等待处理中的语句执行完
+func (s *Server) closeConns(ctx context.Context) {
+	s.mu.Lock()
+	for conn := range s.active {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("timed out waiting for connections to finish")
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+	user, authenticated := "", false
+	c := s.catalog
+	session := NewSession(c, user, conn.RemoteAddr().String())
+	defer func() { session.close() }()
+	for reader.Scan() {
+		input := strings.TrimSpace(reader.Text())
+		if input == "" {
+			continue
+		}
+		if input == ".exit" {
+			return
+		}
+
+		if parts := strings.Fields(input); parts[0] == "auth" {
+			name, password, err := parseAuth(input)
+			if err == nil {
+				err = c.authenticate(name, password)
+			}
+			if err == nil {
+				// 切换用户时丢弃原会话中未提交的事务
+				user, authenticated = name, true
+				session.close()
+				session = NewSession(c, user, conn.RemoteAddr().String())
+			}
+			writeResponse(w, err)
+		} else if parts[0] == "use" {
+			// use NAME，用户属于各自的数据库，切换后需要重新认证
+			var err error
+			if len(parts) != 2 {
+				err = ErrPrepareSyntax
+			} else if c, err = s.tenant(parts[1]); err == nil {
+				user, authenticated = "", false
+				session.close()
+				session = NewSession(c, user, conn.RemoteAddr().String())
+			} else {
+				c = session.catalog
+			}
+			writeResponse(w, err)
+		} else {
+			// 一行中以分号分隔的多条语句依次执行，每条语句单独返回结果
+			input, _ = stripComments(input)
+			for _, stmt := range splitStatements(input) {
+				if stmt == "" {
+					continue
+				}
+				err := checkAuth(c, authenticated)
+				if err == nil {
+					err = s.execute(session, stmt, w)
+				}
+				writeResponse(w, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// auth USER PASSWORD，和 create user 一样，包含空白的密码用单引号括起来
+func parseAuth(input string) (string, string, error) {
+	parts, err := tokenize(input)
+	if err != nil {
+		return "", "", err
+	}
+	if len(parts) != 3 {
+		return "", "", ErrPrepareSyntax
+	}
+	return parts[1].Text, parts[2].Text, nil
+}
+
+func writeResponse(w *bufio.Writer, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "%s %s\n", RESPONSE_ERR, err)
+	} else {
+		fmt.Fprintln(w, RESPONSE_OK)
+	}
+}
+
+func checkAuth(c *Catalog, authenticated bool) error {
+	if authenticated {
+		return nil
+	}
+	required, err := c.authRequired()
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrAuthRequired
+	}
+	return nil
+}
+
+func (s *Server) execute(session *Session, input string, w *bufio.Writer) error {
+	stat, err := prepareNetworkStatement(input)
+	if err != nil {
+		return err
+	}
+	if _, err = s.executeStatement(session, stat, printRows(w, session.resolve(stat))); err != nil {
+		return err
+	}
+	if stat.Result != "" {
+		fmt.Fprintln(w, stat.Result)
+	}
+	return nil
+}
+
+// 在连接的会话中执行语句，开启审计时记录所有写语句
+func (s *Server) executeStatement(session *Session, stat *Statement, handle RowHandler) (int, error) {
+	if err := s.rates.allow(session.client); err != nil {
+		return 0, err
+	}
+
+	returned := 0
+	count := func(row *Row) error {
+		returned++
+		return handle(row)
+	}
+	start := time.Now()
+	rows, err := session.execute(stat, limitRows(count, s.limits.maxResultRows))
+	elapsed := time.Since(start)
+
+	if s.audit != nil && session.isWrite(stat) {
+		if auditErr := s.audit.record(session.user, session.client, stat, rows, err); auditErr != nil {
+			slog.Error("audit log write failed", "error", auditErr)
+		}
+	}
+	if s.slowLog != nil {
+		// 查询记录返回的行数，写语句记录影响的行数
+		resolved := session.resolve(stat)
+		n := rows
+		if resolved.Typ == StatementTypeSelect {
+			n = returned
+		}
+		if logErr := s.slowLog.record(session.user, session.client, stat, describePlan(resolved), elapsed, n, err); logErr != nil {
+			slog.Error("slow query log write failed", "error", logErr)
+		}
+	}
+	return rows, err
+}
+
+// 在一个事务中依次执行多条语句并提交，只在提交时同步一次文件。
+// 任何一条失败时回滚整批，返回插入和删除的总行数
+func (s *Server) executeBatch(session *Session, stats []*Statement) (int, error) {
+	discard := func(*Row) error { return nil }
+	for i, stat := range stats {
+		switch session.resolve(stat).Typ {
+		case StatementTypeBegin, StatementTypeCommit, StatementTypeRollback,
+			StatementTypePrepareTransaction, StatementTypeCommitPrepared, StatementTypeRollbackPrepared:
+			return 0, fmt.Errorf("statement %d: %w", i+1, ErrNotAllowedInTx)
+		}
+	}
+	if _, err := s.executeStatement(session, &Statement{Typ: StatementTypeBegin, Text: "begin"}, discard); err != nil {
+		return 0, err
+	}
+	for i, stat := range stats {
+		if _, err := s.executeStatement(session, stat, discard); err != nil {
+			session.endTransaction()
+			return 0, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return s.executeStatement(session, &Statement{Typ: StatementTypeCommit, Text: "commit"}, discard)
+}
+
+// 网络连接上只接受SQL语句，不接受元命令
+func prepareNetworkStatement(input string) (*Statement, error) {
+	if strings.HasPrefix(input, ".") {
+		return nil, fmt.Errorf("meta commands are not supported over the network")
+	}
+
+	stat := &Statement{}
+	if err := stat.prepareStatement(input); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
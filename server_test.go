@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 在文本协议的连接上发送一行，返回第一行响应
+func serverTestLine(t *testing.T, r *bufio.Reader, conn net.Conn, line string) string {
+	t.Helper()
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(resp)
+}
+
+// 发送一行，返回n行响应
+func serverTestLines(t *testing.T, r *bufio.Reader, conn net.Conn, line string, n int) []string {
+	t.Helper()
+	lines := []string{serverTestLine(t, r, conn, line)}
+	for len(lines) < n {
+		resp, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(resp))
+	}
+	return lines
+}
+
+func TestAuthQuotedPassword(t *testing.T) {
+	s := newTestServer(t)
+	admin := NewSession(s.catalog, "", "test")
+	defer admin.close()
+	execTest(t, admin, "create user alice password 'correct horse battery'")
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.handleConn(server)
+	r := bufio.NewReader(client)
+
+	if got := serverTestLine(t, r, client, "auth alice correct horse battery"); !strings.HasPrefix(got, RESPONSE_ERR) {
+		t.Errorf("unquoted password with spaces: got %q, want an error", got)
+	}
+	if got := serverTestLine(t, r, client, "auth alice 'correct horse battery'"); got != RESPONSE_OK {
+		t.Errorf("quoted password: got %q, want %s", got, RESPONSE_OK)
+	}
+}
+
+func TestServerConnection(t *testing.T) {
+	s := newTestServer(t)
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.handleConn(server)
+	r := bufio.NewReader(client)
+
+	// 一行中的多条语句各自返回结果
+	if got := serverTestLines(t, r, client, "insert 1 alice alice@example.com; insert 2 bob bob@example.com", 2); !slices.Equal(got, []string{RESPONSE_OK, RESPONSE_OK}) {
+		t.Fatalf("insert: got %q", got)
+	}
+	want := []string{"(1, alice, alice@example.com)", "(2, bob, bob@example.com)", RESPONSE_OK}
+	if got := serverTestLines(t, r, client, "select * from users -- 全部", 3); !slices.Equal(got, want) {
+		t.Errorf("select: got %q, want %q", got, want)
+	}
+	if got := serverTestLine(t, r, client, "bogus"); !strings.HasPrefix(got, RESPONSE_ERR+" ") {
+		t.Errorf("bogus statement: got %q, want an error", got)
+	}
+	if got := serverTestLine(t, r, client, ".tables"); !strings.Contains(got, "meta commands") {
+		t.Errorf("meta command: got %q, want an error", got)
+	}
+	if got := serverTestLine(t, r, client, "use other"); !strings.HasPrefix(got, RESPONSE_ERR+" ") {
+		t.Errorf("use without --data-dir: got %q, want an error", got)
+	}
+}
+
+func TestServerConnectionRollsBackOnClose(t *testing.T) {
+	s := newTestServer(t)
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.handleConn(server)
+		close(done)
+	}()
+	r := bufio.NewReader(client)
+
+	for _, line := range []string{"begin", "insert 1 alice alice@example.com"} {
+		if got := serverTestLine(t, r, client, line); got != RESPONSE_OK {
+			t.Fatalf("%s: got %q", line, got)
+		}
+	}
+	client.Close()
+	<-done
+
+	session := NewSession(s.catalog, "", "test")
+	defer session.close()
+	if got := execTest(t, session, "select * from users"); len(got) != 0 {
+		t.Errorf("uncommitted rows %v are visible after the connection closed", got)
+	}
+	if n := len(s.catalog.transactions.list()); n != 0 {
+		t.Errorf("%d transactions left open", n)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTransactionActive      = fmt.Errorf("a transaction is already in progress")
+	ErrNoTransaction          = fmt.Errorf("no transaction is in progress")
+	ErrNotAllowedInTx         = fmt.Errorf("statement is not allowed inside a transaction")
+	ErrUnknownPreparedStmt    = fmt.Errorf("no such prepared statement")
+	ErrPreparedStatementExist = fmt.Errorf("prepared statement already exists")
+	ErrReadOnlyTransaction    = fmt.Errorf("statement is not allowed in a read-only transaction")
+)
+
+// Session 保存一个连接的状态：当前用户、事务和预处理语句，
+// 连接之间互不影响
+type Session struct {
+	catalog  *Catalog
+	user     string
+	client   string
+	tx       *Transaction
+	prepared map[string]*Statement
+	// 本会话的临时表，按不带数据库名的表名保存
+	temp map[string]*Table
+}
+
+// Transaction 缓存事务中插入的行，提交时在同一把锁内写入各表，
+// 提交失败时恢复各表的行数，因此要么全部写入要么全部不写入。
+// 事务读写过的表在提交或回滚前一直持有表锁
+//
+// 只读事务不加锁也不缓存行，查询读取事务开始时的快照
+type Transaction struct {
+	pending  map[string][]Row
+	order    []string
+	snapshot *Snapshot
+}
+
+func NewSession(c *Catalog, user, client string) *Session {
+	return &Session{
+		catalog:  c,
+		user:     user,
+		client:   client,
+		prepared: make(map[string]*Statement),
+	}
+}
+
+func (s *Session) inTransaction() bool {
+	return s.tx != nil
+}
+
+// 关闭会话时回滚未提交的事务
+func (s *Session) close() {
+	s.endTransaction()
+	clear(s.prepared)
+	s.dropTempTables()
+}
+
+// 结束事务并释放事务持有的表锁
+func (s *Session) endTransaction() {
+	if s.tx != nil {
+		if s.tx.snapshot != nil {
+			s.tx.snapshot.Release()
+		}
+		s.tx = nil
+		s.catalog.locks.releaseAll(s)
+		s.catalog.transactions.remove(s)
+		metricActiveTransactions.Add(-1)
+	}
+}
+
+func (s *Session) execute(stat *Statement, handle RowHandler) (int, error) {
+	if run := s.qualifyTemp(stat); run != stat {
+		// 结果写在副本上，需要交回调用者
+		orig := stat
+		defer func() { orig.Result = run.Result }()
+		stat = run
+	}
+	if err := s.catalog.authorize(s.user, stat); err != nil {
+		return 0, err
+	}
+	metricStatements.Add(stat.Typ.String(), 1)
+
+	switch stat.Typ {
+	case StatementTypeBegin:
+		if s.tx != nil {
+			return 0, ErrTransactionActive
+		}
+		tx := &Transaction{pending: make(map[string][]Row)}
+		if stat.ReadOnly {
+			snap, err := s.catalog.Snapshot()
+			if err != nil {
+				return 0, err
+			}
+			tx.snapshot = snap
+		}
+		s.tx = tx
+		s.catalog.transactions.add(s)
+		metricActiveTransactions.Add(1)
+		return 0, nil
+	case StatementTypeCommit:
+		if s.tx == nil {
+			return 0, ErrNoTransaction
+		}
+		tx := s.tx
+		n, err := s.catalog.commitTransaction(tx)
+		// 写入完成后就释放锁，其他事务不必等待fsync
+		s.endTransaction()
+		if err != nil {
+			return 0, err
+		}
+		return n, s.catalog.makeDurable(tx.order)
+	case StatementTypeRollback:
+		if s.tx == nil {
+			return 0, ErrNoTransaction
+		}
+		s.endTransaction()
+		return 0, nil
+	case StatementTypePrepareTransaction:
+		if s.tx == nil {
+			return 0, ErrNoTransaction
+		}
+		return 0, s.prepareTransaction(stat.Name)
+	case StatementTypeCommitPrepared:
+		if s.tx != nil {
+			return 0, ErrNotAllowedInTx
+		}
+		return s.catalog.commitPrepared(stat.Name)
+	case StatementTypeRollbackPrepared:
+		if s.tx != nil {
+			return 0, ErrNotAllowedInTx
+		}
+		return 0, s.catalog.rollbackPrepared(stat.Name)
+	case StatementTypePrepare:
+		if _, ok := s.prepared[stat.Name]; ok {
+			return 0, fmt.Errorf("%w: %s", ErrPreparedStatementExist, stat.Name)
+		}
+		s.prepared[stat.Name] = stat.Prepared
+		return 0, nil
+	case StatementTypeExecute:
+		prepared, ok := s.prepared[stat.Name]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownPreparedStmt, stat.Name)
+		}
+		// 预处理语句在多次执行之间共用，用副本带上这次执行的ctx
+		run := *prepared
+		run.Ctx = stat.Ctx
+		return s.execute(&run, handle)
+	case StatementTypeDeallocate:
+		if _, ok := s.prepared[stat.Name]; !ok {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownPreparedStmt, stat.Name)
+		}
+		delete(s.prepared, stat.Name)
+		return 0, nil
+	case StatementTypeExplain:
+		return 0, s.explain(stat)
+	case StatementTypePragma, StatementTypeNextval:
+		// 设置和序列不属于事务，立即生效
+		return s.catalog.executeStatement(stat, handle)
+	case StatementTypeCreateTempTable:
+		return s.createTempTable(stat)
+	}
+
+	if stat.Typ == StatementTypeSelect {
+		handle = limitRows(handle, s.catalog.maxResultRows())
+	}
+	return s.run(stat, handle)
+}
+
+// 按会话的事务状态执行读写表的语句
+func (s *Session) run(stat *Statement, handle RowHandler) (int, error) {
+	if isTempTable(stat.TableName) {
+		// 临时表的写入无法回滚
+		if s.tx != nil && stat.Typ != StatementTypeSelect {
+			return 0, ErrNotAllowedInTx
+		}
+		// 临时表只属于本会话，不需要加锁，也不需要同步到磁盘
+		return s.catalog.executeStatement(stat, handle)
+	}
+	if s.tx != nil && s.tx.snapshot != nil {
+		return s.executeReadOnly(stat, handle)
+	}
+	if err := s.lockTables(stat); err != nil {
+		if s.tx == nil {
+			s.catalog.locks.releaseAll(s)
+		} else if errors.Is(err, ErrDeadlock) {
+			// 回滚事务，释放它的锁让环中的其他事务继续
+			s.endTransaction()
+			return 0, fmt.Errorf("%w, transaction rolled back", err)
+		}
+		return 0, err
+	}
+	if s.tx != nil {
+		return s.executeInTransaction(stat, handle)
+	}
+	n, err := s.catalog.executeStatement(stat, handle)
+	s.catalog.locks.releaseAll(s)
+	switch stat.Typ {
+	case StatementTypeInsert, StatementTypeInsertSelect, StatementTypeTruncate,
+		StatementTypeCreateMaterializedView, StatementTypeRefreshMaterializedView:
+		// 自动提交的写入
+		if err == nil {
+			err = s.catalog.makeDurable([]string{stat.TableName})
+		}
+	}
+	return n, err
+}
+
+// 事务中的写入先缓存在会话里，本会话的查询可以看到自己未提交的行
+func (s *Session) executeInTransaction(stat *Statement, handle RowHandler) (int, error) {
+	switch stat.Typ {
+	case StatementTypeInsert:
+		if err := s.catalog.checkTable(stat.TableName); err != nil {
+			return 0, err
+		}
+		s.tx.add(stat.TableName, stat.RowToInsert)
+		return 1, nil
+	case StatementTypeInsertSelect:
+		if err := s.catalog.checkTable(stat.TableName); err != nil {
+			return 0, err
+		}
+		var rows []Row
+		err := s.selectInTransaction(stat.Ctx, stat.SourceTable, func(row *Row) error {
+			rows = append(rows, *row)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range rows {
+			s.tx.add(stat.TableName, row)
+		}
+		return len(rows), nil
+	case StatementTypeSelect:
+		// 过去的时刻看不到本事务未提交的行
+		if !stat.AsOf.IsZero() {
+			return s.catalog.executeStatement(stat, handle)
+		}
+		return 0, s.selectInTransaction(stat.Ctx, stat.TableName, withContext(stat.Ctx, stat.Where.filter(handle)))
+	}
+	return 0, ErrNotAllowedInTx
+}
+
+// 只读事务中的查询读取快照，不需要等待其他事务的锁
+func (s *Session) executeReadOnly(stat *Statement, handle RowHandler) (int, error) {
+	if stat.Typ != StatementTypeSelect {
+		return 0, ErrReadOnlyTransaction
+	}
+	run := *stat
+	run.Snapshot = s.tx.snapshot
+	return s.catalog.executeStatement(&run, handle)
+}
+
+func (s *Session) selectInTransaction(ctx context.Context, table string, handle RowHandler) error {
+	stat := &Statement{Typ: StatementTypeSelect, TableName: table, Ctx: ctx, Temp: s.temp}
+	if _, err := s.catalog.executeStatement(stat, handle); err != nil {
+		return err
+	}
+	pending := s.tx.pending[qualifyTableName(table)]
+	for i := range pending {
+		if err := handle(&pending[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *Transaction) add(table string, row Row) {
+	table = qualifyTableName(table)
+	if _, ok := tx.pending[table]; !ok {
+		tx.order = append(tx.order, table)
+	}
+	tx.pending[table] = append(tx.pending[table], row)
+}
+
+func (c *Catalog) checkTable(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.resolveWritable(name)
+	return err
+}
+
+func (c *Catalog) commitTransaction(tx *Transaction) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tables := make([]*Table, len(tx.order))
+	saved := make([]uint32, len(tx.order))
+	for i, name := range tx.order {
+		t, err := c.resolveWritable(name)
+		if err != nil {
+			return 0, err
+		}
+		tables[i] = t
+		saved[i] = t.numRows
+	}
+
+	n := 0
+	for i, name := range tx.order {
+		for j := range tx.pending[name] {
+			if err := tables[i].insertRow(&tx.pending[name][j]); err != nil {
+				for k, t := range tables {
+					t.rewind(saved[k])
+				}
+				return 0, err
+			}
+			n++
+		}
+	}
+	for _, t := range tables {
+		t.recordHistory()
+	}
+	return n, nil
+}
+
+// execute语句返回对应的预处理语句，其他语句原样返回
+func (s *Session) resolve(stat *Statement) *Statement {
+	if stat.Typ == StatementTypeExecute {
+		if prepared, ok := s.prepared[stat.Name]; ok {
+			return prepared
+		}
+	}
+	return stat
+}
+
+// 需要写入审计日志的语句
+func (s *Session) isWrite(stat *Statement) bool {
+	switch s.resolve(stat).Typ {
+	case StatementTypeSelect, StatementTypeBegin, StatementTypeRollback,
+		StatementTypePrepare, StatementTypeDeallocate, StatementTypeExecute, StatementTypeExplain:
+		return false
+	}
+	return true
+}
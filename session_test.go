@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTransactionCommitAndRollback(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	if err := execTestErr(t, s, "commit"); !errors.Is(err, ErrNoTransaction) {
+		t.Errorf("commit without begin: got %v, want ErrNoTransaction", err)
+	}
+	execTest(t, s, "begin")
+	if err := execTestErr(t, s, "begin"); !errors.Is(err, ErrTransactionActive) {
+		t.Errorf("nested begin: got %v, want ErrTransactionActive", err)
+	}
+	execTest(t, s, "insert 1 alice alice@example.com")
+	// 事务中可以看到自己未提交的行
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("select in transaction returned %v, want [1]", got)
+	}
+	execTest(t, s, "rollback")
+	if got := execTest(t, s, "select"); len(got) != 0 {
+		t.Errorf("rolled back rows are visible: %v", got)
+	}
+
+	execTest(t, s, "begin transaction")
+	execTest(t, s, "insert 2 bob bob@example.com")
+	execTest(t, s, "insert into users select * from users")
+	if n := execTestCount(t, s, "commit"); n != 2 {
+		t.Errorf("commit wrote %d rows, want 2", n)
+	}
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{2, 2}) {
+		t.Errorf("committed rows %v, want [2 2]", got)
+	}
+}
+
+func TestCloseRollsBackTransaction(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	execTest(t, s, "begin")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	s.close()
+
+	other := NewSession(c, "", "test")
+	defer other.close()
+	// 关闭会话释放了锁，其他会话不必等待
+	if got := execTest(t, other, "select"); len(got) != 0 {
+		t.Errorf("rows of a closed session are visible: %v", got)
+	}
+	if n := len(c.transactions.list()); n != 0 {
+		t.Errorf("%d transactions still registered", n)
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+
+	execTest(t, s, "prepare add as insert 1 alice alice@example.com")
+	if err := execTestErr(t, s, "prepare add as select"); !errors.Is(err, ErrPreparedStatementExist) {
+		t.Errorf("duplicate prepare: got %v, want ErrPreparedStatementExist", err)
+	}
+	execTest(t, s, "prepare all as select")
+	execTest(t, s, "execute add")
+	execTest(t, s, "execute add")
+	if got := execTest(t, s, "execute all"); !slices.Equal(got, []uint32{1, 1}) {
+		t.Errorf("execute all returned %v, want [1 1]", got)
+	}
+	execTest(t, s, "deallocate add")
+	if err := execTestErr(t, s, "execute add"); !errors.Is(err, ErrUnknownPreparedStmt) {
+		t.Errorf("execute after deallocate: got %v, want ErrUnknownPreparedStmt", err)
+	}
+	if err := execTestErr(t, s, "prepare bad as truncate users"); !errors.Is(err, ErrPrepareSyntax) {
+		t.Errorf("prepare truncate: got %v, want a syntax error", err)
+	}
+
+	// 预处理语句属于会话
+	other := NewSession(c, "", "test")
+	defer other.close()
+	if err := execTestErr(t, other, "execute all"); !errors.Is(err, ErrUnknownPreparedStmt) {
+		t.Errorf("execute from another session: got %v, want ErrUnknownPreparedStmt", err)
+	}
+}
+
+func TestDeadlockRollsBackRequester(t *testing.T) {
+	c := openTestCatalog(t)
+	if err := c.attach(filepath.Join(t.TempDir(), "aux.db"), "aux"); err != nil {
+		t.Fatal(err)
+	}
+	a := NewSession(c, "", "a")
+	defer a.close()
+	b := NewSession(c, "", "b")
+	defer b.close()
+
+	execTest(t, a, "begin")
+	execTest(t, a, "insert 1 alice alice@example.com")
+	execTest(t, b, "begin")
+	execTest(t, b, "insert into aux.users 2 bob bob@example.com")
+
+	// a等待b持有的aux.users，b再请求a持有的users时形成环
+	done := make(chan error, 1)
+	go func() {
+		stat := &Statement{}
+		if err := stat.prepareStatement("insert into aux.users 3 carol carol@example.com"); err != nil {
+			done <- err
+			return
+		}
+		_, err := a.execute(stat, nil)
+		done <- err
+	}()
+	waitQueued(t, &c.locks, "aux.users", 1)
+	if err := execTestErr(t, b, "insert 4 dave dave@example.com"); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("closing the cycle: got %v, want ErrDeadlock", err)
+	}
+	if b.inTransaction() {
+		t.Error("deadlocked transaction was not rolled back")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("waiting transaction: %v", err)
+	}
+	execTest(t, a, "commit")
+	if got := execTest(t, b, "select * from aux.users"); !slices.Equal(got, []uint32{3}) {
+		t.Errorf("aux.users has ids %v, want [3]", got)
+	}
+}
+
+func TestReadOnlyTransactionSeesSnapshot(t *testing.T) {
+	c := openTestCatalog(t)
+	reader := NewSession(c, "", "reader")
+	defer reader.close()
+	writer := NewSession(c, "", "writer")
+	defer writer.close()
+
+	execTest(t, writer, "insert 1 alice alice@example.com")
+	execTest(t, reader, "begin read only")
+	execTest(t, writer, "insert 2 bob bob@example.com")
+	if got := execTest(t, reader, "select"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("snapshot returned %v, want [1]", got)
+	}
+	if err := execTestErr(t, reader, "insert 3 carol carol@example.com"); !errors.Is(err, ErrReadOnlyTransaction) {
+		t.Errorf("insert in a read-only transaction: got %v, want ErrReadOnlyTransaction", err)
+	}
+	// 快照中的表不能清空
+	if err := execTestErr(t, writer, "truncate users"); !errors.Is(err, ErrInUseBySnapshot) {
+		t.Errorf("truncate during a snapshot: got %v, want ErrInUseBySnapshot", err)
+	}
+	execTest(t, reader, "commit")
+	if got := execTest(t, reader, "select"); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("select after the snapshot returned %v, want [1 2]", got)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 可以重复指定的命令行参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// Shell 是交互模式的会话，-init脚本、-cmd命令和终端输入都逐行交给它处理
+type Shell struct {
+	catalog *Catalog
+	session *Session
+	editor  *LineEditor
+	opts    ShellOptions
+	// 尚未以分号结束的多行语句
+	pending []string
+	// 不是在终端上交互使用时，默认遇到第一个错误就退出
+	batch           bool
+	continueOnError bool
+	failures        int
+	once            sync.Once
+	code            int
+	// 取消正在执行的语句，没有语句在执行时为nil
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// golitedb [-config FILE] [-init FILE] [-cmd COMMAND]... [-continue-on-error] [FILENAME [SQL]...]
+// 指定了SQL时执行完后退出，否则进入交互模式。
+// 输入不是终端或指定了SQL时以批处理方式运行，出错时退出码不为0
+func runShell(args []string) int {
+	fs := flag.NewFlagSet("golitedb", flag.ContinueOnError)
+	initFile := fs.String("init", "", "read and execute commands from this file before anything else")
+	var commands stringList
+	fs.Var(&commands, "cmd", "run this command before reading input, may be repeated")
+	continueOnError := fs.Bool("continue-on-error", false, "in batch mode keep going after a failed statement instead of exiting")
+	configFile := fs.String("config", "", "read settings from this file instead of ~/"+CONFIG_FILE_NAME)
+	// 选项可以出现在文件名之后
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			return 1
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	filename := ""
+	if len(positional) > 0 {
+		filename = positional[0]
+	}
+
+	// 交互模式下只输出警告和错误，避免干扰查询结果
+	logger, _ := newLogger(os.Stderr, "warn", LOG_FORMAT_TEXT)
+	slog.SetDefault(logger)
+
+	c, err := NewCatalog(filename)
+	if err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		return 1
+	}
+	sh := &Shell{
+		catalog: c,
+		session: NewSession(c, "", "local"),
+		editor:  NewLineEditor(os.Stdin, os.Stdout),
+		opts:    ShellOptions{output: OutputOptions{mode: OUTPUT_MODE_LIST}},
+
+		continueOnError: *continueOnError,
+	}
+	sh.batch = !sh.editor.terminal || len(positional) > 1
+	sh.editor.completer = c.complete
+	// 在终端上使用时默认以表格输出
+	if sh.editor.terminal {
+		sh.opts.output.mode = OUTPUT_MODE_TABLE
+	}
+	if err := sh.loadConfig(*configFile); err != nil {
+		fmt.Printf("Error: %v.\n", err)
+		sh.close()
+		return 1
+	}
+
+	// 执行语句时Ctrl-C只取消这条语句；其他时候收到中断信号时回滚事务并把数据写回文件
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt && sh.interrupt() {
+				continue
+			}
+			fmt.Println()
+			os.Exit(max(sh.close(), 1))
+		}
+	}()
+
+	if *initFile != "" {
+		exit, err := sh.runFile(*initFile)
+		if err != nil {
+			fmt.Printf("Error: %v.\n", err)
+		}
+		if err != nil {
+			sh.failures++
+		}
+		if exit || sh.stop() {
+			return sh.exit()
+		}
+	}
+	for _, command := range commands {
+		if sh.feed(command) || sh.flush() {
+			return sh.exit()
+		}
+	}
+	if len(positional) > 1 {
+		for _, input := range positional[1:] {
+			if sh.feed(input) || sh.flush() {
+				break
+			}
+		}
+		return sh.exit()
+	}
+	return sh.repl()
+}
+
+func (sh *Shell) repl() int {
+	for {
+		prompt := "db > "
+		if len(sh.pending) > 0 {
+			prompt = "...> "
+		}
+		line, err := sh.editor.readLine(prompt)
+		if errors.Is(err, ErrInterrupted) {
+			sh.pending = nil
+			continue
+		}
+		if err != nil {
+			sh.flush()
+			return sh.exit()
+		}
+		if sh.feed(line) {
+			return sh.exit()
+		}
+	}
+}
+
+// 批处理方式下出错后停止执行
+func (sh *Shell) stop() bool {
+	return sh.batch && !sh.continueOnError && sh.failures > 0
+}
+
+// 关闭数据库后的退出码，批处理方式下有语句失败时为1
+func (sh *Shell) exit() int {
+	code := sh.close()
+	if sh.batch && sh.failures > 0 {
+		code = 1
+	}
+	return code
+}
+
+// 逐行执行文件中的命令，遇到.exit时返回true
+func (sh *Shell) runFile(filename string) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if sh.feed(line) {
+			return true, nil
+		}
+	}
+	return sh.flush(), nil
+}
+
+// 处理一行输入，语句以分号结束或能完整解析时执行。
+// 遇到.exit或批处理方式下出错时返回true
+func (sh *Shell) feed(line string) bool {
+	line = strings.TrimSpace(line)
+
+	if len(sh.pending) == 0 && strings.HasPrefix(line, ".") {
+		switch doMetaCommand(line, sh.catalog, &sh.opts) {
+		case META_COMMAND_SUCCESS:
+			return false
+		case META_COMMAND_UNRECOGNIZED:
+			fmt.Printf("Unrecognized command '%s'.\n", line)
+			sh.failures++
+			return sh.stop()
+		case META_COMMAND_FAILED:
+			sh.failures++
+			return sh.stop()
+		case META_COMMAND_EXIT:
+			return true
+		}
+	}
+	if line == "" && len(sh.pending) > 0 {
+		return false
+	}
+
+	sh.pending = append(sh.pending, line)
+	input, closed := stripComments(strings.Join(sh.pending, "\n"))
+	statements := splitStatements(input)
+	// 最后一条语句没有分号时需要能完整解析
+	if !closed || !statementComplete(statements[len(statements)-1]) {
+		return false
+	}
+	sh.pending = nil
+	return sh.runStatements(statements)
+}
+
+// 输入结束时执行剩下的不完整语句，输出其中的错误
+func (sh *Shell) flush() bool {
+	if len(sh.pending) == 0 {
+		return false
+	}
+	input, _ := stripComments(strings.Join(sh.pending, "\n"))
+	sh.pending = nil
+	return sh.runStatements(splitStatements(input))
+}
+
+func (sh *Shell) runStatements(statements []string) bool {
+	for _, input := range statements {
+		if input == "" {
+			continue
+		}
+		if err := sh.runStatement(input); err != nil {
+			sh.failures++
+			if sh.stop() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (sh *Shell) setCancel(cancel context.CancelFunc) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.cancel = cancel
+}
+
+// 取消正在执行的语句，没有语句在执行时返回false
+func (sh *Shell) interrupt() bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.cancel == nil {
+		return false
+	}
+	sh.cancel()
+	return true
+}
+
+// 恢复终端、回滚事务并关闭数据库，只执行一次，返回退出码
+func (sh *Shell) close() int {
+	sh.once.Do(func() {
+		sh.editor.close()
+		sh.session.close()
+		if err := sh.opts.closeOutput(); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			sh.code = 1
+		}
+		if err := sh.catalog.close(); err != nil {
+			fmt.Printf("Error: %v.\n", err)
+			sh.code = 1
+		}
+	})
+	return sh.code
+}
+
+// 执行一条语句并输出结果，返回已经输出的错误
+func (sh *Shell) runStatement(input string) error {
+	session, editor, opts := sh.session, sh.editor, &sh.opts
+	stat := &Statement{}
+	if err := stat.prepareStatement(input); err != nil {
+		if errors.Is(err, ErrPrepareUnRecognized) {
+			fmt.Printf("Unrecognized keyword at start of '%s'.\n", input)
+		} else {
+			fmt.Printf("Error: %v.\n", err)
+		}
+		return err
+	}
+
+	w := opts.writer()
+	// 在终端上查询结果超过一屏时分页显示
+	if opts.outFile == nil && editor.terminal && isTerminal(os.Stdout.Fd()) {
+		if height := terminalHeight(os.Stdout.Fd()); height > 1 {
+			w = newMoreWriter(w, editor, height)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stat.Ctx = ctx
+	sh.setCancel(cancel)
+	defer sh.setCancel(nil)
+
+	returned := 0
+	query := session.resolve(stat)
+	out := newResultWriter(w, opts.output, query.columnNames())
+	start := time.Now()
+	affected, err := session.execute(stat, func(row *Row) error {
+		returned++
+		return out.writeRow(query.project(row))
+	})
+	elapsed := time.Since(start)
+	if errors.Is(err, ErrOutputAborted) {
+		// 放弃剩余结果时停止扫描，不再输出结尾
+		err = nil
+	} else if session.resolve(stat).Typ == StatementTypeSelect {
+		if finishErr := out.finish(); err == nil {
+			err = finishErr
+		}
+	}
+	if err == nil && stat.Result != "" {
+		fmt.Println(stat.Result)
+	}
+	switch {
+	case err == nil && session.resolve(stat).Typ.changesRows():
+		fmt.Printf("%s.\n", rowsAffected(affected))
+	case err == nil:
+		fmt.Println("Executed.")
+	default:
+		fmt.Printf("Error: %v.\n", err)
+	}
+	if opts.timer {
+		if session.resolve(stat).Typ == StatementTypeSelect {
+			fmt.Printf("Run Time: %.6fs, %d rows returned\n", elapsed.Seconds(), returned)
+		} else {
+			fmt.Printf("Run Time: %.6fs, %d rows affected\n", elapsed.Seconds(), affected)
+		}
+	}
+	return err
+}
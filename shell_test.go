@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// 以批处理方式运行shell，返回之后数据库中的行id
+func shellTest(t *testing.T, args ...string) (int, []uint32) {
+	t.Helper()
+	// 不读取用户的配置文件和历史记录
+	t.Setenv("HOME", t.TempDir())
+	filename := filepath.Join(t.TempDir(), "test.db")
+	code := runShell(append([]string{filename}, args...))
+
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	s := NewSession(c, "", "test")
+	defer s.close()
+	return code, execTest(t, s, "select * from users")
+}
+
+func TestShellBatchStopsAtFirstError(t *testing.T) {
+	code, ids := shellTest(t, "insert 1 alice alice@example.com", "bogus", "insert 2 bob bob@example.com")
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if !slices.Equal(ids, []uint32{1}) {
+		t.Errorf("rows %v, want [1]", ids)
+	}
+}
+
+func TestShellContinueOnError(t *testing.T) {
+	code, ids := shellTest(t, "-continue-on-error", "insert 1 alice alice@example.com", "bogus", "insert 2 bob bob@example.com;")
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if !slices.Equal(ids, []uint32{1, 2}) {
+		t.Errorf("rows %v, want [1 2]", ids)
+	}
+}
+
+func TestShellInitAndCommands(t *testing.T) {
+	init := filepath.Join(t.TempDir(), "init.sql")
+	// 多行语句以分号结束
+	writeTestFile(t, init, "insert 1 alice\n  alice@example.com;\n")
+	code, ids := shellTest(t, "-init", init, "-cmd", "insert 2 bob bob@example.com", "insert 3 carol carol@example.com")
+	if code != 0 {
+		t.Errorf("exit code %d, want 0", code)
+	}
+	if !slices.Equal(ids, []uint32{1, 2, 3}) {
+		t.Errorf("rows %v, want [1 2 3]", ids)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SlowQueryLog 以JSON行的形式记录执行时间超过阈值的语句
+type SlowQueryLog struct {
+	mu        sync.Mutex
+	file      *os.File
+	threshold time.Duration
+}
+
+type slowQueryEntry struct {
+	Time       string  `json:"time"`
+	User       string  `json:"user,omitempty"`
+	Client     string  `json:"client"`
+	Statement  string  `json:"statement"`
+	Plan       string  `json:"plan"`
+	DurationMS float64 `json:"duration_ms"`
+	Rows       int     `json:"rows"`
+	Error      string  `json:"error,omitempty"`
+}
+
+func openSlowQueryLog(filename string, threshold time.Duration) (*SlowQueryLog, error) {
+	if threshold < 0 {
+		return nil, fmt.Errorf("slow query threshold must not be negative")
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &SlowQueryLog{file: file, threshold: threshold}, nil
+}
+
+// 执行时间未超过阈值时不记录
+func (l *SlowQueryLog) record(user, client string, stat *Statement, plan string, elapsed time.Duration, rows int, execErr error) error {
+	if elapsed < l.threshold {
+		return nil
+	}
+	entry := slowQueryEntry{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		User:       user,
+		Client:     client,
+		Statement:  redactStatement(stat),
+		Plan:       plan,
+		DurationMS: float64(elapsed) / float64(time.Millisecond),
+		Rows:       rows,
+	}
+	if execErr != nil {
+		entry.Error = execErr.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *SlowQueryLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// 除全文搜索外查询总是全表扫描，插入总是追加到表尾
+func describePlan(stat *Statement) string {
+	switch stat.Typ {
+	case StatementTypeSelect:
+		if stat.Where != nil && stat.Where.Match && !stat.NotIndexed {
+			return fmt.Sprintf("fulltext index %s(%s), filter %s",
+				qualifyTableName(stat.TableName), stat.Where.Column, stat.Where)
+		}
+		if stat.Where != nil {
+			return fmt.Sprintf("full scan %s, filter %s", qualifyTableName(stat.TableName), stat.Where)
+		}
+		return "full scan " + qualifyTableName(stat.TableName)
+	case StatementTypeInsert:
+		return "append " + qualifyTableName(stat.TableName)
+	case StatementTypeInsertSelect:
+		return fmt.Sprintf("full scan %s, append %s",
+			qualifyTableName(stat.SourceTable), qualifyTableName(stat.TableName))
+	case StatementTypeCommit:
+		return "append pending rows"
+	case StatementTypeCommitPrepared:
+		return "append prepared rows"
+	case StatementTypeCreateFulltextIndex:
+		return "full scan " + qualifyTableName(stat.TableName)
+	case StatementTypeTruncate:
+		return "truncate " + qualifyTableName(stat.TableName)
+	case StatementTypeCreateMaterializedView:
+		return fmt.Sprintf("%s, append %s", describePlan(stat.Prepared), qualifyTableName(stat.TableName))
+	case StatementTypeRefreshMaterializedView:
+		return fmt.Sprintf("truncate %s, rerun its query", qualifyTableName(stat.TableName))
+	}
+	return "none"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryLogRecordsPlans(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "slow.log")
+	s := newTestServer(t)
+	var err error
+	if s.slowLog, err = openSlowQueryLog(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ path, sql string }{
+		{"/exec", "insert 1 alice alice@example.com"},
+		{"/exec", "insert 2 bob bob@example.com"},
+		{"/query", "select * from users where id = 2"},
+	} {
+		if code, body := httpTest(s, tc.path, tc.sql); code != http.StatusOK {
+			t.Fatalf("%s: status %d %s", tc.sql, code, body)
+		}
+	}
+	if err := s.slowLog.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []slowQueryEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e slowQueryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("%d entries, want 3", len(entries))
+	}
+	if e := entries[0]; e.Plan != "append main.users" || e.Rows != 1 {
+		t.Errorf("insert entry %+v", e)
+	}
+	// 查询记录返回的行数
+	if e := entries[2]; e.Plan != "full scan main.users, filter id = '2'" || e.Rows != 1 || e.Statement != "select * from users where id = 2" {
+		t.Errorf("select entry %+v", e)
+	}
+}
+
+func TestSlowQueryLogThreshold(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "slow.log")
+	if _, err := openSlowQueryLog(filename, -time.Second); err == nil {
+		t.Error("a negative threshold was accepted")
+	}
+	l, err := openSlowQueryLog(filename, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := &Statement{}
+	if err := stat.prepareStatement("select * from users"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.record("", "test", stat, describePlan(stat), time.Second, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Size() != 0 {
+		t.Errorf("a fast statement was logged: %v", err)
+	}
+}
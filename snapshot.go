@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInUseBySnapshot = fmt.Errorf("in use by an open snapshot")
+
+// Snapshot 冻结创建时已提交的所有表和main数据库的键值表，
+// 在Release之前通过它读取的内容不受之后的写入影响。
+// 表只在末尾追加行，快照只需记住当时的行数；键值表在修改一个键之前
+// 把它原来的值交给打开的快照保存，因此快照的开销与之后修改的键数成正比。
+// 快照打开期间不能清空或分离它冻结的表，也不能删除它冻结的桶
+type Snapshot struct {
+	catalog  *Catalog
+	rows     map[*Table]uint32
+	kv       map[*KVTable]*kvSnapshot
+	released bool
+}
+
+// 快照开始后第一次修改一个键之前它的值，ok为false表示当时键不存在
+type kvSaved struct {
+	value []byte
+	ok    bool
+}
+
+type kvSnapshot struct {
+	saved map[string]kvSaved
+}
+
+// Snapshot 创建一个快照，使用完后必须调用Release
+func (c *Catalog) Snapshot() (*Snapshot, error) {
+	// 先打开所有的桶，快照创建后才出现的桶在快照中是空的
+	names, err := c.buckets()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range append([]string{""}, names...) {
+		if _, err := c.bucket(name); err != nil {
+			return nil, err
+		}
+	}
+
+	// 持有目录锁时没有正在执行的写语句，锁住所有键值表后两边在同一时刻冻结
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snap := &Snapshot{
+		catalog: c,
+		rows:    make(map[*Table]uint32),
+		kv:      make(map[*KVTable]*kvSnapshot),
+	}
+	for _, db := range c.databases {
+		for _, t := range db.snapshotTables() {
+			snap.rows[t] = t.numRows
+			t.snapshots++
+		}
+	}
+	for suffix, kv := range c.databases[MAIN_DATABASE].sidecars {
+		if suffix != KV_FILE_SUFFIX && !strings.HasPrefix(suffix, KV_BUCKET_SUFFIX) {
+			continue
+		}
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		snap.kv[kv] = kv.openSnapshot()
+	}
+	return snap, nil
+}
+
+// 数据库中的用户表和物化视图
+func (db *Database) snapshotTables() []*Table {
+	tables := []*Table{db.table}
+	for _, view := range db.views {
+		tables = append(tables, view.table)
+	}
+	return tables
+}
+
+// 是否有打开的快照冻结了数据库中的表
+func (db *Database) inSnapshot() bool {
+	return slices.ContainsFunc(db.snapshotTables(), func(t *Table) bool { return t.snapshots > 0 })
+}
+
+// Release 释放快照，重复调用没有影响
+func (snap *Snapshot) Release() {
+	c := snap.catalog
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if snap.released {
+		return
+	}
+	snap.released = true
+	for t := range snap.rows {
+		t.snapshots--
+	}
+	for kv, s := range snap.kv {
+		kv.releaseSnapshot(s)
+	}
+}
+
+// 表在快照中的行数，快照创建后才出现的表是空的
+func (snap *Snapshot) numRows(t *Table) uint32 {
+	return snap.rows[t]
+}
+
+// Get 读取快照创建时键的值
+func (snap *Snapshot) Get(kv *KVTable, key []byte) ([]byte, bool, error) {
+	s, ok := snap.kv[kv]
+	if !ok {
+		return nil, false, nil
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if saved, ok := s.saved[string(key)]; ok {
+		return bytes.Clone(saved.value), saved.ok, nil
+	}
+	return kv.get(key)
+}
+
+// Range 与KVTable.Range相同，但读取的是快照创建时的键和值
+func (snap *Snapshot) Range(kv *KVTable, start, end []byte, handle func(key, value []byte) error) error {
+	s, ok := snap.kv[kv]
+	if !ok {
+		return nil
+	}
+	inRange := func(key string) bool {
+		return key >= string(start) && (end == nil || key < string(end))
+	}
+	kv.mu.Lock()
+	var keys []string
+	for key := range kv.index {
+		if _, ok := s.saved[key]; !ok && inRange(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key, saved := range s.saved {
+		if saved.ok && inRange(key) {
+			keys = append(keys, key)
+		}
+	}
+	kv.mu.Unlock()
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value, ok, err := snap.Get(kv, []byte(key))
+		if err != nil {
+			return err
+		}
+		// 快照中的键不会消失
+		if !ok {
+			continue
+		}
+		if err := handle([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kv *KVTable) inSnapshot() bool {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return len(kv.snapshots) > 0
+}
+
+// 调用方持有锁
+func (kv *KVTable) openSnapshot() *kvSnapshot {
+	s := &kvSnapshot{saved: make(map[string]kvSaved)}
+	kv.snapshots = append(kv.snapshots, s)
+	return s
+}
+
+func (kv *KVTable) releaseSnapshot(s *kvSnapshot) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.snapshots = slices.DeleteFunc(kv.snapshots, func(x *kvSnapshot) bool { return x == s })
+}
+
+// 修改一个键之前，为还没有保存它的快照保存当前的值，调用方持有锁
+func (kv *KVTable) preserve(key []byte) error {
+	if len(kv.snapshots) == 0 {
+		return nil
+	}
+	var saved kvSaved
+	loaded := false
+	for _, s := range kv.snapshots {
+		if _, ok := s.saved[string(key)]; ok {
+			continue
+		}
+		if !loaded {
+			value, ok, err := kv.get(key)
+			if err != nil {
+				return err
+			}
+			saved, loaded = kvSaved{value, ok}, true
+		}
+		s.saved[string(key)] = saved
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// 临时表只属于创建它的会话，行保存在内存中，会话结束时删除。
+// 临时表的列与users表相同，用 temp.NAME 或不带数据库名的 NAME 引用，同名时临时表优先。
+// 其他会话看不到临时表，因此临时表不加锁；写入临时表立即生效，不属于事务，
+// 所以事务中不能创建或写入临时表，只能读取
+const TEMP_DATABASE = "temp"
+
+// create temp[orary] table NAME [as SELECT]
+func (stat *Statement) prepareCreateTempTable(input string, parts []Token) error {
+	if len(parts) < 3 || !parts[2].is("table") {
+		return stat.syntaxError(parts, 2, "")
+	}
+	if len(parts) < 4 {
+		return stat.syntaxError(parts, 3, "")
+	}
+	name := strings.ToLower(parts[3].Text)
+	if qualified, ok := strings.CutPrefix(name, TEMP_DATABASE+"."); ok {
+		name = qualified
+	}
+	if strings.Contains(name, ".") || checkViewName(name) != "" {
+		return stat.syntaxError(parts, 3, "invalid table name")
+	}
+	stat.Typ = StatementTypeCreateTempTable
+	stat.Name = name
+	if len(parts) == 4 {
+		return nil
+	}
+	if !parts[4].is("as") {
+		return stat.syntaxError(parts, 4, "")
+	}
+	if len(parts) < 6 {
+		return stat.syntaxError(parts, 5, "")
+	}
+	query := &Statement{}
+	if err := query.prepareStatement(input[parts[5].Pos:]); err != nil {
+		// 错误位置相对于整条语句
+		var e *Error
+		if errors.As(err, &e) && e.Pos > 0 {
+			e.Pos += utf8.RuneCountInString(input[:parts[5].Pos])
+		}
+		return err
+	}
+	if query.Typ != StatementTypeSelect {
+		return stat.syntaxError(parts, 5, "a temporary table must be filled by a select")
+	}
+	if query.Columns != nil {
+		return stat.syntaxError(parts, 6, "a temporary table must select all columns")
+	}
+	stat.Prepared = query
+	return nil
+}
+
+// 创建临时表，有查询时用查询结果填充，返回填充的行数
+func (s *Session) createTempTable(stat *Statement) (int, error) {
+	if s.tx != nil {
+		return 0, ErrNotAllowedInTx
+	}
+	if _, ok := s.temp[stat.Name]; ok {
+		return 0, fmt.Errorf("%w: %s.%s", ErrTableExists, TEMP_DATABASE, stat.Name)
+	}
+	t, err := dbOpen("")
+	if err != nil {
+		return 0, err
+	}
+	if err := s.catalog.addTempTable(t); err != nil {
+		t.close()
+		return 0, err
+	}
+	if stat.Prepared != nil {
+		// 查询结果先全部读出，查询的表可以是另一张临时表
+		var rows []Row
+		_, err := s.run(stat.Prepared, func(row *Row) error {
+			rows = append(rows, *row)
+			return nil
+		})
+		for i := 0; err == nil && i < len(rows); i++ {
+			err = t.insertRow(&rows[i])
+		}
+		if err != nil {
+			s.catalog.removeTempTable(t)
+			t.close()
+			return 0, err
+		}
+	}
+	if s.temp == nil {
+		s.temp = make(map[string]*Table)
+	}
+	s.temp[stat.Name] = t
+	return int(t.numRows), nil
+}
+
+// 登记临时表并应用当前的pragma。临时表在内存中，页缓存和同步设置对它没有意义
+func (c *Catalog) addTempTable(t *Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.applyTempPragmas(t); err != nil {
+		return err
+	}
+	if c.temp == nil {
+		c.temp = make(map[*Table]bool)
+	}
+	c.temp[t] = true
+	return nil
+}
+
+func (c *Catalog) removeTempTable(t *Table) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.temp, t)
+}
+
+func (c *Catalog) applyTempPragmas(t *Table) error {
+	t.checkEmail = c.pragmas.checkEmail
+	t.setHistoryRetention(c.pragmas.historyRetention)
+	return t.setBloomFilter(c.pragmas.bloomFilter)
+}
+
+// 把语句中引用临时表的表名改为 temp.NAME，并带上会话的临时表
+func (s *Session) qualifyTemp(stat *Statement) *Statement {
+	if len(s.temp) == 0 {
+		return stat
+	}
+	run := *stat
+	run.Temp = s.temp
+	switch stat.Typ {
+	case StatementTypeSelect, StatementTypeInsert, StatementTypeInsertSelect, StatementTypeTruncate:
+		run.TableName = s.tempName(stat.TableName)
+		run.SourceTable = s.tempName(stat.SourceTable)
+	}
+	if stat.Prepared != nil {
+		run.Prepared = s.qualifyTemp(stat.Prepared)
+	}
+	return &run
+}
+
+func (s *Session) tempName(name string) string {
+	if _, ok := s.temp[strings.ToLower(name)]; ok {
+		return TEMP_DATABASE + "." + strings.ToLower(name)
+	}
+	return name
+}
+
+func isTempTable(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), TEMP_DATABASE+".")
+}
+
+// 解析语句中的表名：temp.NAME 是会话的临时表，其他表由resolve解析
+func (stat *Statement) table(name string, resolve func(string) (*Table, error)) (*Table, error) {
+	if !isTempTable(name) {
+		return resolve(name)
+	}
+	if t, ok := stat.Temp[strings.ToLower(name[len(TEMP_DATABASE)+1:])]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownTable, name)
+}
+
+// 会话结束时删除临时表
+func (s *Session) dropTempTables() {
+	for name, t := range s.temp {
+		s.catalog.removeTempTable(t)
+		t.close()
+		delete(s.temp, name)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTempTableWritesRejectedInTransaction(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "create temp table staging")
+	execTest(t, s, "insert into staging 1 alice alice@example.com")
+
+	execTest(t, s, "begin")
+	if err := execTestErr(t, s, "insert into staging 2 bob bob@example.com"); !errors.Is(err, ErrNotAllowedInTx) {
+		t.Errorf("temp insert in a transaction: %v, want %v", err, ErrNotAllowedInTx)
+	}
+	if err := execTestErr(t, s, "create temp table other"); !errors.Is(err, ErrNotAllowedInTx) {
+		t.Errorf("create temp table in a transaction: %v, want %v", err, ErrNotAllowedInTx)
+	}
+	// 读取临时表和把它复制到普通表都可以放在事务中
+	execTest(t, s, "insert into users select * from staging")
+	execTest(t, s, "rollback")
+
+	if got := execTest(t, s, "select * from staging"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("temp rows after rollback = %v, want [1]", got)
+	}
+	if got := execTest(t, s, "select * from users"); len(got) != 0 {
+		t.Errorf("rolled back copy left rows %v", got)
+	}
+}
+
+func TestTempTableDroppedWithSession(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	execTest(t, s, "create temp table staging")
+	if err := execTestErr(t, s, "create temp table staging"); !errors.Is(err, ErrTableExists) {
+		t.Errorf("duplicate temp table: %v, want %v", err, ErrTableExists)
+	}
+	if status := httpStatus(ErrTableExists); status != http.StatusConflict {
+		t.Errorf("HTTP status for an existing table %d, want %d", status, http.StatusConflict)
+	}
+	s.close()
+
+	other := NewSession(c, "", "test")
+	defer other.close()
+	execTest(t, other, "create temp table staging")
+	if len(c.temp) != 1 {
+		t.Errorf("catalog tracks %d temp tables, want 1", len(c.temp))
+	}
+}
+
+func TestExplainTempTable(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "create temp table staging")
+	execTest(t, s, "insert into staging 1 alice alice@example.com")
+
+	stat := &Statement{}
+	if err := stat.prepareStatement("explain select * from staging"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.execute(stat, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Seq Scan temp.staging (estimated rows 1)"; stat.Result != want {
+		t.Errorf("plan %q, want %q", stat.Result, want)
+	}
+}
+
+func TestTempTableVisibleOnlyToItsSession(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	other := NewSession(c, "", "other")
+	defer other.close()
+
+	execTest(t, s, "create temp table staging")
+	execTest(t, s, "insert into staging 1 alice alice@example.com")
+	if err := execTestErr(t, other, "select * from staging"); !errors.Is(err, ErrUnknownTable) {
+		t.Errorf("other session reading the temp table: %v, want %v", err, ErrUnknownTable)
+	}
+
+	// 另一个会话可以建立同名的临时表，两者互不影响
+	execTest(t, other, "create temp table staging")
+	execTest(t, other, "insert into staging 2 bob bob@example.com")
+	if got := execTest(t, s, "select * from staging"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("first session's temp rows %v, want [1]", got)
+	}
+	if got := execTest(t, other, "select * from staging"); !slices.Equal(got, []uint32{2}) {
+		t.Errorf("second session's temp rows %v, want [2]", got)
+	}
+}
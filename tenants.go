@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// serve --data-dir DIR 时每个数据库是目录中的一个 NAME.db 文件，
+// 各自有独立的目录、页缓存、锁和用户，连接通过 use NAME、postgres启动参数database、
+// HTTP的database参数或X-Database请求头以及RESP的 SELECT NAME 选择。没有选择时使用 DEFAULT_TENANT
+const (
+	DEFAULT_TENANT  = "main"
+	TENANT_FILE_EXT = ".db"
+)
+
+var ErrUnknownTenant = fmt.Errorf("no such database")
+
+// Tenants 按需打开数据目录中的数据库，打开后一直保持到服务关闭
+type Tenants struct {
+	dir      string
+	mu       sync.Mutex
+	catalogs map[string]*Catalog
+}
+
+func newTenants(dir string) (*Tenants, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &Tenants{dir: dir, catalogs: map[string]*Catalog{}}, nil
+}
+
+// 数据库名只能包含字母、数字和下划线，不区分大小写
+func checkTenantName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: %q", ErrUnknownTenant, name)
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return fmt.Errorf("%w: %q", ErrUnknownTenant, name)
+		}
+	}
+	return nil
+}
+
+// 打开数据库，create为false时文件必须已经存在，避免拼错的名字创建出新数据库
+func (ts *Tenants) open(name string, create bool) (*Catalog, error) {
+	if err := checkTenantName(name); err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if c, ok := ts.catalogs[name]; ok {
+		return c, nil
+	}
+	filename := filepath.Join(ts.dir, name+TENANT_FILE_EXT)
+	if !create {
+		if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, name)
+		} else if err != nil {
+			return nil, ioError(err)
+		}
+	}
+	c, err := NewCatalog(filename)
+	if err != nil {
+		return nil, err
+	}
+	ts.catalogs[name] = c
+	return c, nil
+}
+
+func (ts *Tenants) close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var errs []error
+	for _, c := range ts.catalogs {
+		errs = append(errs, c.close())
+	}
+	return errors.Join(errs...)
+}
+
+// 连接选择的数据库，没有 --data-dir 时只能使用默认的数据库
+func (s *Server) tenant(name string) (*Catalog, error) {
+	if s.tenants == nil && name == DEFAULT_TENANT {
+		return s.catalog, nil
+	}
+	if s.tenants == nil {
+		return nil, fmt.Errorf("selecting a database requires serve --data-dir")
+	}
+	return s.tenants.open(name, false)
+}
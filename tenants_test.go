@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTenantNames(t *testing.T) {
+	for _, name := range []string{"main", "Tenant_2", "a1"} {
+		if err := checkTenantName(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../main", "a.b", "a b", "名字"} {
+		if err := checkTenantName(name); !errors.Is(err, ErrUnknownTenant) {
+			t.Errorf("%q: got %v, want ErrUnknownTenant", name, err)
+		}
+	}
+}
+
+func TestTenantsAreIsolated(t *testing.T) {
+	dir := t.TempDir()
+	ts, err := newTenants(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.close()
+
+	if _, err := ts.open("acme", false); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("opening a missing database: got %v, want ErrUnknownTenant", err)
+	}
+	acme, err := ts.open("acme", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "acme"+TENANT_FILE_EXT)); err != nil {
+		t.Errorf("database file was not created: %v", err)
+	}
+	// 名字不区分大小写，同一个数据库只打开一次
+	if again, err := ts.open("ACME", false); err != nil || again != acme {
+		t.Errorf("reopening ACME: %v, same catalog %v", err, again == acme)
+	}
+	other, err := ts.open("other", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSession(acme, "", "test")
+	defer s.close()
+	execTest(t, s, "insert 1 alice alice@example.com")
+	o := NewSession(other, "", "test")
+	defer o.close()
+	if got := execTest(t, o, "select * from users"); len(got) != 0 {
+		t.Errorf("other database sees rows %v", got)
+	}
+	if got := execTest(t, s, "select * from users"); len(got) != 1 {
+		t.Errorf("acme has rows %v, want one", got)
+	}
+}
+
+func TestHTTPSelectsTenant(t *testing.T) {
+	ts, err := newTenants(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.close()
+	if _, err := ts.open("acme", true); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.tenants = ts
+
+	request := func(target, header string) (int, string) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader("insert 1 alice alice@example.com"))
+		if header != "" {
+			r.Header.Set(HTTP_DATABASE_HEADER, header)
+		}
+		s.httpHandler().ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+	if code, body := request("/exec?database=acme", ""); code != http.StatusOK {
+		t.Fatalf("database parameter: status %d %s", code, body)
+	}
+	if code, body := request("/exec", "acme"); code != http.StatusOK {
+		t.Fatalf("database header: status %d %s", code, body)
+	}
+	if code, _ := request("/exec?database=missing", ""); code != http.StatusNotFound {
+		t.Errorf("unknown database: status %d, want %d", code, http.StatusNotFound)
+	}
+
+	acme, _ := ts.open("acme", false)
+	session := NewSession(acme, "", "test")
+	defer session.close()
+	if got := execTest(t, session, "select * from users"); len(got) != 2 {
+		t.Errorf("acme has rows %v, want two", got)
+	}
+	if code, body := httpTest(s, "/query", "select * from users"); code != http.StatusOK || strings.Contains(body, "alice") {
+		t.Errorf("default database: status %d %s, want no rows", code, body)
+	}
+}
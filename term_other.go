@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "fmt"
+
+// 其他平台不支持行编辑，退回到逐行读取
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, fmt.Errorf("raw terminal mode is not supported on this platform")
+}
+
+func terminalHeight(fd uintptr) int {
+	return 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 去掉 -- 行注释和 /* */ 块注释，注释替换为空格，字符串中的内容不是注释。
+// 块注释没有结束时第二个返回值为false
+func stripComments(input string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(input); {
+		switch {
+		case input[i] == '\'':
+			_, end, _ := scanQuoted(input, i)
+			b.WriteString(input[i:end])
+			i = end
+		case strings.HasPrefix(input[i:], "--"):
+			end := strings.IndexByte(input[i:], '\n')
+			if end < 0 {
+				return b.String(), true
+			}
+			b.WriteByte(' ')
+			i += end
+		case strings.HasPrefix(input[i:], "/*"):
+			end := strings.Index(input[i+2:], "*/")
+			if end < 0 {
+				return b.String(), false
+			}
+			b.WriteByte(' ')
+			i += end + 4
+		default:
+			b.WriteByte(input[i])
+			i++
+		}
+	}
+	return b.String(), true
+}
+
+// 按分号拆分多条语句，去掉首尾空白，字符串中的分号不拆分。
+// 以分号结尾时最后一项为空字符串
+func splitStatements(input string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case '\'':
+			_, end, _ := scanQuoted(input, i)
+			i = end - 1
+		case ';':
+			statements = append(statements, strings.TrimSpace(input[start:i]))
+			start = i + 1
+		}
+	}
+	return append(statements, strings.TrimSpace(input[start:]))
+}
+
+var ErrUnterminatedString = fmt.Errorf("unterminated quoted string")
+
+// Token 是语句中的一个单词或单引号字符串。
+// 引号字符串中连续两个单引号表示一个单引号，Text中保存的是去掉引号和转义后的值
+type Token struct {
+	Text   string
+	Quoted bool
+	// 在输入中的起止字节偏移
+	Pos int
+	End int
+}
+
+// 关键字只能是不带引号的单词，不区分大小写
+func (t Token) is(keyword string) bool {
+	return !t.Quoted && strings.EqualFold(t.Text, keyword)
+}
+
+// 不带引号的单词按关键字处理时统一为小写
+func (t Token) keyword() string {
+	if t.Quoted {
+		return ""
+	}
+	return strings.ToLower(t.Text)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// 按空白拆分语句，单引号字符串可以包含空白
+func tokenize(input string) ([]Token, error) {
+	var tokens []Token
+	for i := 0; i < len(input); {
+		if isSpace(input[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		if input[i] != '\'' {
+			for i < len(input) && !isSpace(input[i]) && input[i] != '\'' {
+				i++
+			}
+			tokens = append(tokens, Token{Text: input[start:i], Pos: start, End: i})
+			continue
+		}
+
+		text, end, ok := scanQuoted(input, i)
+		if !ok {
+			return nil, fmt.Errorf("%w at position %d", ErrUnterminatedString, start)
+		}
+		tokens = append(tokens, Token{Text: text, Quoted: true, Pos: start, End: end})
+		i = end
+	}
+	return tokens, nil
+}
+
+// 从start处的单引号开始读取字符串，返回去掉转义后的值和结束位置
+func scanQuoted(input string, start int) (string, int, bool) {
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		if input[i] != '\'' {
+			b.WriteByte(input[i])
+			continue
+		}
+		if i+1 < len(input) && input[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), i + 1, true
+	}
+	return "", len(input), false
+}
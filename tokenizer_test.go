@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenizeQuotedStrings(t *testing.T) {
+	tokens, err := tokenize("insert 1 'alice smith' 'o''brien@example.com'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, tok := range tokens {
+		texts = append(texts, tok.Text)
+	}
+	want := []string{"insert", "1", "alice smith", "o'brien@example.com"}
+	if !slices.Equal(texts, want) {
+		t.Errorf("tokens %q, want %q", texts, want)
+	}
+	if !tokens[2].Quoted || tokens[1].Quoted {
+		t.Errorf("quoted flags %v, %v", tokens[1].Quoted, tokens[2].Quoted)
+	}
+	// 引号括起来的关键字不是关键字
+	if !tokens[0].is("INSERT") || (Token{Text: "insert", Quoted: true}).is("insert") {
+		t.Error("keywords must be unquoted and case-insensitive")
+	}
+
+	if _, err := tokenize("insert 1 'alice"); err == nil {
+		t.Error("unterminated string was accepted")
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	for _, tc := range []struct {
+		input, want string
+		closed      bool
+	}{
+		{"select -- all rows", "select ", true},
+		{"select /* all */ * from users", "select   * from users", true},
+		{"insert 1 a '--not a comment'", "insert 1 a '--not a comment'", true},
+		{"select /* unterminated", "select ", false},
+	} {
+		got, closed := stripComments(tc.input)
+		if got != tc.want || closed != tc.closed {
+			t.Errorf("stripComments(%q) = %q, %v, want %q, %v", tc.input, got, closed, tc.want, tc.closed)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements("insert 1 a 'x;y' ; select;")
+	want := []string{"insert 1 a 'x;y'", "select", ""}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitStatements = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 两阶段提交：prepare transaction 把事务缓存的行写入 FILENAME-prepared 并同步，
+// 之后即使进程崩溃，外部协调者也可以用 commit prepared 或 rollback prepared 结束它。
+// 提交时先在文件中记下提交前的行数再写入行，重新打开数据库时据此补全没有完成的提交。
+// 表只在末尾追加行，只有main数据库的表可以参与两阶段提交
+const (
+	PREPARED_FILE_SUFFIX = "-prepared"
+	PREPARED_GID_MAX_LEN = 200
+)
+
+var (
+	ErrUnknownPreparedTx = fmt.Errorf("no such prepared transaction")
+	ErrPreparedTxExists  = fmt.Errorf("prepared transaction already exists")
+	ErrPreparedTxCommit  = fmt.Errorf("prepared transaction is being committed")
+)
+
+// PreparedTransaction 是已经准备好、等待协调者决定的事务
+type PreparedTransaction struct {
+	GID string `json:"gid"`
+	// 序列化后的行，格式与表中的行相同
+	Rows [][]byte `json:"rows"`
+	// 开始提交时为true，Base是当时表的行数
+	Committed bool   `json:"committed,omitempty"`
+	Base      uint32 `json:"base,omitempty"`
+	// 持有事务的表锁，重新打开数据库后恢复的事务没有锁
+	owner *Session
+}
+
+// prepare transaction 'GID' / commit prepared 'GID' / rollback prepared 'GID'
+func (stat *Statement) prepareTwoPhase(parts []Token, typ StatementType) error {
+	switch {
+	case len(parts) < 3:
+		return stat.syntaxError(parts, 2, "")
+	case !parts[2].Quoted:
+		return stat.syntaxError(parts, 2, "expected a quoted transaction id")
+	case parts[2].Text == "" || len(parts[2].Text) > PREPARED_GID_MAX_LEN:
+		return stat.syntaxError(parts, 2, fmt.Sprintf("transaction id must be 1 to %d bytes", PREPARED_GID_MAX_LEN))
+	case len(parts) > 3:
+		return stat.syntaxError(parts, 3, "")
+	}
+	stat.Typ = typ
+	stat.Name = parts[2].Text
+	return nil
+}
+
+// 结束会话的事务，把它缓存的行持久化为一个准备好的事务，表锁转交给它。
+// 失败时事务被回滚
+func (s *Session) prepareTransaction(gid string) error {
+	tx := s.tx
+	defer s.endTransaction()
+	// 只读事务没有可以准备的写入
+	if tx.snapshot != nil {
+		return ErrReadOnlyTransaction
+	}
+
+	c := s.catalog
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.prepared[gid]; ok {
+		return fmt.Errorf("%w: %s", ErrPreparedTxExists, gid)
+	}
+	p := &PreparedTransaction{GID: gid}
+	for _, name := range tx.order {
+		if name != qualifyTableName(USERS_TABLE) {
+			return fmt.Errorf("only tables in the %s database can be in a prepared transaction", MAIN_DATABASE)
+		}
+		t, err := c.resolveWritable(name)
+		if err != nil {
+			return err
+		}
+		// 提交时不能再失败，提前检查插入时的约束
+		for i := range tx.pending[name] {
+			row := &tx.pending[name][i]
+			if t.checkEmail {
+				if err := checkEmail(row.email()); err != nil {
+					return err
+				}
+			}
+			record := make([]byte, ROW_SIZE)
+			serializeRow(row, record)
+			p.Rows = append(p.Rows, record)
+		}
+	}
+
+	if c.prepared == nil {
+		c.prepared = make(map[string]*PreparedTransaction)
+	}
+	c.prepared[gid] = p
+	if err := c.writePrepared(); err != nil {
+		delete(c.prepared, gid)
+		return err
+	}
+	p.owner = NewSession(c, s.user, s.client)
+	c.locks.transfer(s, p.owner)
+	return nil
+}
+
+// 写入准备好的事务的行，返回前把表同步到磁盘，与synchronous的设置无关。
+// 写回或同步失败时事务保持提交中的状态，协调者重试时再次写回和同步
+func (c *Catalog) commitPrepared(gid string) (int, error) {
+	c.mu.Lock()
+	p, ok := c.prepared[gid]
+	if !ok {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("%w: %s", ErrUnknownPreparedTx, gid)
+	}
+	t := c.databases[MAIN_DATABASE].table
+	if !p.Committed {
+		p.Committed, p.Base = true, t.numRows
+		if err := c.writePrepared(); err != nil {
+			p.Committed, p.Base = false, 0
+			c.mu.Unlock()
+			return 0, err
+		}
+		if err := t.insertPrepared(p); err != nil {
+			// 撤销写入的行，协调者可以重试提交。文件中仍是提交中的记录时，重新打开时会补全提交
+			t.rewind(p.Base)
+			p.Committed, p.Base = false, 0
+			c.writePrepared()
+			c.mu.Unlock()
+			return 0, err
+		}
+		t.recordHistory()
+	}
+	err := t.flushNewRows()
+	c.mu.Unlock()
+	if err == nil && t.pager.file != nil {
+		err = c.commits.sync([]*Pager{t.pager})
+	}
+	if err != nil {
+		// 行已经写入页缓存，重试或重新打开时按文件中的记录补全提交
+		return 0, err
+	}
+
+	c.mu.Lock()
+	delete(c.prepared, gid)
+	err = c.writePrepared()
+	c.mu.Unlock()
+	if p.owner != nil {
+		c.locks.releaseAll(p.owner)
+	}
+	return len(p.Rows), err
+}
+
+func (c *Catalog) rollbackPrepared(gid string) error {
+	c.mu.Lock()
+	p, ok := c.prepared[gid]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownPreparedTx, gid)
+	}
+	if p.Committed {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrPreparedTxCommit, gid)
+	}
+	delete(c.prepared, gid)
+	err := c.writePrepared()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if p.owner != nil {
+		c.locks.releaseAll(p.owner)
+	}
+	return nil
+}
+
+// 从Base开始写入事务的行，之前部分写入的行被覆盖
+func (t *Table) insertPrepared(p *PreparedTransaction) error {
+	t.rewind(min(t.numRows, p.Base))
+	var row Row
+	for _, record := range p.Rows {
+		deserializeRow(record, &row)
+		if err := t.insertRow(&row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 打开数据库时读取准备好的事务，补全崩溃时没有完成的提交
+func (c *Catalog) recoverPrepared() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	filename := c.preparedFilename()
+	if filename == "" {
+		return nil
+	}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return ioError(err)
+	}
+	var txs []*PreparedTransaction
+	if err := json.Unmarshal(data, &txs); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	c.prepared = make(map[string]*PreparedTransaction)
+	t := c.databases[MAIN_DATABASE].table
+	for _, p := range txs {
+		if !p.Committed {
+			c.prepared[p.GID] = p
+			continue
+		}
+		// 行数不少于提交后的行数时，事务的行已经全部写入
+		if t.numRows >= p.Base+uint32(len(p.Rows)) {
+			continue
+		}
+		if err := t.insertPrepared(p); err != nil {
+			return err
+		}
+		if err := t.flushNewRows(); err != nil {
+			return err
+		}
+		if err := t.pager.sync(); err != nil {
+			return err
+		}
+	}
+	return c.writePrepared()
+}
+
+func (c *Catalog) preparedFilename() string {
+	return sidecarFilename(c.databases[MAIN_DATABASE].filename, PREPARED_FILE_SUFFIX)
+}
+
+// 用临时文件替换 FILENAME-prepared 并同步，没有准备好的事务时删除文件。调用方持有锁
+func (c *Catalog) writePrepared() error {
+	filename := c.preparedFilename()
+	if filename == "" {
+		return nil
+	}
+	if len(c.prepared) == 0 {
+		if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return ioError(err)
+		}
+		return nil
+	}
+
+	txs := make([]*PreparedTransaction, 0, len(c.prepared))
+	for _, p := range c.prepared {
+		txs = append(txs, p)
+	}
+	slices.SortFunc(txs, func(a, b *PreparedTransaction) int { return strings.Compare(a.GID, b.GID) })
+	data, err := json.Marshal(txs)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return ioError(err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return ioError(err)
+	}
+	// 同步目录，使改名在崩溃后仍然有效
+	dir, err := os.Open(filepath.Dir(filename))
+	if err != nil {
+		return ioError(err)
+	}
+	defer dir.Close()
+	return ioError(dir.Sync())
+}
+
+// 按事务id排序的准备好的事务，调用方持有锁
+func (c *Catalog) preparedTransactions() []string {
+	var gids []string
+	for gid := range c.prepared {
+		gids = append(gids, gid)
+	}
+	slices.Sort(gids)
+	return gids
+}
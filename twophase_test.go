@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func reopenTestCatalog(t *testing.T, c *Catalog, filename string) *Catalog {
+	t.Helper()
+	if err := c.close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.close() })
+	return c
+}
+
+func TestPreparedTransactionSurvivesReopen(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "begin")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "prepare transaction 'g1'")
+	s.close()
+
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := execTest(t, s, "select"); len(got) != 0 {
+		t.Fatalf("prepared rows visible before commit: %v", got)
+	}
+	execTest(t, s, "commit prepared 'g1'")
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("rows after commit prepared = %v, want [1]", got)
+	}
+	if _, err := os.Stat(filename + PREPARED_FILE_SUFFIX); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("prepared file left after commit: %v", err)
+	}
+}
+
+func TestReopenCompletesPartialCommit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	c, err := NewCatalog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(c, "", "test")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	// 崩溃时事务的两行中只写入了第一行
+	execTest(t, s, "insert 2 bob bob@example.com")
+	s.close()
+
+	var rows [][]byte
+	for _, row := range []Row{{ID: 2}, {ID: 3}} {
+		record := make([]byte, ROW_SIZE)
+		serializeRow(&row, record)
+		rows = append(rows, record)
+	}
+	data, err := json.Marshal([]*PreparedTransaction{{GID: "g1", Rows: rows, Committed: true, Base: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename+PREPARED_FILE_SUFFIX, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c = reopenTestCatalog(t, c, filename)
+	s = NewSession(c, "", "test")
+	defer s.close()
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1, 2, 3}) {
+		t.Errorf("rows after recovery = %v, want [1 2 3]", got)
+	}
+	if len(c.prepared) != 0 {
+		t.Errorf("completed commit still prepared: %v", c.prepared)
+	}
+}
+
+func TestRollbackPrepared(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "begin")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "prepare transaction 'g1'")
+	execTest(t, s, "rollback prepared 'g1'")
+
+	if got := execTest(t, s, "select"); len(got) != 0 {
+		t.Errorf("rows after rollback prepared = %v", got)
+	}
+	if err := execTestErr(t, s, "commit prepared 'g1'"); !errors.Is(err, ErrUnknownPreparedTx) {
+		t.Errorf("commit after rollback: %v, want %v", err, ErrUnknownPreparedTx)
+	}
+	// 表锁随回滚释放
+	execTest(t, s, "insert 2 bob bob@example.com")
+}
+
+func TestCommitPreparedRetriesAfterFailedSync(t *testing.T) {
+	c := openTestCatalog(t)
+	s := NewSession(c, "", "test")
+	defer s.close()
+	execTest(t, s, "begin")
+	execTest(t, s, "insert 1 alice alice@example.com")
+	execTest(t, s, "prepare transaction 'g1'")
+
+	// 模拟写入行之后同步失败：事务停在提交中的状态
+	p := c.prepared["g1"]
+	table := c.databases[MAIN_DATABASE].table
+	p.Committed, p.Base = true, table.numRows
+	if err := table.insertPrepared(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := execTestErr(t, s, "rollback prepared 'g1'"); !errors.Is(err, ErrPreparedTxCommit) {
+		t.Errorf("rollback of a committing transaction: %v, want %v", err, ErrPreparedTxCommit)
+	}
+	execTest(t, s, "commit prepared 'g1'")
+	if got := execTest(t, s, "select"); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("rows after retried commit = %v, want [1]", got)
+	}
+}
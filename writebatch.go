@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+)
+
+// WriteBatch 收集对一张或多张键值表的写入和删除，Commit时一起生效：
+// 其他连接要么看到所有修改，要么一条也看不到，写回文件失败时撤销所有修改。
+// 键值表没有日志，写回多个页的过程中进程崩溃仍可能只留下一部分页
+type WriteBatch struct {
+	ops []kvOp
+}
+
+type kvOp struct {
+	kv     *KVTable
+	key    []byte
+	value  []byte
+	delete bool
+	// 提交后表示删除的键是否存在
+	found bool
+}
+
+// 串行化批量提交，一批涉及的多张表的锁都在这把锁下获取，不会互相等待
+var kvBatchMu sync.Mutex
+
+// 撤销一条修改需要的信息，old为nil表示修改前键不存在
+type kvUndo struct {
+	kv   *KVTable
+	key  string
+	slot uint32
+	old  []byte
+}
+
+type kvFreeSlots struct {
+	numSlots uint32
+	free     []uint32
+}
+
+func (b *WriteBatch) Put(kv *KVTable, key, value []byte) error {
+	if err := checkKV(key, value); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, kvOp{kv: kv, key: bytes.Clone(key), value: bytes.Clone(value)})
+	return nil
+}
+
+func (b *WriteBatch) Delete(kv *KVTable, key []byte) {
+	b.ops = append(b.ops, kvOp{kv: kv, key: bytes.Clone(key), delete: true})
+}
+
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Commit 按加入的顺序执行所有修改，再把修改过的页写回文件
+func (b *WriteBatch) Commit() error {
+	kvBatchMu.Lock()
+	defer kvBatchMu.Unlock()
+
+	var tables []*KVTable
+	for _, op := range b.ops {
+		if !slices.Contains(tables, op.kv) {
+			tables = append(tables, op.kv)
+		}
+	}
+	saved := make(map[*KVTable]kvFreeSlots, len(tables))
+	for _, kv := range tables {
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		saved[kv] = kvFreeSlots{kv.numSlots, slices.Clone(kv.free)}
+	}
+
+	var undo []kvUndo
+	dirty := make(map[*KVTable][]uint32)
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			u := undo[i]
+			// 修改过的页还在缓存中
+			record, _ := u.kv.slot(u.slot)
+			if u.old == nil {
+				clear(record)
+				delete(u.kv.index, u.key)
+			} else {
+				copy(record, u.old)
+				u.kv.index[u.key] = u.slot
+			}
+		}
+		for kv, s := range saved {
+			kv.numSlots, kv.free = s.numSlots, s.free
+		}
+		// 已经写回的页恢复为修改前的内容
+		for kv, pages := range dirty {
+			for _, pageNum := range pages {
+				kv.pager.flush(pageNum, PAGE_SIZE)
+			}
+		}
+	}
+
+	for i := range b.ops {
+		op := &b.ops[i]
+		u := kvUndo{kv: op.kv, key: string(op.key)}
+		if slot, ok := op.kv.index[u.key]; ok {
+			record, err := op.kv.slot(slot)
+			if err != nil {
+				rollback()
+				return err
+			}
+			u.old = bytes.Clone(record)
+		}
+		var err error
+		if op.delete {
+			u.slot, op.found, err = op.kv.delete(op.key)
+		} else {
+			u.slot, err = op.kv.put(op.key, op.value)
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+		if op.delete && !op.found {
+			continue
+		}
+		undo = append(undo, u)
+		if pageNum := u.slot / KV_RECORDS_PER_PAGE; !slices.Contains(dirty[op.kv], pageNum) {
+			dirty[op.kv] = append(dirty[op.kv], pageNum)
+		}
+	}
+
+	for _, kv := range tables {
+		for _, pageNum := range dirty[kv] {
+			if err := kv.pager.flush(pageNum, PAGE_SIZE); err != nil {
+				rollback()
+				return err
+			}
+		}
+	}
+	// 每张表只同步一次
+	for _, kv := range tables {
+		if err := kv.syncFull(); err != nil {
+			rollback()
+			return err
+		}
+	}
+	return nil
+}